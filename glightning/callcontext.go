@@ -0,0 +1,95 @@
+package glightning
+
+import (
+	"errors"
+	"github.com/niftynei/glightning/jrpc2"
+)
+
+// Embed a CallContext in an RpcMethod to send lightningd messages
+// and progress updates about the call while it's running, which
+// lightning-cli shows to the user. eg
+//
+//	type Rescan struct {
+//		glightning.CallContext
+//		Blocks int `json:"blocks"`
+//	}
+//
+//	func (r *Rescan) Call() (jrpc2.Result, error) {
+//		for i := 0; i < r.Blocks; i++ {
+//			r.Progress(i, r.Blocks)
+//			...
+//
+// It's set before Call, and stays usable after Call returns, eg
+// for a deferred response.
+type CallContext struct {
+	server *jrpc2.Server
+	id     *jrpc2.Id
+}
+
+func (c *CallContext) SetRequestContext(s *jrpc2.Server, id *jrpc2.Id) {
+	c.server = s
+	c.id = id
+}
+
+// The id of the request being answered
+func (c *CallContext) RequestId() *jrpc2.Id {
+	return c.id
+}
+
+// Send a message about this call; it's shown to whoever
+// made it, and logged by lightningd.
+func (c *CallContext) Message(level LogLevel, message string) error {
+	if c.server == nil {
+		return errors.New("Not in a call")
+	}
+	return c.server.Notify(&MessageNotification{c.id, level.String(), message})
+}
+
+// Report that {num} out of {total} steps are done
+func (c *CallContext) Progress(num, total int) error {
+	return c.notifyProgress(&ProgressNotification{Id: c.id, Num: num, Total: total})
+}
+
+// Report progress through one stage of a call that has {stages}
+// of them. Stages are numbered from 0.
+func (c *CallContext) StageProgress(num, total, stage, stages int) error {
+	return c.notifyProgress(&ProgressNotification{
+		Id:    c.id,
+		Num:   num,
+		Total: total,
+		Stage: &ProgressStage{stage, stages},
+	})
+}
+
+func (c *CallContext) notifyProgress(n *ProgressNotification) error {
+	if c.server == nil {
+		return errors.New("Not in a call")
+	}
+	return c.server.Notify(n)
+}
+
+type MessageNotification struct {
+	Id      *jrpc2.Id `json:"id"`
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+}
+
+func (n *MessageNotification) Name() string {
+	return "message"
+}
+
+type ProgressNotification struct {
+	Id    *jrpc2.Id      `json:"id"`
+	Num   int            `json:"num"`
+	Total int            `json:"total"`
+	Stage *ProgressStage `json:"stage,omitempty"`
+}
+
+type ProgressStage struct {
+	Num   int `json:"num"`
+	Total int `json:"total"`
+}
+
+func (n *ProgressNotification) Name() string {
+	return "progress"
+}
@@ -0,0 +1,151 @@
+package glightning
+
+import (
+	"fmt"
+	"github.com/niftynei/glightning/jrpc2"
+	"sync"
+	"sync/atomic"
+)
+
+// Errors commando returns. Errors from the command itself, once
+// it's run on the remote node, come back as they are.
+const (
+	ErrCommandoLocal      = 19535
+	ErrCommandoRemote     = 19536
+	ErrCommandoRemoteAuth = 19537
+)
+
+// Commands go over the lightning network, so they get
+// longer than local ones to come back
+const defaultCommandoTimeout = 60
+
+// What Lightning needs from its connection to lightningd
+type rpcClient interface {
+	SetTimeout(secs uint)
+	SocketStart(socket string, up chan bool) error
+	Shutdown()
+	Close()
+	IsUp() bool
+	Request(m jrpc2.Method, resp interface{}) error
+	RequestNoTimeout(m jrpc2.Method, resp interface{}) error
+	RequestWithTimeout(m jrpc2.Method, resp interface{}, secs uint) error
+}
+
+// A Lightning whose requests all run on the remote node {peerId},
+// through {local}'s commando command, using {encodedRune} to authorize them.
+// The typed API works as usual, as far as the rune allows, eg
+//
+//	remote := glightning.NewRemoteLightning(lightning, peerId, rune)
+//	peers, err := remote.ListPeers()
+//
+// It needs no starting up (StartUp only marks it up), but {local}
+// must be up, and connected to {peerId}. Shutting it down leaves
+// {local} running.
+func NewRemoteLightning(local *Lightning, peerId, encodedRune string) *Lightning {
+	return &Lightning{
+		client: &commandoClient{
+			local:   local.client,
+			peerId:  peerId,
+			rune:    encodedRune,
+			timeout: defaultCommandoTimeout,
+			done:    make(chan struct{}),
+		},
+		isUp: true,
+	}
+}
+
+type commandoClient struct {
+	local  rpcClient
+	peerId string
+	rune   string
+	// seconds, accessed atomically
+	timeout uint32
+
+	// closed on shutdown
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+func newCommandoRequest(peerId, encodedRune string, m jrpc2.Method) (*CommandoRequest, error) {
+	if peerId == "" {
+		return nil, fmt.Errorf("Must supply a peer id")
+	}
+	var params interface{}
+	if rm, ok := m.(jrpc2.RawParamsMethod); ok {
+		raw, err := rm.RawParams()
+		if err != nil {
+			return nil, err
+		}
+		params = raw
+	} else {
+		params = jrpc2.GetNamedParams(m)
+	}
+	return &CommandoRequest{
+		PeerId: peerId,
+		Method: m.Name(),
+		Params: params,
+		Rune:   encodedRune,
+	}, nil
+}
+
+func (c *commandoClient) SetTimeout(secs uint) {
+	atomic.StoreUint32(&c.timeout, uint32(secs))
+}
+
+// Requests go through the local node, so there's no socket to
+// start. Like a socket, this blocks until we're shut down.
+func (c *commandoClient) SocketStart(socket string, up chan bool) error {
+	if up != nil {
+		up <- true
+	}
+	<-c.done
+	return nil
+}
+
+func (c *commandoClient) Shutdown() {
+	c.doneOnce.Do(func() { close(c.done) })
+}
+
+func (c *commandoClient) Close() {
+	c.Shutdown()
+}
+
+func (c *commandoClient) isShutdown() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *commandoClient) IsUp() bool {
+	return !c.isShutdown() && c.local.IsUp()
+}
+
+func (c *commandoClient) Request(m jrpc2.Method, resp interface{}) error {
+	return c.RequestWithTimeout(m, resp, uint(atomic.LoadUint32(&c.timeout)))
+}
+
+func (c *commandoClient) RequestNoTimeout(m jrpc2.Method, resp interface{}) error {
+	req, err := c.wrap(m)
+	if err != nil {
+		return err
+	}
+	return c.local.RequestNoTimeout(req, resp)
+}
+
+func (c *commandoClient) RequestWithTimeout(m jrpc2.Method, resp interface{}, secs uint) error {
+	req, err := c.wrap(m)
+	if err != nil {
+		return err
+	}
+	return c.local.RequestWithTimeout(req, resp, secs)
+}
+
+func (c *commandoClient) wrap(m jrpc2.Method) (*CommandoRequest, error) {
+	if c.isShutdown() {
+		return nil, fmt.Errorf("Client is shutdown")
+	}
+	return newCommandoRequest(c.peerId, c.rune, m)
+}
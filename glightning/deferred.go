@@ -0,0 +1,112 @@
+package glightning
+
+import (
+	"fmt"
+	"github.com/niftynei/glightning/jrpc2"
+	"log"
+	"reflect"
+	"time"
+)
+
+// A Deferred is a handle to a hook or method response that will
+// be sent at some later time. Useful for things like hold invoices,
+// where an htlc_accepted hook may not have an answer for hours.
+//
+// Deferreds that are created with a key are stored on the plugin
+// until they're completed, so they can be looked up from anywhere
+// with Plugin.GetDeferred. They're only kept in memory: if the
+// plugin or lightningd restarts, pending ones are gone, and the
+// replayed hook needs deferring again.
+type Deferred struct {
+	*jrpc2.Deferral
+	key string
+}
+
+func (d *Deferred) Key() string {
+	return d.key
+}
+
+// Create a new deferred response. Return it from an RpcMethod's Call
+// to hold the response until it's resolved.
+//
+// If the {timeout} is non-zero and the response hasn't been resolved
+// by then, the {fallback} is sent instead (or an error, if there's no
+// fallback). If a {key} is provided, the deferred can be found later
+// with GetDeferred. A pending deferred with the same key is failed,
+// so its request still gets an answer, and this one takes its place.
+func (p *Plugin) Defer(key string, timeout time.Duration, fallback jrpc2.Result) *Deferred {
+	d := &Deferred{
+		Deferral: jrpc2.NewDeferral(timeout, fallback),
+		key:      key,
+	}
+	if key == "" {
+		return d
+	}
+
+	p.deferredMu.Lock()
+	replaced := p.deferred[key]
+	p.deferred[key] = d
+	p.deferredMu.Unlock()
+
+	d.OnDone(func() {
+		p.deferredMu.Lock()
+		defer p.deferredMu.Unlock()
+		// only remove ourselves, not a replacement
+		if p.deferred[key] == d {
+			delete(p.deferred, key)
+		}
+	})
+	if replaced != nil {
+		replaced.Fail(fmt.Errorf("Deferred response %s was replaced", key))
+	}
+	return d
+}
+
+// Find a pending deferred response by key
+func (p *Plugin) GetDeferred(key string) (*Deferred, bool) {
+	p.deferredMu.Lock()
+	defer p.deferredMu.Unlock()
+	d, ok := p.deferred[key]
+	return d, ok
+}
+
+// Resolve the pending deferred response stored under {key}
+func (p *Plugin) ResolveDeferred(key string, result jrpc2.Result) error {
+	d, ok := p.GetDeferred(key)
+	if !ok {
+		return fmt.Errorf("No deferred response found for %s", key)
+	}
+	return d.Resolve(result)
+}
+
+// Keys of all the deferred responses that are still pending
+func (p *Plugin) PendingDeferred() []string {
+	p.deferredMu.Lock()
+	defer p.deferredMu.Unlock()
+	keys := make([]string, 0, len(p.deferred))
+	for key := range p.deferred {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// What a hook's Call sends back. A hook that deferred answers through
+// its Deferred, so anything it returned as well is ignored.
+func hookResult(hook string, deferred *Deferred, resp jrpc2.Result, err error) (jrpc2.Result, error) {
+	if deferred == nil {
+		return resp, err
+	}
+	if !isNilResult(resp) {
+		log.Printf("%s hook deferred its response, ignoring the one it returned", hook)
+	}
+	return deferred, err
+}
+
+// Hooks return typed pointers, which aren't nil once they're a Result
+func isNilResult(resp jrpc2.Result) bool {
+	if resp == nil {
+		return true
+	}
+	v := reflect.ValueOf(resp)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
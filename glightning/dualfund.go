@@ -0,0 +1,313 @@
+package glightning
+
+import (
+	"github.com/niftynei/glightning/jrpc2"
+	"time"
+)
+
+// Hooks for the v2 (dual-funded) channel establishment protocol.
+// As the accepter, lightningd asks us in `openchannel2` (or
+// `rbf_channel`, for a bump) whether and with how much to
+// contribute, passes the combined PSBT through
+// `openchannel2_changed` each time the peer updates it, and
+// finally asks us to sign our inputs in `openchannel2_sign`.
+
+type ChannelType struct {
+	Bits  []uint   `json:"bits"`
+	Names []string `json:"names"`
+}
+
+type OpenChannel2 struct {
+	PeerId                   string       `json:"id"`
+	ChannelId                string       `json:"channel_id"`
+	TheirFundingMsat         uint64       `json:"their_funding_msat"`
+	DustLimitMsat            uint64       `json:"dust_limit_msat"`
+	MaxHtlcValueInFlightMsat uint64       `json:"max_htlc_value_in_flight_msat"`
+	HtlcMinimumMsat          uint64       `json:"htlc_minimum_msat"`
+	FundingFeeratePerKw      uint         `json:"funding_feerate_per_kw"`
+	CommitmentFeeratePerKw   uint         `json:"commitment_feerate_per_kw"`
+	FeerateOurMax            uint         `json:"feerate_our_max"`
+	FeerateOurMin            uint         `json:"feerate_our_min"`
+	ToSelfDelay              uint         `json:"to_self_delay"`
+	MaxAcceptedHtlcs         uint         `json:"max_accepted_htlcs"`
+	ChannelFlags             uint         `json:"channel_flags"`
+	Locktime                 uint32       `json:"locktime"`
+	ShutdownScriptPubkey     string       `json:"shutdown_scriptpubkey"`
+	ChannelMaxMsat           uint64       `json:"channel_max_msat"`
+	RequestedLeaseMsat       uint64       `json:"requested_lease_msat"`
+	LeaseBlockheightStart    uint32       `json:"lease_blockheight_start"`
+	NodeBlockheight          uint32       `json:"node_blockheight"`
+	RequireConfirmedInputs   bool         `json:"require_confirmed_inputs"`
+	ChannelType              *ChannelType `json:"channel_type"`
+}
+
+type OpenChannel2Event struct {
+	OpenChannel2 OpenChannel2 `json:"openchannel2"`
+	hook         func(*OpenChannel2Event) (*OpenChannel2Response, error)
+	plugin       *Plugin
+	deferred     *Deferred
+}
+
+// The response to both `openchannel2` and `rbf_channel`
+type OpenChannel2Response struct {
+	Result OpenChannelResult `json:"result"`
+	// Only allowed if result is "reject"
+	// Sent back to peer.
+	Message string `json:"error_message,omitempty"`
+	// Our contribution: the inputs and outputs we're adding
+	// and how much of it goes into the channel
+	Psbt           string `json:"psbt,omitempty"`
+	OurFundingMsat uint64 `json:"our_funding_msat,omitempty"`
+	CloseToAddress string `json:"close_to,omitempty"`
+}
+
+func (oc *OpenChannel2Event) New() interface{} {
+	return &OpenChannel2Event{
+		hook:   oc.hook,
+		plugin: oc.plugin,
+	}
+}
+
+func (oc *OpenChannel2Event) Name() string {
+	return string(_OpenChannel2)
+}
+
+func (oc *OpenChannel2Event) Call() (jrpc2.Result, error) {
+	resp, err := oc.hook(oc)
+	return hookResult(oc.Name(), oc.deferred, resp, err)
+}
+
+// Respond to this hook later, via the returned handle. See Plugin.Defer
+func (oc *OpenChannel2Event) Defer(key string, timeout time.Duration, fallback *OpenChannel2Response) *Deferred {
+	oc.deferred = oc.plugin.Defer(key, timeout, fallback)
+	return oc.deferred
+}
+
+func (oc *OpenChannel2Event) Reject(errorMessage string) *OpenChannel2Response {
+	return &OpenChannel2Response{
+		Result:  OcReject,
+		Message: errorMessage,
+	}
+}
+
+// Accept the channel, without putting in any funds
+func (oc *OpenChannel2Event) Continue() *OpenChannel2Response {
+	return &OpenChannel2Response{
+		Result: OcContinue,
+	}
+}
+
+// Accept the channel, contributing {ourFunding} to it. The
+// {psbt} holds the inputs (and any change outputs) paying for it;
+// serial_ids are added if they're missing.
+func (oc *OpenChannel2Event) Fund(psbt *Psbt, ourFunding *MSat) *OpenChannel2Response {
+	return fundChannel(psbt, ourFunding)
+}
+
+type RbfChannel struct {
+	PeerId                  string `json:"id"`
+	ChannelId               string `json:"channel_id"`
+	TheirLastFundingMsat    uint64 `json:"their_last_funding_msat"`
+	TheirCurrentFundingMsat uint64 `json:"their_current_funding_msat"`
+	OurLastFundingMsat      uint64 `json:"our_last_funding_msat"`
+	FundingFeeratePerKw     uint   `json:"funding_feerate_per_kw"`
+	FeerateOurMax           uint   `json:"feerate_our_max"`
+	FeerateOurMin           uint   `json:"feerate_our_min"`
+	ChannelMaxMsat          uint64 `json:"channel_max_msat"`
+	Locktime                uint32 `json:"locktime"`
+	RequestedLeaseMsat      uint64 `json:"requested_lease_msat"`
+	RequireConfirmedInputs  bool   `json:"require_confirmed_inputs"`
+}
+
+// The `rbf_channel` hook is called when the peer wants to bump
+// the fee on a dual-funded channel's funding tx.
+type RbfChannelEvent struct {
+	RbfChannel RbfChannel `json:"rbf_channel"`
+	hook       func(*RbfChannelEvent) (*OpenChannel2Response, error)
+	plugin     *Plugin
+	deferred   *Deferred
+}
+
+func (rbf *RbfChannelEvent) New() interface{} {
+	return &RbfChannelEvent{
+		hook:   rbf.hook,
+		plugin: rbf.plugin,
+	}
+}
+
+func (rbf *RbfChannelEvent) Name() string {
+	return string(_RbfChannel)
+}
+
+func (rbf *RbfChannelEvent) Call() (jrpc2.Result, error) {
+	resp, err := rbf.hook(rbf)
+	return hookResult(rbf.Name(), rbf.deferred, resp, err)
+}
+
+// Respond to this hook later, via the returned handle. See Plugin.Defer
+func (rbf *RbfChannelEvent) Defer(key string, timeout time.Duration, fallback *OpenChannel2Response) *Deferred {
+	rbf.deferred = rbf.plugin.Defer(key, timeout, fallback)
+	return rbf.deferred
+}
+
+func (rbf *RbfChannelEvent) Reject(errorMessage string) *OpenChannel2Response {
+	return &OpenChannel2Response{
+		Result:  OcReject,
+		Message: errorMessage,
+	}
+}
+
+// Allow the bump, without putting in any funds
+func (rbf *RbfChannelEvent) Continue() *OpenChannel2Response {
+	return &OpenChannel2Response{
+		Result: OcContinue,
+	}
+}
+
+// Allow the bump, contributing {ourFunding} with the inputs
+// in {psbt}. These replace whatever we put in last time.
+func (rbf *RbfChannelEvent) Fund(psbt *Psbt, ourFunding *MSat) *OpenChannel2Response {
+	return fundChannel(psbt, ourFunding)
+}
+
+func fundChannel(psbt *Psbt, ourFunding *MSat) *OpenChannel2Response {
+	psbt.AddSerialIds(TxAccepter)
+	return &OpenChannel2Response{
+		Result:         OcContinue,
+		Psbt:           psbt.Encode(),
+		OurFundingMsat: ourFunding.Value,
+	}
+}
+
+type OpenChannel2Changed struct {
+	ChannelId              string `json:"channel_id"`
+	Psbt                   string `json:"psbt"`
+	RequireConfirmedInputs bool   `json:"require_confirmed_inputs"`
+}
+
+// The `openchannel2_changed` hook is called when the peer sends
+// an updated funding PSBT. Respond with the PSBT, including any
+// changes of our own; once neither side changes anything the
+// funding tx is final.
+type OpenChannel2ChangedEvent struct {
+	Changed  OpenChannel2Changed `json:"openchannel2_changed"`
+	hook     func(*OpenChannel2ChangedEvent) (*OpenChannel2ChangedResponse, error)
+	plugin   *Plugin
+	deferred *Deferred
+}
+
+type _OpenChannel2ChangedResult string
+
+const _Oc2Continue _OpenChannel2ChangedResult = "continue"
+
+type OpenChannel2ChangedResponse struct {
+	Result _OpenChannel2ChangedResult `json:"result"`
+	Psbt   string                     `json:"psbt"`
+}
+
+func (occ *OpenChannel2ChangedEvent) New() interface{} {
+	return &OpenChannel2ChangedEvent{
+		hook:   occ.hook,
+		plugin: occ.plugin,
+	}
+}
+
+func (occ *OpenChannel2ChangedEvent) Name() string {
+	return string(_OpenChannel2Changed)
+}
+
+func (occ *OpenChannel2ChangedEvent) Call() (jrpc2.Result, error) {
+	resp, err := occ.hook(occ)
+	return hookResult(occ.Name(), occ.deferred, resp, err)
+}
+
+// Respond to this hook later, via the returned handle. See Plugin.Defer
+func (occ *OpenChannel2ChangedEvent) Defer(key string, timeout time.Duration, fallback *OpenChannel2ChangedResponse) *Deferred {
+	occ.deferred = occ.plugin.Defer(key, timeout, fallback)
+	return occ.deferred
+}
+
+func (occ *OpenChannel2ChangedEvent) ParsePsbt() (*Psbt, error) {
+	return DecodePsbt(occ.Changed.Psbt)
+}
+
+// Accept the peer's PSBT as is
+func (occ *OpenChannel2ChangedEvent) Continue() *OpenChannel2ChangedResponse {
+	return &OpenChannel2ChangedResponse{
+		Result: _Oc2Continue,
+		Psbt:   occ.Changed.Psbt,
+	}
+}
+
+// Send back a modified PSBT. Any inputs or outputs
+// we added are given serial_ids.
+func (occ *OpenChannel2ChangedEvent) Adjust(psbt *Psbt) *OpenChannel2ChangedResponse {
+	psbt.AddSerialIds(TxAccepter)
+	return &OpenChannel2ChangedResponse{
+		Result: _Oc2Continue,
+		Psbt:   psbt.Encode(),
+	}
+}
+
+type OpenChannel2Sign struct {
+	ChannelId string `json:"channel_id"`
+	Psbt      string `json:"psbt"`
+}
+
+// The `openchannel2_sign` hook is called once the funding tx is
+// final, for us to sign our inputs. Use `signpsbt`, with the
+// indexes from Psbt.InputsFor(TxAccepter).
+type OpenChannel2SignEvent struct {
+	Sign     OpenChannel2Sign `json:"openchannel2_sign"`
+	hook     func(*OpenChannel2SignEvent) (*OpenChannel2SignResponse, error)
+	plugin   *Plugin
+	deferred *Deferred
+}
+
+type OpenChannel2SignResponse struct {
+	Result _OpenChannel2ChangedResult `json:"result"`
+	Psbt   string                     `json:"psbt"`
+}
+
+func (ocs *OpenChannel2SignEvent) New() interface{} {
+	return &OpenChannel2SignEvent{
+		hook:   ocs.hook,
+		plugin: ocs.plugin,
+	}
+}
+
+func (ocs *OpenChannel2SignEvent) Name() string {
+	return string(_OpenChannel2Sign)
+}
+
+func (ocs *OpenChannel2SignEvent) Call() (jrpc2.Result, error) {
+	resp, err := ocs.hook(ocs)
+	return hookResult(ocs.Name(), ocs.deferred, resp, err)
+}
+
+// Respond to this hook later, via the returned handle. See Plugin.Defer
+func (ocs *OpenChannel2SignEvent) Defer(key string, timeout time.Duration, fallback *OpenChannel2SignResponse) *Deferred {
+	ocs.deferred = ocs.plugin.Defer(key, timeout, fallback)
+	return ocs.deferred
+}
+
+func (ocs *OpenChannel2SignEvent) ParsePsbt() (*Psbt, error) {
+	return DecodePsbt(ocs.Sign.Psbt)
+}
+
+// Pass the PSBT back unsigned; for when we didn't add any inputs
+func (ocs *OpenChannel2SignEvent) Continue() *OpenChannel2SignResponse {
+	return &OpenChannel2SignResponse{
+		Result: _Oc2Continue,
+		Psbt:   ocs.Sign.Psbt,
+	}
+}
+
+// Send back the PSBT with our inputs signed. {signedPsbt} is
+// base64, as returned by `signpsbt`.
+func (ocs *OpenChannel2SignEvent) Signed(signedPsbt string) *OpenChannel2SignResponse {
+	return &OpenChannel2SignResponse{
+		Result: _Oc2Continue,
+		Psbt:   signedPsbt,
+	}
+}
@@ -0,0 +1,166 @@
+package glightning
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/niftynei/glightning/jrpc2"
+	"reflect"
+)
+
+// How many times KVStore.Update retries when another writer
+// gets in first
+const kvUpdateRetries = 5
+
+// A KVStore keeps JSON encoded values in lightningd's datastore,
+// under {prefix}, so a plugin's state survives restarts. The
+// prefix should start with the plugin's name, eg
+//
+//	store := glightning.NewKVStore(lightning, "myplugin", "peers")
+//	err := store.Put(peerId, &PeerState{Score: 10})
+type KVStore struct {
+	lightning *Lightning
+	prefix    []string
+}
+
+func NewKVStore(lightning *Lightning, prefix ...string) *KVStore {
+	return &KVStore{
+		lightning: lightning,
+		prefix:    prefix,
+	}
+}
+
+func (kv *KVStore) key(name string) []string {
+	key := make([]string, len(kv.prefix), len(kv.prefix)+1)
+	copy(key, kv.prefix)
+	return append(key, name)
+}
+
+// Store {v} at {name}, replacing whatever's there
+func (kv *KVStore) Put(name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = kv.lightning.Datastore(NewDatastoreStringRequest(kv.key(name), string(data), DatastoreCreateOrReplace))
+	return err
+}
+
+// Load the value at {name} into {v}. Returns false, and leaves
+// {v} alone, if there's nothing stored there.
+func (kv *KVStore) Get(name string, v interface{}) (bool, error) {
+	entry, err := kv.get(kv.key(name))
+	if err != nil || entry == nil {
+		return false, err
+	}
+	return true, kv.decode(entry, v)
+}
+
+// The entry at {key}, or nil if there isn't one with a value
+func (kv *KVStore) get(key []string) (*DatastoreEntry, error) {
+	entry, err := kv.lightning.GetDatastore(key)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	if !entry.HasValue() {
+		return nil, nil
+	}
+	return entry, nil
+}
+
+func (kv *KVStore) decode(entry *DatastoreEntry, v interface{}) error {
+	data, err := entry.Bytes()
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("Bad value at %v: %s", entry.Key, err)
+	}
+	return nil
+}
+
+// Delete the value at {name}. It's not an error if there isn't one.
+func (kv *KVStore) Delete(name string) error {
+	_, err := kv.lightning.DelDatastore(kv.key(name), nil)
+	if rpcErr, ok := err.(*jrpc2.RpcError); ok && rpcErr.Code == ErrDatastoreDelDoesNotExist {
+		return nil
+	}
+	return err
+}
+
+// The names of the values in the store
+func (kv *KVStore) Keys() ([]string, error) {
+	entries, err := kv.lightning.ListDatastore(kv.prefix)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if len(entry.Key) == len(kv.prefix)+1 && entry.HasValue() {
+			names = append(names, entry.Key[len(kv.prefix)])
+		}
+	}
+	return names, nil
+}
+
+// Read-modify-write the value at {name}. It's loaded into {v}, a
+// pointer (which is left alone if there's nothing stored yet), {update}
+// is called to change it, and it's written back only if no one else
+// has changed it in the meantime. Otherwise, {v} is put back as it was
+// passed in, reloaded, and {update} is called again.
+func (kv *KVStore) Update(name string, v interface{}, update func() error) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("Update needs a pointer to load into, not %T", v)
+	}
+	initial, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	key := kv.key(name)
+	for i := 0; i < kvUpdateRetries; i++ {
+		if i > 0 {
+			// undo the last attempt's update
+			rv.Elem().Set(reflect.Zero(rv.Elem().Type()))
+			if err := json.Unmarshal(initial, v); err != nil {
+				return err
+			}
+		}
+		entry, err := kv.get(key)
+		if err != nil {
+			return err
+		}
+		if entry != nil {
+			if err := kv.decode(entry, v); err != nil {
+				return err
+			}
+		}
+		if err := update(); err != nil {
+			return err
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		var req *DatastoreRequest
+		if entry == nil {
+			req = NewDatastoreStringRequest(key, string(data), DatastoreMustCreate)
+		} else {
+			req = NewDatastoreStringRequest(key, string(data), DatastoreMustReplace).IfGeneration(entry.Generation)
+		}
+		_, err = kv.lightning.Datastore(req)
+		rpcErr, ok := err.(*jrpc2.RpcError)
+		if !ok || !isKVConflict(rpcErr.Code) {
+			return err
+		}
+	}
+	return fmt.Errorf("Gave up updating %v, it kept changing", key)
+}
+
+// Whether someone else created, changed or deleted the entry
+// between our reading and writing it
+func isKVConflict(code int) bool {
+	return code == ErrDatastoreUpdateAlreadyExists ||
+		code == ErrDatastoreUpdateWrongGeneration ||
+		code == ErrDatastoreUpdateDoesNotExist
+}
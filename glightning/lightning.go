@@ -1,19 +1,26 @@
 package glightning
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/niftynei/glightning/jrpc2"
 	"log"
 	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
 )
 
 // This file's the one that holds all the objects for the
 // c-lightning RPC commands
 type Lightning struct {
-	client *jrpc2.Client
+	client rpcClient
 	isUp   bool
+	// closed to stop reconnecting
+	done     chan bool
+	doneOnce sync.Once
 }
 
 func NewLightning() *Lightning {
@@ -37,7 +44,61 @@ func (l *Lightning) StartUp(rpcfile, lightningDir string) {
 	l.isUp = <-up
 }
 
+// Like StartUp, but if the connection to lightningd drops we keep
+// trying to re-establish it, every {retry}, until Shutdown is called.
+// Requests made while disconnected fail right away.
+//
+// Blocks until the first connection attempt completes and returns
+// its error, if any. We keep retrying even if it fails.
+func (l *Lightning) StartUpWithReconnect(rpcfile, lightningDir string, retry time.Duration) error {
+	l.done = make(chan bool)
+	up := make(chan bool, 1)
+	failed := make(chan error, 1)
+	go l.keepConnected(filepath.Join(lightningDir, rpcfile), retry, up, failed)
+
+	select {
+	case l.isUp = <-up:
+		return nil
+	case err := <-failed:
+		// we'll be up once a reconnect succeeds
+		l.isUp = true
+		return err
+	}
+}
+
+func (l *Lightning) keepConnected(socket string, retry time.Duration, up chan bool, failed chan error) {
+	for {
+		select {
+		case <-l.done:
+			return
+		default:
+		}
+		err := l.client.SocketStart(socket, up)
+		if err != nil && failed != nil {
+			failed <- err
+		}
+		// only the first attempt gets reported
+		failed = nil
+		up = make(chan bool, 1)
+
+		select {
+		case <-l.done:
+			return
+		case <-time.After(retry):
+		}
+		if err == nil {
+			log.Printf("Lost connection to lightningd, reconnecting to %s", socket)
+		}
+	}
+}
+
 func (l *Lightning) Shutdown() {
+	if l.done != nil {
+		l.doneOnce.Do(func() { close(l.done) })
+		// so a reconnect that's underway can't bring it back up
+		l.client.Close()
+		return
+	}
 	l.client.Shutdown()
 }
 
@@ -196,6 +257,293 @@ func (l *Lightning) getPeers(peerId string, level LogLevel) ([]*Peer, error) {
 	return result.Peers, err
 }
 
+type ListPeerChannelsRequest struct {
+	PeerId         string `json:"id,omitempty"`
+	ShortChannelId string `json:"short_channel_id,omitempty"`
+}
+
+func (r *ListPeerChannelsRequest) Name() string {
+	return "listpeerchannels"
+}
+
+// Which end of a channel opened, or closed, it
+type ChannelSide string
+
+const (
+	ChannelSideLocal  ChannelSide = "local"
+	ChannelSideRemote ChannelSide = "remote"
+)
+
+// Why a channel changed state or, in listclosedchannels, closed
+type ChannelChangeCause string
+
+const (
+	CauseUnknown  ChannelChangeCause = "unknown"
+	CauseLocal    ChannelChangeCause = "local"
+	CauseUser     ChannelChangeCause = "user"
+	CauseRemote   ChannelChangeCause = "remote"
+	CauseProtocol ChannelChangeCause = "protocol"
+	CauseOnchain  ChannelChangeCause = "onchain"
+)
+
+type HtlcDirection string
+
+const (
+	HtlcIn  HtlcDirection = "in"
+	HtlcOut HtlcDirection = "out"
+)
+
+// Where an htlc has got to in the commitment dance. SENT_ states are
+// for htlcs we offered, RCVD_ ones for htlcs offered to us
+type HtlcState string
+
+const (
+	HtlcSentAddHtlc             HtlcState = "SENT_ADD_HTLC"
+	HtlcSentAddCommit           HtlcState = "SENT_ADD_COMMIT"
+	HtlcRcvdAddRevocation       HtlcState = "RCVD_ADD_REVOCATION"
+	HtlcRcvdAddAckCommit        HtlcState = "RCVD_ADD_ACK_COMMIT"
+	HtlcSentAddAckRevocation    HtlcState = "SENT_ADD_ACK_REVOCATION"
+	HtlcRcvdRemoveHtlc          HtlcState = "RCVD_REMOVE_HTLC"
+	HtlcRcvdRemoveCommit        HtlcState = "RCVD_REMOVE_COMMIT"
+	HtlcSentRemoveRevocation    HtlcState = "SENT_REMOVE_REVOCATION"
+	HtlcSentRemoveAckCommit     HtlcState = "SENT_REMOVE_ACK_COMMIT"
+	HtlcRcvdRemoveAckRevocation HtlcState = "RCVD_REMOVE_ACK_REVOCATION"
+	HtlcRcvdAddHtlc             HtlcState = "RCVD_ADD_HTLC"
+	HtlcRcvdAddCommit           HtlcState = "RCVD_ADD_COMMIT"
+	HtlcSentAddRevocation       HtlcState = "SENT_ADD_REVOCATION"
+	HtlcSentAddAckCommit        HtlcState = "SENT_ADD_ACK_COMMIT"
+	HtlcRcvdAddAckRevocation    HtlcState = "RCVD_ADD_ACK_REVOCATION"
+	HtlcSentRemoveHtlc          HtlcState = "SENT_REMOVE_HTLC"
+	HtlcSentRemoveCommit        HtlcState = "SENT_REMOVE_COMMIT"
+	HtlcRcvdRemoveRevocation    HtlcState = "RCVD_REMOVE_REVOCATION"
+	HtlcRcvdRemoveAckCommit     HtlcState = "RCVD_REMOVE_ACK_COMMIT"
+	HtlcSentRemoveAckRevocation HtlcState = "SENT_REMOVE_ACK_REVOCATION"
+)
+
+type ChannelAlias struct {
+	Local  string `json:"local,omitempty"`
+	Remote string `json:"remote,omitempty"`
+}
+
+type ChannelFeerate struct {
+	PerKw uint64 `json:"perkw"`
+	PerKb uint64 `json:"perkb"`
+}
+
+type ChannelFunding struct {
+	LocalFundsMsat  uint64 `json:"local_funds_msat"`
+	RemoteFundsMsat uint64 `json:"remote_funds_msat"`
+	PushedMsat      uint64 `json:"pushed_msat,omitempty"`
+	FeePaidMsat     uint64 `json:"fee_paid_msat,omitempty"`
+	FeeRcvdMsat     uint64 `json:"fee_rcvd_msat,omitempty"`
+}
+
+// A funding (or splice) transaction that's yet to confirm
+type ChannelInflight struct {
+	FundingTxId      string `json:"funding_txid"`
+	FundingOutnum    uint32 `json:"funding_outnum"`
+	Feerate          string `json:"feerate"`
+	TotalFundingMsat uint64 `json:"total_funding_msat"`
+	OurFundingMsat   uint64 `json:"our_funding_msat"`
+	SpliceAmount     int64  `json:"splice_amount,omitempty"`
+	ScratchTxId      string `json:"scratch_txid,omitempty"`
+}
+
+type ChannelStateChange struct {
+	Timestamp string             `json:"timestamp"`
+	OldState  string             `json:"old_state"`
+	NewState  string             `json:"new_state"`
+	Cause     ChannelChangeCause `json:"cause"`
+	Message   string             `json:"message"`
+}
+
+// The fees and htlc limits each side last sent in a channel_update
+type ChannelUpdates struct {
+	Local  *ChannelUpdatePolicy `json:"local,omitempty"`
+	Remote *ChannelUpdatePolicy `json:"remote,omitempty"`
+}
+
+type ChannelUpdatePolicy struct {
+	HtlcMinimumMsat           uint64 `json:"htlc_minimum_msat"`
+	HtlcMaximumMsat           uint64 `json:"htlc_maximum_msat"`
+	CltvExpiryDelta           uint32 `json:"cltv_expiry_delta"`
+	FeeBaseMsat               uint64 `json:"fee_base_msat"`
+	FeeProportionalMillionths uint32 `json:"fee_proportional_millionths"`
+}
+
+type PeerChannelHtlc struct {
+	Direction    HtlcDirection `json:"direction"`
+	Id           uint64        `json:"id"`
+	AmountMsat   uint64        `json:"amount_msat"`
+	Expiry       uint32        `json:"expiry"`
+	PaymentHash  string        `json:"payment_hash"`
+	LocalTrimmed bool          `json:"local_trimmed,omitempty"`
+	Status       string        `json:"status,omitempty"`
+	State        HtlcState     `json:"state"`
+}
+
+// A channel, as listpeerchannels shows it. Amounts are in msat.
+type PeerChannelInfo struct {
+	PeerId                    string                `json:"peer_id"`
+	PeerConnected             bool                  `json:"peer_connected"`
+	State                     string                `json:"state"`
+	ScratchTxId               string                `json:"scratch_txid,omitempty"`
+	ChannelType               *ChannelType          `json:"channel_type,omitempty"`
+	Updates                   *ChannelUpdates       `json:"updates,omitempty"`
+	Feerate                   *ChannelFeerate       `json:"feerate,omitempty"`
+	Owner                     string                `json:"owner,omitempty"`
+	ShortChannelId            string                `json:"short_channel_id,omitempty"`
+	Direction                 int                   `json:"direction,omitempty"`
+	ChannelId                 string                `json:"channel_id,omitempty"`
+	FundingTxId               string                `json:"funding_txid,omitempty"`
+	FundingOutnum             uint32                `json:"funding_outnum,omitempty"`
+	InitialFeerate            string                `json:"initial_feerate,omitempty"`
+	LastFeerate               string                `json:"last_feerate,omitempty"`
+	NextFeerate               string                `json:"next_feerate,omitempty"`
+	NextFeeStep               uint32                `json:"next_fee_step,omitempty"`
+	Inflight                  []*ChannelInflight    `json:"inflight,omitempty"`
+	CloseTo                   string                `json:"close_to,omitempty"`
+	CloseToAddress            string                `json:"close_to_addr,omitempty"`
+	Private                   bool                  `json:"private"`
+	Opener                    ChannelSide           `json:"opener"`
+	Closer                    ChannelSide           `json:"closer,omitempty"`
+	Features                  []string              `json:"features"`
+	Funding                   *ChannelFunding       `json:"funding,omitempty"`
+	ToUsMsat                  uint64                `json:"to_us_msat"`
+	MinToUsMsat               uint64                `json:"min_to_us_msat"`
+	MaxToUsMsat               uint64                `json:"max_to_us_msat"`
+	TotalMsat                 uint64                `json:"total_msat"`
+	FeeBaseMsat               uint64                `json:"fee_base_msat"`
+	FeeProportionalMillionths uint32                `json:"fee_proportional_millionths"`
+	DustLimitMsat             uint64                `json:"dust_limit_msat"`
+	MaxTotalHtlcInMsat        uint64                `json:"max_total_htlc_in_msat"`
+	TheirReserveMsat          uint64                `json:"their_reserve_msat"`
+	OurReserveMsat            uint64                `json:"our_reserve_msat"`
+	SpendableMsat             uint64                `json:"spendable_msat"`
+	ReceivableMsat            uint64                `json:"receivable_msat"`
+	MinimumHtlcInMsat         uint64                `json:"minimum_htlc_in_msat"`
+	MinimumHtlcOutMsat        uint64                `json:"minimum_htlc_out_msat"`
+	MaximumHtlcOutMsat        uint64                `json:"maximum_htlc_out_msat"`
+	TheirToSelfDelay          uint32                `json:"their_to_self_delay"`
+	OurToSelfDelay            uint32                `json:"our_to_self_delay"`
+	MaxAcceptedHtlcs          uint32                `json:"max_accepted_htlcs"`
+	Alias                     *ChannelAlias         `json:"alias,omitempty"`
+	StateChanges              []*ChannelStateChange `json:"state_changes,omitempty"`
+	Status                    []string              `json:"status,omitempty"`
+	InPaymentsOffered         uint64                `json:"in_payments_offered"`
+	InOfferedMsat             uint64                `json:"in_offered_msat"`
+	InPaymentsFulfilled       uint64                `json:"in_payments_fulfilled"`
+	InFulfilledMsat           uint64                `json:"in_fulfilled_msat"`
+	OutPaymentsOffered        uint64                `json:"out_payments_offered"`
+	OutOfferedMsat            uint64                `json:"out_offered_msat"`
+	OutPaymentsFulfilled      uint64                `json:"out_payments_fulfilled"`
+	OutFulfilledMsat          uint64                `json:"out_fulfilled_msat"`
+	LastStableConnection      uint64                `json:"last_stable_connection,omitempty"`
+	LastTxFeeMsat             uint64                `json:"last_tx_fee_msat,omitempty"`
+	LostState                 bool                  `json:"lost_state,omitempty"`
+	Reestablished             bool                  `json:"reestablished,omitempty"`
+	Htlcs                     []*PeerChannelHtlc    `json:"htlcs"`
+}
+
+// Show all our channels, with every peer. Use this rather
+// than Peer.Channels, which newer lightningd leaves out of listpeers
+func (l *Lightning) ListPeerChannels() ([]*PeerChannelInfo, error) {
+	return l.ListPeerChannelsWithRequest(&ListPeerChannelsRequest{})
+}
+
+// Show our channels with peer {peerId}
+func (l *Lightning) GetPeerChannels(peerId string) ([]*PeerChannelInfo, error) {
+	if peerId == "" {
+		return nil, fmt.Errorf("Must provide a peer id")
+	}
+	return l.ListPeerChannelsWithRequest(&ListPeerChannelsRequest{PeerId: peerId})
+}
+
+func (l *Lightning) ListPeerChannelsWithRequest(req *ListPeerChannelsRequest) ([]*PeerChannelInfo, error) {
+	var result struct {
+		Channels []*PeerChannelInfo `json:"channels"`
+	}
+	err := l.client.Request(req, &result)
+	return result.Channels, err
+}
+
+type ListClosedChannelsRequest struct {
+	PeerId string `json:"id,omitempty"`
+}
+
+func (r *ListClosedChannelsRequest) Name() string {
+	return "listclosedchannels"
+}
+
+// A channel that's closed, and been forgotten by listpeerchannels.
+// Amounts are in msat.
+type ClosedChannel struct {
+	PeerId                 string             `json:"peer_id,omitempty"`
+	ChannelId              string             `json:"channel_id"`
+	ShortChannelId         string             `json:"short_channel_id,omitempty"`
+	Alias                  *ChannelAlias      `json:"alias,omitempty"`
+	Opener                 ChannelSide        `json:"opener"`
+	Closer                 ChannelSide        `json:"closer,omitempty"`
+	Private                bool               `json:"private"`
+	ChannelType            *ChannelType       `json:"channel_type,omitempty"`
+	TotalLocalCommitments  uint64             `json:"total_local_commitments"`
+	TotalRemoteCommitments uint64             `json:"total_remote_commitments"`
+	TotalHtlcsSent         uint64             `json:"total_htlcs_sent"`
+	FundingTxId            string             `json:"funding_txid"`
+	FundingOutnum          uint32             `json:"funding_outnum"`
+	Leased                 bool               `json:"leased"`
+	FundingFeePaidMsat     uint64             `json:"funding_fee_paid_msat,omitempty"`
+	FundingFeeRcvdMsat     uint64             `json:"funding_fee_rcvd_msat,omitempty"`
+	FundingPushedMsat      uint64             `json:"funding_pushed_msat,omitempty"`
+	TotalMsat              uint64             `json:"total_msat"`
+	FinalToUsMsat          uint64             `json:"final_to_us_msat"`
+	MinToUsMsat            uint64             `json:"min_to_us_msat"`
+	MaxToUsMsat            uint64             `json:"max_to_us_msat"`
+	LastCommitmentTxId     string             `json:"last_commitment_txid,omitempty"`
+	LastCommitmentFeeMsat  uint64             `json:"last_commitment_fee_msat,omitempty"`
+	CloseCause             ChannelChangeCause `json:"close_cause"`
+	LastStableConnection   uint64             `json:"last_stable_connection,omitempty"`
+}
+
+// Show the channels we've had that are now closed. If {peerId}
+// is set, only those with that peer
+func (l *Lightning) ListClosedChannels(peerId string) ([]*ClosedChannel, error) {
+	var result struct {
+		ClosedChannels []*ClosedChannel `json:"closedchannels"`
+	}
+	err := l.client.Request(&ListClosedChannelsRequest{peerId}, &result)
+	return result.ClosedChannels, err
+}
+
+type ListHtlcsRequest struct {
+	Id string `json:"id,omitempty"`
+}
+
+func (r *ListHtlcsRequest) Name() string {
+	return "listhtlcs"
+}
+
+type ChannelHtlc struct {
+	ShortChannelId string        `json:"short_channel_id"`
+	Id             uint64        `json:"id"`
+	Expiry         uint32        `json:"expiry"`
+	AmountMsat     uint64        `json:"amount_msat"`
+	Direction      HtlcDirection `json:"direction"`
+	PaymentHash    string        `json:"payment_hash"`
+	State          HtlcState     `json:"state"`
+}
+
+// Show all the htlcs we know of, including those in closed
+// channels. If {channelId} is set, either a channel id or short
+// channel id, only those in that channel
+func (l *Lightning) ListHtlcs(channelId string) ([]*ChannelHtlc, error) {
+	var result struct {
+		Htlcs []*ChannelHtlc `json:"htlcs"`
+	}
+	err := l.client.Request(&ListHtlcsRequest{channelId}, &result)
+	return result.Htlcs, err
+}
+
 type ListNodeRequest struct {
 	NodeId string `json:"id,omitempty"`
 }
@@ -471,21 +819,25 @@ func (ir InvoiceRequest) Name() string {
 }
 
 type Invoice struct {
-	Label                   string `json:"label"`
-	Bolt11                  string `json:"bolt11"`
-	PaymentHash             string `json:"payment_hash"`
-	AmountMilliSatoshi      string `json:"amount_msat,omitempty"`
-	AmountMilliSatoshiRaw   uint64 `json:"msatoshi,omitempty"`
-	Status                  string `json:"status"`
-	PayIndex                uint64 `json:"pay_index,omitempty"`
-	MilliSatoshiReceivedRaw uint64 `json:"msatoshi_received,omitempty"`
-	MilliSatoshiReceived    string `json:"amount_received_msat,omitempty"`
-	PaidAt                  uint64 `json:"paid_at,omitempty"`
-	PaymentPreImage         string `json:"payment_preimage,omitempty"`
-	WarningOffline          string `json:"warning_offline,omitempty"`
-	WarningCapacity         string `json:"warning_capacity,omitempty"`
-	Description             string `json:"description"`
-	ExpiresAt               uint64 `json:"expires_at"`
+	Label                   string        `json:"label"`
+	Bolt11                  string        `json:"bolt11"`
+	PaymentHash             string        `json:"payment_hash"`
+	AmountMilliSatoshi      string        `json:"amount_msat,omitempty"`
+	AmountMilliSatoshiRaw   uint64        `json:"msatoshi,omitempty"`
+	Status                  InvoiceStatus `json:"status"`
+	PayIndex                uint64        `json:"pay_index,omitempty"`
+	MilliSatoshiReceivedRaw uint64        `json:"msatoshi_received,omitempty"`
+	MilliSatoshiReceived    string        `json:"amount_received_msat,omitempty"`
+	PaidAt                  uint64        `json:"paid_at,omitempty"`
+	PaymentPreImage         string        `json:"payment_preimage,omitempty"`
+	WarningOffline          string        `json:"warning_offline,omitempty"`
+	WarningCapacity         string        `json:"warning_capacity,omitempty"`
+	Description             string        `json:"description"`
+	ExpiresAt               uint64        `json:"expires_at"`
+	Bolt12                  string        `json:"bolt12,omitempty"`
+	LocalOfferId            string        `json:"local_offer_id,omitempty"`
+	CreatedIndex            uint64        `json:"created_index,omitempty"`
+	UpdatedIndex            uint64        `json:"updated_index,omitempty"`
 }
 
 // Creates an invoice with a value of "any", that can be paid with any amount
@@ -577,9 +929,23 @@ func createInvoice(l *Lightning, msat, label, description string, expirySeconds
 }
 
 type ListInvoiceRequest struct {
-	Label string `json:"label,omitempty"`
+	Label       string    `json:"label,omitempty"`
+	InvString   string    `json:"invstring,omitempty"`
+	PaymentHash string    `json:"payment_hash,omitempty"`
+	OfferId     string    `json:"offer_id,omitempty"`
+	Index       ListIndex `json:"index,omitempty"`
+	Start       uint64    `json:"start,omitempty"`
+	Limit       uint32    `json:"limit,omitempty"`
 }
 
+type InvoiceStatus string
+
+const (
+	InvoiceUnpaid  InvoiceStatus = "unpaid"
+	InvoicePaid    InvoiceStatus = "paid"
+	InvoiceExpired InvoiceStatus = "expired"
+)
+
 func (r ListInvoiceRequest) Name() string {
 	return "listinvoices"
 }
@@ -605,7 +971,52 @@ func (l *Lightning) getInvoices(label string) ([]*Invoice, error) {
 	var result struct {
 		List []*Invoice `json:"invoices"`
 	}
-	err := l.client.Request(&ListInvoiceRequest{label}, &result)
+	err := l.client.Request(&ListInvoiceRequest{Label: label}, &result)
+	return result.List, err
+}
+
+// List the invoices matching all of the request's filters. Set
+// at most one of Label, InvString, PaymentHash and OfferId
+func (l *Lightning) ListInvoicesWithRequest(req *ListInvoiceRequest) ([]*Invoice, error) {
+	var result struct {
+		List []*Invoice `json:"invoices"`
+	}
+	err := l.client.Request(req, &result)
+	return result.List, err
+}
+
+// The invoice for {paymentHash}, or nil if there isn't one
+func (l *Lightning) GetInvoiceByHash(paymentHash string) (*Invoice, error) {
+	if paymentHash == "" {
+		return nil, fmt.Errorf("Must provide a payment hash")
+	}
+	list, err := l.ListInvoicesWithRequest(&ListInvoiceRequest{PaymentHash: paymentHash})
+	if err != nil || len(list) == 0 {
+		return nil, err
+	}
+	return list[0], nil
+}
+
+// The invoices issued for bolt12 offer {offerId}
+func (l *Lightning) ListInvoicesForOffer(offerId string) ([]*Invoice, error) {
+	if offerId == "" {
+		return nil, fmt.Errorf("Must provide an offer_id")
+	}
+	return l.ListInvoicesWithRequest(&ListInvoiceRequest{OfferId: offerId})
+}
+
+// List up to {limit} invoices, starting from {start} of {index},
+// ie their created_index or updated_index. See IterateInvoices
+// for going through all of them a page at a time.
+func (l *Lightning) ListInvoicesPaged(index ListIndex, start uint64, limit uint32) ([]*Invoice, error) {
+	var result struct {
+		List []*Invoice `json:"invoices"`
+	}
+	err := l.client.Request(&ListInvoiceRequest{
+		Index: index,
+		Start: start,
+		Limit: limit,
+	}, &result)
 	return result.List, err
 }
 
@@ -786,6 +1197,370 @@ func (l *Lightning) DecodePay(bolt11, desc string) (*DecodedBolt11, error) {
 	return &result, err
 }
 
+type OfferRequest struct {
+	Amount              string  `json:"amount"`
+	Description         string  `json:"description,omitempty"`
+	Issuer              string  `json:"issuer,omitempty"`
+	Label               string  `json:"label,omitempty"`
+	QuantityMax         *uint64 `json:"quantity_max,omitempty"`
+	AbsoluteExpiry      uint64  `json:"absolute_expiry,omitempty"`
+	Recurrence          string  `json:"recurrence,omitempty"`
+	RecurrenceBase      string  `json:"recurrence_base,omitempty"`
+	RecurrencePaywindow string  `json:"recurrence_paywindow,omitempty"`
+	RecurrenceLimit     *uint32 `json:"recurrence_limit,omitempty"`
+	SingleUse           bool    `json:"single_use,omitempty"`
+}
+
+func (r *OfferRequest) Name() string {
+	return "offer"
+}
+
+// An offer for {amount}, or for any amount if it's nil. Offers
+// can be paid many times, unless SingleUse is set.
+//
+// Recurrence is a period like "1month" or "2weeks"; see
+// lightning-offer(7) for the recurrence options.
+func NewOfferRequest(amount *MSat, description string) *OfferRequest {
+	req := &OfferRequest{
+		Amount:      "any",
+		Description: description,
+	}
+	if amount != nil {
+		req.Amount = amount.String()
+	}
+	return req
+}
+
+type Offer struct {
+	OfferId   string `json:"offer_id"`
+	Active    bool   `json:"active"`
+	SingleUse bool   `json:"single_use"`
+	Bolt12    string `json:"bolt12"`
+	Used      bool   `json:"used"`
+	Label     string `json:"label,omitempty"`
+	// Only set by CreateOffer: false if the same offer already existed
+	Created bool `json:"created,omitempty"`
+}
+
+// Create a bolt12 offer. If an identical offer already exists,
+// it's returned instead, with Created false.
+func (l *Lightning) CreateOffer(req *OfferRequest) (*Offer, error) {
+	if req.Amount == "" {
+		return nil, fmt.Errorf("Must set offer amount, or 'any'")
+	}
+	var result Offer
+	err := l.client.Request(req, &result)
+	return &result, err
+}
+
+type ListOffersRequest struct {
+	OfferId    string `json:"offer_id,omitempty"`
+	ActiveOnly bool   `json:"active_only,omitempty"`
+}
+
+func (r *ListOffersRequest) Name() string {
+	return "listoffers"
+}
+
+func (l *Lightning) ListOffers(activeOnly bool) ([]*Offer, error) {
+	var result struct {
+		Offers []*Offer `json:"offers"`
+	}
+	err := l.client.Request(&ListOffersRequest{"", activeOnly}, &result)
+	return result.Offers, err
+}
+
+// Returns nil if there's no offer with {offerId}
+func (l *Lightning) GetOffer(offerId string) (*Offer, error) {
+	if offerId == "" {
+		return nil, fmt.Errorf("Must provide an offer_id")
+	}
+	var result struct {
+		Offers []*Offer `json:"offers"`
+	}
+	err := l.client.Request(&ListOffersRequest{offerId, false}, &result)
+	if err != nil || len(result.Offers) == 0 {
+		return nil, err
+	}
+	return result.Offers[0], nil
+}
+
+type DisableOfferRequest struct {
+	OfferId string `json:"offer_id"`
+}
+
+func (r *DisableOfferRequest) Name() string {
+	return "disableoffer"
+}
+
+// Stop accepting payments for offer {offerId}. Invoices already
+// issued for it can still be paid.
+func (l *Lightning) DisableOffer(offerId string) (*Offer, error) {
+	var result Offer
+	err := l.client.Request(&DisableOfferRequest{offerId}, &result)
+	return &result, err
+}
+
+type FetchInvoiceRequest struct {
+	Offer             string  `json:"offer"`
+	AmountMsat        string  `json:"amount_msat,omitempty"`
+	Quantity          *uint64 `json:"quantity,omitempty"`
+	RecurrenceCounter *uint64 `json:"recurrence_counter,omitempty"`
+	RecurrenceStart   *uint64 `json:"recurrence_start,omitempty"`
+	RecurrenceLabel   string  `json:"recurrence_label,omitempty"`
+	Timeout           *uint32 `json:"timeout,omitempty"`
+	PayerNote         string  `json:"payer_note,omitempty"`
+}
+
+func (r *FetchInvoiceRequest) Name() string {
+	return "fetchinvoice"
+}
+
+func NewFetchInvoiceRequest(offer string) *FetchInvoiceRequest {
+	return &FetchInvoiceRequest{
+		Offer: offer,
+	}
+}
+
+type FetchInvoiceResult struct {
+	Invoice    string                `json:"invoice"`
+	Changes    *InvoiceChanges       `json:"changes"`
+	NextPeriod *RecurrenceNextPeriod `json:"next_period,omitempty"`
+}
+
+// How the invoice we got differs from the offer we asked for it from
+type InvoiceChanges struct {
+	DescriptionAppended string `json:"description_appended,omitempty"`
+	Description         string `json:"description,omitempty"`
+	IssuerRemoved       string `json:"issuer_removed,omitempty"`
+	Issuer              string `json:"issuer,omitempty"`
+	AmountMsat          uint64 `json:"amount_msat,omitempty"`
+}
+
+type RecurrenceNextPeriod struct {
+	Counter        uint64 `json:"counter"`
+	StartTime      uint64 `json:"starttime"`
+	EndTime        uint64 `json:"endtime"`
+	PaywindowStart uint64 `json:"paywindow_start"`
+	PaywindowEnd   uint64 `json:"paywindow_end"`
+}
+
+// Ask the issuer of an offer for an invoice we can pay,
+// over onion messages
+func (l *Lightning) FetchInvoice(req *FetchInvoiceRequest) (*FetchInvoiceResult, error) {
+	if req.Offer == "" {
+		return nil, fmt.Errorf("Must provide an offer to fetch an invoice for")
+	}
+	var result FetchInvoiceResult
+	err := l.client.Request(req, &result)
+	return &result, err
+}
+
+type SendInvoiceRequest struct {
+	InvReq     string  `json:"invreq"`
+	Label      string  `json:"label"`
+	AmountMsat string  `json:"amount_msat,omitempty"`
+	Timeout    *uint32 `json:"timeout,omitempty"`
+	Quantity   *uint64 `json:"quantity,omitempty"`
+}
+
+func (r *SendInvoiceRequest) Name() string {
+	return "sendinvoice"
+}
+
+// Send an invoice for the bolt12 invoice request {invreq},
+// labelled {label}
+func NewSendInvoiceRequest(invreq, label string) *SendInvoiceRequest {
+	return &SendInvoiceRequest{
+		InvReq: invreq,
+		Label:  label,
+	}
+}
+
+type Bolt12Invoice struct {
+	Label              string `json:"label"`
+	Description        string `json:"description"`
+	PaymentHash        string `json:"payment_hash"`
+	Status             string `json:"status"`
+	ExpiresAt          uint64 `json:"expires_at"`
+	AmountMsat         uint64 `json:"amount_msat,omitempty"`
+	Bolt12             string `json:"bolt12"`
+	PayIndex           uint64 `json:"pay_index,omitempty"`
+	AmountReceivedMsat uint64 `json:"amount_received_msat,omitempty"`
+	PaidAt             uint64 `json:"paid_at,omitempty"`
+	PaymentPreImage    string `json:"payment_preimage,omitempty"`
+}
+
+// Send an invoice in reply to an invoice request (eg a refund),
+// and wait for it to be paid or for the timeout to expire
+func (l *Lightning) SendInvoice(req *SendInvoiceRequest) (*Bolt12Invoice, error) {
+	if req.InvReq == "" || req.Label == "" {
+		return nil, fmt.Errorf("Must provide an invoice request and a label")
+	}
+	var result Bolt12Invoice
+	err := l.client.Request(req, &result)
+	return &result, err
+}
+
+type InvoiceRequestRequest struct {
+	Amount         string `json:"amount"`
+	Description    string `json:"description"`
+	Issuer         string `json:"issuer,omitempty"`
+	Label          string `json:"label,omitempty"`
+	AbsoluteExpiry uint64 `json:"absolute_expiry,omitempty"`
+	SingleUse      *bool  `json:"single_use,omitempty"`
+}
+
+func (r *InvoiceRequestRequest) Name() string {
+	return "invoicerequest"
+}
+
+// An invoice request offering to pay out {amount}, eg for a
+// withdrawal or refund. Whoever has it can SendInvoice for it.
+func NewInvoiceRequestRequest(amount *MSat, description string) *InvoiceRequestRequest {
+	return &InvoiceRequestRequest{
+		Amount:      amount.String(),
+		Description: description,
+	}
+}
+
+type Bolt12InvoiceRequest struct {
+	InvReqId  string `json:"invreq_id"`
+	Active    bool   `json:"active"`
+	SingleUse bool   `json:"single_use"`
+	Bolt12    string `json:"bolt12"`
+	Used      bool   `json:"used"`
+	Label     string `json:"label,omitempty"`
+}
+
+func (l *Lightning) CreateInvoiceRequest(req *InvoiceRequestRequest) (*Bolt12InvoiceRequest, error) {
+	if req.Amount == "" {
+		return nil, fmt.Errorf("Must set invoice request amount")
+	}
+	var result Bolt12InvoiceRequest
+	err := l.client.Request(req, &result)
+	return &result, err
+}
+
+type ListInvoiceRequestsRequest struct {
+	InvReqId   string `json:"invreq_id,omitempty"`
+	ActiveOnly bool   `json:"active_only,omitempty"`
+}
+
+func (r *ListInvoiceRequestsRequest) Name() string {
+	return "listinvoicerequests"
+}
+
+func (l *Lightning) ListInvoiceRequests(activeOnly bool) ([]*Bolt12InvoiceRequest, error) {
+	var result struct {
+		InvoiceRequests []*Bolt12InvoiceRequest `json:"invoicerequests"`
+	}
+	err := l.client.Request(&ListInvoiceRequestsRequest{"", activeOnly}, &result)
+	return result.InvoiceRequests, err
+}
+
+// Returns nil if there's no invoice request with {invReqId}
+func (l *Lightning) GetInvoiceRequest(invReqId string) (*Bolt12InvoiceRequest, error) {
+	if invReqId == "" {
+		return nil, fmt.Errorf("Must provide an invreq_id")
+	}
+	var result struct {
+		InvoiceRequests []*Bolt12InvoiceRequest `json:"invoicerequests"`
+	}
+	err := l.client.Request(&ListInvoiceRequestsRequest{invReqId, false}, &result)
+	if err != nil || len(result.InvoiceRequests) == 0 {
+		return nil, err
+	}
+	return result.InvoiceRequests[0], nil
+}
+
+type DecodeRequest struct {
+	String string `json:"string"`
+}
+
+func (r *DecodeRequest) Name() string {
+	return "decode"
+}
+
+type DecodeType string
+
+const (
+	Bolt12OfferType      DecodeType = "bolt12 offer"
+	Bolt12InvReqType     DecodeType = "bolt12 invoice_request"
+	Bolt12InvoiceType    DecodeType = "bolt12 invoice"
+	Bolt11InvoiceType    DecodeType = "bolt11 invoice"
+	RuneType             DecodeType = "rune"
+	EmergencyRecoverType DecodeType = "emergency recover"
+)
+
+// The result of `decode`. Only the bolt12 fields are broken out;
+// use DecodePay for the details of a bolt11 invoice.
+type Decoded struct {
+	Type  DecodeType `json:"type"`
+	Valid bool       `json:"valid"`
+
+	OfferId             string           `json:"offer_id,omitempty"`
+	OfferChains         []string         `json:"offer_chains,omitempty"`
+	OfferMetadata       string           `json:"offer_metadata,omitempty"`
+	OfferCurrency       string           `json:"offer_currency,omitempty"`
+	OfferAmount         uint64           `json:"offer_amount,omitempty"`
+	OfferAmountMsat     uint64           `json:"offer_amount_msat,omitempty"`
+	OfferDescription    string           `json:"offer_description,omitempty"`
+	OfferIssuer         string           `json:"offer_issuer,omitempty"`
+	OfferFeatures       string           `json:"offer_features,omitempty"`
+	OfferAbsoluteExpiry uint64           `json:"offer_absolute_expiry,omitempty"`
+	OfferQuantityMax    *uint64          `json:"offer_quantity_max,omitempty"`
+	OfferRecurrence     *OfferRecurrence `json:"offer_recurrence,omitempty"`
+	OfferIssuerId       string           `json:"offer_issuer_id,omitempty"`
+
+	InvReqMetadata          string  `json:"invreq_metadata,omitempty"`
+	InvReqPayerId           string  `json:"invreq_payer_id,omitempty"`
+	InvReqChain             string  `json:"invreq_chain,omitempty"`
+	InvReqAmountMsat        uint64  `json:"invreq_amount_msat,omitempty"`
+	InvReqFeatures          string  `json:"invreq_features,omitempty"`
+	InvReqQuantity          uint64  `json:"invreq_quantity,omitempty"`
+	InvReqPayerNote         string  `json:"invreq_payer_note,omitempty"`
+	InvReqRecurrenceCounter *uint32 `json:"invreq_recurrence_counter,omitempty"`
+	InvReqRecurrenceStart   *uint32 `json:"invreq_recurrence_start,omitempty"`
+
+	InvoiceCreatedAt          uint64 `json:"invoice_created_at,omitempty"`
+	InvoiceRelativeExpiry     uint32 `json:"invoice_relative_expiry,omitempty"`
+	InvoicePaymentHash        string `json:"invoice_payment_hash,omitempty"`
+	InvoiceAmountMsat         uint64 `json:"invoice_amount_msat,omitempty"`
+	InvoiceNodeId             string `json:"invoice_node_id,omitempty"`
+	InvoiceRecurrenceBasetime uint64 `json:"invoice_recurrence_basetime,omitempty"`
+
+	Signature string `json:"signature,omitempty"`
+}
+
+type OfferRecurrence struct {
+	TimeUnit       uint32               `json:"time_unit"`
+	TimeUnitName   string               `json:"time_unit_name,omitempty"`
+	Period         uint32               `json:"period"`
+	BaseTime       uint64               `json:"basetime,omitempty"`
+	StartAnyPeriod bool                 `json:"start_any_period,omitempty"`
+	Limit          *uint32              `json:"limit,omitempty"`
+	Paywindow      *RecurrencePaywindow `json:"paywindow,omitempty"`
+}
+
+type RecurrencePaywindow struct {
+	SecondsBefore      uint32 `json:"seconds_before"`
+	SecondsAfter       uint32 `json:"seconds_after"`
+	ProportionalAmount bool   `json:"proportional_amount,omitempty"`
+}
+
+// Decode a bolt12 offer, invoice request or invoice (or
+// anything else `decode` understands). Check Valid: an
+// invalid string still decodes as far as it can.
+func (l *Lightning) Decode(s string) (*Decoded, error) {
+	if s == "" {
+		return nil, fmt.Errorf("Must provide a string to decode")
+	}
+	var result Decoded
+	err := l.client.Request(&DecodeRequest{s}, &result)
+	return &result, err
+}
+
 type PayStatus struct {
 	Bolt11       string       `json:"bolt11"`
 	MilliSatoshi uint64       `json:"msatoshi"`
@@ -1129,20 +1904,22 @@ func (r SendPayRequest) Name() string {
 }
 
 type SendPayFields struct {
-	Id                    uint64 `json:"id"`
-	PaymentHash           string `json:"payment_hash"`
-	Destination           string `json:"destination,omitempty"`
-	AmountMilliSatoshiRaw uint64 `json:"msatoshi,omitempty"`
-	AmountMilliSatoshi    string `json:"amount_msat"`
-	MilliSatoshiSentRaw   uint64 `json:"msatoshi_sent"`
-	MilliSatoshiSent      string `json:"amount_sent_msat"`
-	CreatedAt             uint64 `json:"created_at"`
-	Status                string `json:"status"`
-	PaymentPreimage       string `json:"payment_preimage,omitempty"`
-	Label                 string `json:"label,omitempty"`
-	Bolt11                string `json:"bolt11,omitempty"`
-	PartId                uint64 `json:"partid,omitempty"`
-	ErrorOnion            string `json:"erroronion,omitempty"`
+	Id                    uint64        `json:"id"`
+	PaymentHash           string        `json:"payment_hash"`
+	Destination           string        `json:"destination,omitempty"`
+	AmountMilliSatoshiRaw uint64        `json:"msatoshi,omitempty"`
+	AmountMilliSatoshi    string        `json:"amount_msat"`
+	MilliSatoshiSentRaw   uint64        `json:"msatoshi_sent"`
+	MilliSatoshiSent      string        `json:"amount_sent_msat"`
+	CreatedAt             uint64        `json:"created_at"`
+	Status                PaymentStatus `json:"status"`
+	PaymentPreimage       string        `json:"payment_preimage,omitempty"`
+	Label                 string        `json:"label,omitempty"`
+	Bolt11                string        `json:"bolt11,omitempty"`
+	PartId                uint64        `json:"partid,omitempty"`
+	ErrorOnion            string        `json:"erroronion,omitempty"`
+	CreatedIndex          uint64        `json:"created_index,omitempty"`
+	UpdatedIndex          uint64        `json:"updated_index,omitempty"`
 }
 
 type SendPayResult struct {
@@ -1353,18 +2130,103 @@ func (l *Lightning) Pay(req *PayRequest) (*PaymentSuccess, error) {
 	return &result, err
 }
 
+type KeysendRequest struct {
+	Destination   string            `json:"destination"`
+	AmountMsat    uint64            `json:"amount_msat"`
+	Label         string            `json:"label,omitempty"`
+	MaxFeePercent float32           `json:"maxfeepercent,omitempty"`
+	RetryFor      uint              `json:"retry_for,omitempty"`
+	MaxDelay      uint              `json:"maxdelay,omitempty"`
+	ExemptFee     string            `json:"exemptfee,omitempty"`
+	MaxFee        string            `json:"maxfee,omitempty"`
+	RouteHints    [][]*RouteHint    `json:"routehints,omitempty"`
+	ExtraTlvs     map[string]string `json:"extratlvs,omitempty"`
+}
+
+func (r *KeysendRequest) Name() string {
+	return "keysend"
+}
+
+// A hop in a route hint, for reaching a destination that
+// only has private channels
+type RouteHint struct {
+	Id                        string `json:"id"`
+	ShortChannelId            string `json:"short_channel_id"`
+	FeeBaseMsat               uint64 `json:"fee_base_msat"`
+	FeeProportionalMillionths uint32 `json:"fee_proportional_millionths"`
+	CltvExpiryDelta           uint16 `json:"cltv_expiry_delta"`
+}
+
+func NewKeysendRequest(destination string, amount *MSat) *KeysendRequest {
+	return &KeysendRequest{
+		Destination: destination,
+		AmountMsat:  amount.Value,
+	}
+}
+
+// Send {value} to the destination as an extra TLV record in the
+// onion. Custom records should use types of 2^16 and over.
+func (r *KeysendRequest) AddTlv(typ uint64, value []byte) {
+	if r.ExtraTlvs == nil {
+		r.ExtraTlvs = make(map[string]string)
+	}
+	r.ExtraTlvs[strconv.FormatUint(typ, 10)] = hex.EncodeToString(value)
+}
+
+type KeysendResult struct {
+	Destination              string  `json:"destination"`
+	PaymentHash              string  `json:"payment_hash"`
+	CreatedAt                float64 `json:"created_at"`
+	Parts                    uint32  `json:"parts"`
+	AmountMsat               uint64  `json:"amount_msat"`
+	AmountSentMsat           uint64  `json:"amount_sent_msat"`
+	PaymentPreimage          string  `json:"payment_preimage"`
+	Status                   string  `json:"status"`
+	WarningPartialCompletion string  `json:"warning_partial_completion,omitempty"`
+}
+
+// Pay the destination without an invoice. A preimage is made up and
+// sent to them in the onion, as TLV type KeysendPreimageType.
+// Like Pay, retries until it succeeds or RetryFor runs out.
+func (l *Lightning) Keysend(req *KeysendRequest) (*KeysendResult, error) {
+	if req.Destination == "" {
+		return nil, fmt.Errorf("Must supply a destination to keysend to")
+	}
+	if req.AmountMsat == 0 {
+		return nil, fmt.Errorf("Must supply an amount to keysend")
+	}
+	if req.MaxFeePercent < 0 || req.MaxFeePercent > 100 {
+		return nil, fmt.Errorf("MaxFeePercent must be a percentage. %f", req.MaxFeePercent)
+	}
+	var result KeysendResult
+	err := l.client.RequestNoTimeout(req, &result)
+	return &result, err
+}
+
 type PaymentFields struct {
-	Bolt11                 string `json:"bolt11"`
-	Status                 string `json:"status"`
-	PaymentPreImage        string `json:"payment_preimage"`
-	AmountSentMilliSatoshi string `json:"amount_sent_msat"`
-	Label                  string `json:"label,omitempty"`
+	Bolt11                 string        `json:"bolt11"`
+	PaymentHash            string        `json:"payment_hash,omitempty"`
+	Status                 PaymentStatus `json:"status"`
+	PaymentPreImage        string        `json:"payment_preimage"`
+	AmountSentMilliSatoshi string        `json:"amount_sent_msat"`
+	Label                  string        `json:"label,omitempty"`
 }
 
 type ListPaysRequest struct {
-	Bolt11 string `json:"bolt11,omitempty"`
+	Bolt11      string        `json:"bolt11,omitempty"`
+	PaymentHash string        `json:"payment_hash,omitempty"`
+	Status      PaymentStatus `json:"status,omitempty"`
 }
 
+// The status of a payment, in listpays, or a payment part, in listsendpays
+type PaymentStatus string
+
+const (
+	PaymentPending  PaymentStatus = "pending"
+	PaymentComplete PaymentStatus = "complete"
+	PaymentFailed   PaymentStatus = "failed"
+)
+
 func (r ListPaysRequest) Name() string {
 	return "listpays"
 }
@@ -1378,16 +2240,34 @@ func (l *Lightning) ListPays() ([]PaymentFields, error) {
 }
 
 func (l *Lightning) ListPaysToBolt11(bolt11 string) ([]PaymentFields, error) {
+	return l.ListPaysWithRequest(&ListPaysRequest{Bolt11: bolt11})
+}
+
+func (l *Lightning) ListPaysByHash(paymentHash string) ([]PaymentFields, error) {
+	return l.ListPaysWithRequest(&ListPaysRequest{PaymentHash: paymentHash})
+}
+
+func (l *Lightning) ListPaysByStatus(status PaymentStatus) ([]PaymentFields, error) {
+	return l.ListPaysWithRequest(&ListPaysRequest{Status: status})
+}
+
+// List the payments matching all of the request's filters. Set
+// at most one of Bolt11 and PaymentHash
+func (l *Lightning) ListPaysWithRequest(req *ListPaysRequest) ([]PaymentFields, error) {
 	var result struct {
-		Payments []PaymentFields `json:"payments"`
+		Payments []PaymentFields `json:"pays"`
 	}
-	err := l.client.Request(&ListPaysRequest{bolt11}, &result)
+	err := l.client.Request(req, &result)
 	return result.Payments, err
 }
 
 type ListSendPaysRequest struct {
-	Bolt11      string `json:"bolt11,omitempty"`
-	PaymentHash string `json:"payment_hash,omitempty"`
+	Bolt11      string        `json:"bolt11,omitempty"`
+	PaymentHash string        `json:"payment_hash,omitempty"`
+	Status      PaymentStatus `json:"status,omitempty"`
+	Index       ListIndex     `json:"index,omitempty"`
+	Start       uint64        `json:"start,omitempty"`
+	Limit       uint32        `json:"limit,omitempty"`
 }
 
 func (r ListSendPaysRequest) Name() string {
@@ -1412,6 +2292,27 @@ func (l *Lightning) ListSendPaysByHash(paymentHash string) ([]SendPayFields, err
 	})
 }
 
+// Show outgoing payment parts with {status}
+func (l *Lightning) ListSendPaysByStatus(status PaymentStatus) ([]SendPayFields, error) {
+	return l.listSendPays(&ListSendPaysRequest{
+		Status: status,
+	})
+}
+
+// List the payment parts matching all of the request's filters
+func (l *Lightning) ListSendPaysWithRequest(req *ListSendPaysRequest) ([]SendPayFields, error) {
+	return l.listSendPays(req)
+}
+
+// List up to {limit} payment parts, starting from {start} of {index}
+func (l *Lightning) ListSendPaysPaged(index ListIndex, start uint64, limit uint32) ([]SendPayFields, error) {
+	return l.listSendPays(&ListSendPaysRequest{
+		Index: index,
+		Start: start,
+		Limit: limit,
+	})
+}
+
 func (l *Lightning) listSendPays(req *ListSendPaysRequest) ([]SendPayFields, error) {
 	var result struct {
 		Payments []SendPayFields `json:"payments"`
@@ -1495,22 +2396,51 @@ func (l *Lightning) Connect(peerId, host string, port uint) (string, error) {
 }
 
 type FundChannelRequest struct {
-	Id       string  `json:"id"`
-	Amount   string  `json:"amount"`
-	FeeRate  string  `json:"feerate,omitempty"`
-	Announce bool    `json:"announce"`
-	MinConf  *uint16 `json:"minconf,omitempty"`
-	PushMsat string  `json:"push_msat,omitempty"`
+	Id           string   `json:"id"`
+	Amount       string   `json:"amount"`
+	FeeRate      string   `json:"feerate,omitempty"`
+	Announce     bool     `json:"announce"`
+	MinConf      *uint16  `json:"minconf,omitempty"`
+	PushMsat     string   `json:"push_msat,omitempty"`
+	CloseTo      string   `json:"close_to,omitempty"`
+	RequestAmt   string   `json:"request_amt,omitempty"`
+	CompactLease string   `json:"compact_lease,omitempty"`
+	Utxos        []string `json:"utxos,omitempty"`
 }
 
 func (r FundChannelRequest) Name() string {
 	return "fundchannel"
 }
 
-type FundChannelResult struct {
-	FundingTx   string `json:"tx"`
-	FundingTxId string `json:"txid"`
-	ChannelId   string `json:"channel_id"`
+// A request to fund a public channel with {id} for {amount}
+// (or AllSats). Set the rest of the fields as needed and pass
+// it to FundChannelWithRequest.
+func NewFundChannelRequest(id string, amount *Sat) *FundChannelRequest {
+	return &FundChannelRequest{
+		Id:       id,
+		Amount:   amount.RawString(),
+		Announce: true,
+	}
+}
+
+// Spend only {utxos} to fund the channel
+func (r *FundChannelRequest) SetUtxos(utxos []*Utxo) {
+	r.Utxos = stringifyUtxos(utxos)
+}
+
+// Ask the peer to contribute {amount} to the channel, per the
+// liquidity ad {compactLease} they've advertised
+func (r *FundChannelRequest) RequestLease(amount *Sat, compactLease string) {
+	r.RequestAmt = amount.RawString()
+	r.CompactLease = compactLease
+}
+
+type FundChannelResult struct {
+	FundingTx   string `json:"tx"`
+	FundingTxId string `json:"txid"`
+	ChannelId   string `json:"channel_id"`
+	OutNum      uint32 `json:"outnum"`
+	CloseTo     string `json:"close_to,omitempty"`
 }
 
 // Fund channel, defaults to public channel and default feerate.
@@ -1540,11 +2470,8 @@ func (l *Lightning) FundChannelExt(id string, amount *Sat, feerate *FeeRate, ann
 		return nil, fmt.Errorf("Must set satoshi amount to send")
 	}
 
-	req := &FundChannelRequest{
-		Id:       id,
-		Amount:   amount.RawString(),
-		Announce: announce,
-	}
+	req := NewFundChannelRequest(id, amount)
+	req.Announce = announce
 	if feerate != nil {
 		req.FeeRate = feerate.String()
 	}
@@ -1553,6 +2480,19 @@ func (l *Lightning) FundChannelExt(id string, amount *Sat, feerate *FeeRate, ann
 	}
 	req.MinConf = minConf
 
+	return l.FundChannelWithRequest(req)
+}
+
+// Fund a channel with all the options of fundchannel, eg spending
+// specific utxos or leasing liquidity from the peer
+func (l *Lightning) FundChannelWithRequest(req *FundChannelRequest) (*FundChannelResult, error) {
+	if req.Id == "" {
+		return nil, fmt.Errorf("Must set peer id to fund a channel with")
+	}
+	if req.Amount == "" || req.Amount == "0" {
+		return nil, fmt.Errorf("Must set satoshi amount to send")
+	}
+
 	var result FundChannelResult
 	err := l.client.Request(req, &result)
 	return &result, err
@@ -1630,6 +2570,234 @@ func (l *Lightning) CancelFundChannel(peerId string) (bool, error) {
 	return err == nil, err
 }
 
+// One of the channels to open in a multifundchannel
+type FundDestination struct {
+	Id           string  `json:"id"`
+	Amount       string  `json:"amount"`
+	Announce     bool    `json:"announce"`
+	PushMsat     string  `json:"push_msat,omitempty"`
+	CloseTo      string  `json:"close_to,omitempty"`
+	RequestAmt   string  `json:"request_amt,omitempty"`
+	CompactLease string  `json:"compact_lease,omitempty"`
+	MinDepth     *uint32 `json:"mindepth,omitempty"`
+	Reserve      string  `json:"reserve,omitempty"`
+}
+
+// A public channel with {id} (which may be id@host:port) for
+// {amount}. At most one destination can use AllSats.
+func NewFundDestination(id string, amount *Sat) *FundDestination {
+	return &FundDestination{
+		Id:       id,
+		Amount:   amount.RawString(),
+		Announce: true,
+	}
+}
+
+type MultiFundChannelRequest struct {
+	Destinations      []*FundDestination `json:"destinations"`
+	FeeRate           string             `json:"feerate,omitempty"`
+	MinConf           *uint16            `json:"minconf,omitempty"`
+	Utxos             []string           `json:"utxos,omitempty"`
+	MinChannels       uint32             `json:"minchannels,omitempty"`
+	CommitmentFeeRate string             `json:"commitment_feerate,omitempty"`
+}
+
+func (r *MultiFundChannelRequest) Name() string {
+	return "multifundchannel"
+}
+
+func NewMultiFundChannelRequest(destinations []*FundDestination) *MultiFundChannelRequest {
+	return &MultiFundChannelRequest{
+		Destinations: destinations,
+	}
+}
+
+// Spend only {utxos} to fund the channels
+func (r *MultiFundChannelRequest) SetUtxos(utxos []*Utxo) {
+	r.Utxos = stringifyUtxos(utxos)
+}
+
+type MultiFundChannelResult struct {
+	Tx         string              `json:"tx"`
+	TxId       string              `json:"txid"`
+	ChannelIds []*FundedChannel    `json:"channel_ids"`
+	Failed     []*FundChannelError `json:"failed"`
+}
+
+type FundedChannel struct {
+	Id          string       `json:"id"`
+	ChannelId   string       `json:"channel_id"`
+	OutNum      uint32       `json:"outnum"`
+	CloseTo     string       `json:"close_to,omitempty"`
+	ChannelType *ChannelType `json:"channel_type,omitempty"`
+}
+
+// A destination that was dropped from a multifundchannel,
+// and the step ({Method}) it failed at
+type FundChannelError struct {
+	Id     string          `json:"id"`
+	Method string          `json:"method"`
+	Error  *jrpc2.RpcError `json:"error"`
+}
+
+// Open channels to all of the request's destinations in a single
+// funding transaction. If MinChannels is set, destinations that
+// fail are dropped and listed in the result's Failed, as long
+// as at least that many channels can still be opened.
+func (l *Lightning) MultiFundChannel(req *MultiFundChannelRequest) (*MultiFundChannelResult, error) {
+	if len(req.Destinations) == 0 {
+		return nil, fmt.Errorf("Must supply at least one destination")
+	}
+	var result MultiFundChannelResult
+	err := l.client.Request(req, &result)
+	return &result, err
+}
+
+type OpenChannelInitRequest struct {
+	Id                string `json:"id"`
+	Amount            string `json:"amount"`
+	InitialPsbt       string `json:"initialpsbt"`
+	CommitmentFeeRate string `json:"commitment_feerate,omitempty"`
+	FundingFeeRate    string `json:"funding_feerate,omitempty"`
+	Announce          bool   `json:"announce"`
+	CloseTo           string `json:"close_to,omitempty"`
+	RequestAmt        string `json:"request_amt,omitempty"`
+	CompactLease      string `json:"compact_lease,omitempty"`
+	ChannelType       []uint `json:"channel_type,omitempty"`
+}
+
+func (r *OpenChannelInitRequest) Name() string {
+	return "openchannel_init"
+}
+
+// Start a v2 (dual-funded) open of a public channel with {id},
+// putting in {amount} from the inputs of {initialPsbt}
+func NewOpenChannelInitRequest(id string, amount *Sat, initialPsbt string) *OpenChannelInitRequest {
+	return &OpenChannelInitRequest{
+		Id:          id,
+		Amount:      amount.RawString(),
+		InitialPsbt: initialPsbt,
+		Announce:    true,
+	}
+}
+
+// The state of a v2 channel open, as returned by openchannel_init,
+// openchannel_update and openchannel_bump. The open goes back and
+// forth with openchannel_update until CommitmentsSecured.
+type OpenChannelV2Result struct {
+	ChannelId               string       `json:"channel_id"`
+	Psbt                    string       `json:"psbt"`
+	ChannelType             *ChannelType `json:"channel_type,omitempty"`
+	CommitmentsSecured      bool         `json:"commitments_secured"`
+	FundingSerial           uint64       `json:"funding_serial"`
+	FundingOutNum           uint32       `json:"funding_outnum"`
+	CloseTo                 string       `json:"close_to,omitempty"`
+	RequiresConfirmedInputs bool         `json:"requires_confirmed_inputs"`
+}
+
+func (r *OpenChannelV2Result) ParsePsbt() (*Psbt, error) {
+	return DecodePsbt(r.Psbt)
+}
+
+func (l *Lightning) OpenChannelInit(req *OpenChannelInitRequest) (*OpenChannelV2Result, error) {
+	if req.Id == "" {
+		return nil, fmt.Errorf("Must set peer id to open a channel with")
+	}
+	var result OpenChannelV2Result
+	err := l.client.Request(req, &result)
+	return &result, err
+}
+
+type OpenChannelUpdateRequest struct {
+	ChannelId string `json:"channel_id"`
+	Psbt      string `json:"psbt"`
+}
+
+func (r *OpenChannelUpdateRequest) Name() string {
+	return "openchannel_update"
+}
+
+// Send our updated {psbt} to the peer, and get back theirs
+func (l *Lightning) OpenChannelUpdate(channelId, psbt string) (*OpenChannelV2Result, error) {
+	var result OpenChannelV2Result
+	err := l.client.Request(&OpenChannelUpdateRequest{channelId, psbt}, &result)
+	return &result, err
+}
+
+type OpenChannelSignedRequest struct {
+	ChannelId  string `json:"channel_id"`
+	SignedPsbt string `json:"signed_psbt"`
+}
+
+func (r *OpenChannelSignedRequest) Name() string {
+	return "openchannel_signed"
+}
+
+type OpenChannelSignedResult struct {
+	ChannelId string `json:"channel_id"`
+	Tx        string `json:"tx"`
+	TxId      string `json:"txid"`
+}
+
+// Send the peer our signatures for the funding tx. Once they've
+// sent theirs, lightningd broadcasts it.
+func (l *Lightning) OpenChannelSigned(channelId, signedPsbt string) (*OpenChannelSignedResult, error) {
+	var result OpenChannelSignedResult
+	err := l.client.Request(&OpenChannelSignedRequest{channelId, signedPsbt}, &result)
+	return &result, err
+}
+
+type OpenChannelAbortRequest struct {
+	ChannelId string `json:"channel_id"`
+}
+
+func (r *OpenChannelAbortRequest) Name() string {
+	return "openchannel_abort"
+}
+
+type OpenChannelAbortResult struct {
+	ChannelId       string `json:"channel_id"`
+	ChannelCanceled bool   `json:"channel_canceled"`
+	Reason          string `json:"reason"`
+}
+
+// Abort a v2 open (or bump) that hasn't been signed yet
+func (l *Lightning) OpenChannelAbort(channelId string) (*OpenChannelAbortResult, error) {
+	var result OpenChannelAbortResult
+	err := l.client.Request(&OpenChannelAbortRequest{channelId}, &result)
+	return &result, err
+}
+
+type OpenChannelBumpRequest struct {
+	ChannelId      string `json:"channel_id"`
+	Amount         string `json:"amount"`
+	InitialPsbt    string `json:"initialpsbt"`
+	FundingFeeRate string `json:"funding_feerate,omitempty"`
+}
+
+func (r *OpenChannelBumpRequest) Name() string {
+	return "openchannel_bump"
+}
+
+// RBF the funding tx of v2 channel {channelId}, putting in {amount}
+// from {initialPsbt}. Carry on with OpenChannelUpdate as for an open.
+func (l *Lightning) OpenChannelBump(channelId string, amount *Sat, initialPsbt string, fundingFeeRate *FeeRate) (*OpenChannelV2Result, error) {
+	if amount == nil || amount.Value == 0 {
+		return nil, fmt.Errorf("Must set satoshi amount to bump with")
+	}
+	req := &OpenChannelBumpRequest{
+		ChannelId:   channelId,
+		Amount:      amount.RawString(),
+		InitialPsbt: initialPsbt,
+	}
+	if fundingFeeRate != nil {
+		req.FundingFeeRate = fundingFeeRate.String()
+	}
+	var result OpenChannelV2Result
+	err := l.client.Request(req, &result)
+	return &result, err
+}
+
 type CloseRequest struct {
 	PeerId             string `json:"id"`
 	Timeout            uint   `json:"unilateraltimeout,omitempty"`
@@ -2076,6 +3244,241 @@ func (l *Lightning) SendTx(txid string) (*TxResult, error) {
 	return &result, err
 }
 
+// An input reserved (or unreserved) by one of the psbt calls
+type Reservation struct {
+	TxId            string `json:"txid"`
+	Vout            uint32 `json:"vout"`
+	WasReserved     bool   `json:"was_reserved"`
+	Reserved        bool   `json:"reserved"`
+	ReservedToBlock uint32 `json:"reserved_to_block"`
+}
+
+type FundPsbtRequest struct {
+	Satoshi              string  `json:"satoshi"`
+	FeeRate              string  `json:"feerate"`
+	StartWeight          uint32  `json:"startweight"`
+	MinConf              *uint16 `json:"minconf,omitempty"`
+	Reserve              *uint32 `json:"reserve,omitempty"`
+	Locktime             *uint32 `json:"locktime,omitempty"`
+	MinWitnessWeight     uint32  `json:"min_witness_weight,omitempty"`
+	ExcessAsChange       bool    `json:"excess_as_change,omitempty"`
+	NonWrapped           bool    `json:"nonwrapped,omitempty"`
+	OpeningAnchorChannel bool    `json:"opening_anchor_channel,omitempty"`
+}
+
+func (r *FundPsbtRequest) Name() string {
+	return "fundpsbt"
+}
+
+// A fundpsbt request for {amount} (or AllSats), at {feerate}.
+// {startWeight} is the weight of the transaction before any
+// inputs are added, eg the outputs you're going to add.
+func NewFundPsbtRequest(amount *Sat, feerate *FeeRate, startWeight uint32) *FundPsbtRequest {
+	return &FundPsbtRequest{
+		Satoshi:     amount.RawString(),
+		FeeRate:     feerate.String(),
+		StartWeight: startWeight,
+	}
+}
+
+type FundPsbtResult struct {
+	Psbt                 string         `json:"psbt"`
+	FeeRatePerKw         uint32         `json:"feerate_per_kw"`
+	EstimatedFinalWeight uint32         `json:"estimated_final_weight"`
+	ExcessMsat           uint64         `json:"excess_msat"`
+	ChangeOutNum         *uint32        `json:"change_outnum,omitempty"`
+	Reservations         []*Reservation `json:"reservations"`
+}
+
+func (r *FundPsbtResult) ParsePsbt() (*Psbt, error) {
+	return DecodePsbt(r.Psbt)
+}
+
+// Select inputs from the wallet to fund a psbt. Unless the request's
+// Reserve is set to zero, they're reserved for 72 blocks.
+func (l *Lightning) FundPsbt(req *FundPsbtRequest) (*FundPsbtResult, error) {
+	if req.Satoshi == "" {
+		return nil, fmt.Errorf("Must set satoshi amount to fund")
+	}
+	var result FundPsbtResult
+	err := l.client.Request(req, &result)
+	return &result, err
+}
+
+type UtxoPsbtRequest struct {
+	Satoshi              string   `json:"satoshi"`
+	FeeRate              string   `json:"feerate"`
+	StartWeight          uint32   `json:"startweight"`
+	Utxos                []string `json:"utxos"`
+	Reserve              *uint32  `json:"reserve,omitempty"`
+	ReservedOk           bool     `json:"reservedok,omitempty"`
+	Locktime             *uint32  `json:"locktime,omitempty"`
+	MinWitnessWeight     uint32   `json:"min_witness_weight,omitempty"`
+	ExcessAsChange       bool     `json:"excess_as_change,omitempty"`
+	OpeningAnchorChannel bool     `json:"opening_anchor_channel,omitempty"`
+}
+
+func (r *UtxoPsbtRequest) Name() string {
+	return "utxopsbt"
+}
+
+// A utxopsbt request, like NewFundPsbtRequest but spending {utxos}
+func NewUtxoPsbtRequest(amount *Sat, feerate *FeeRate, startWeight uint32, utxos []*Utxo) *UtxoPsbtRequest {
+	return &UtxoPsbtRequest{
+		Satoshi:     amount.RawString(),
+		FeeRate:     feerate.String(),
+		StartWeight: startWeight,
+		Utxos:       stringifyUtxos(utxos),
+	}
+}
+
+// Fund a psbt from the given utxos, rather than letting the
+// wallet choose. Has the same result as FundPsbt.
+func (l *Lightning) UtxoPsbt(req *UtxoPsbtRequest) (*FundPsbtResult, error) {
+	if len(req.Utxos) == 0 {
+		return nil, fmt.Errorf("Must supply at least one utxo")
+	}
+	var result FundPsbtResult
+	err := l.client.Request(req, &result)
+	return &result, err
+}
+
+type ReserveInputsRequest struct {
+	Psbt      string  `json:"psbt"`
+	Exclusive bool    `json:"exclusive"`
+	Reserve   *uint32 `json:"reserve,omitempty"`
+}
+
+func (r *ReserveInputsRequest) Name() string {
+	return "reserveinputs"
+}
+
+type ReservationsResult struct {
+	Reservations []*Reservation `json:"reservations"`
+}
+
+// Reserve the wallet inputs of {psbt} for {reserve} blocks (72 if
+// nil). If {exclusive}, fails if any of them are already reserved;
+// otherwise their reservation is extended.
+func (l *Lightning) ReserveInputs(psbt string, exclusive bool, reserve *uint32) ([]*Reservation, error) {
+	var result ReservationsResult
+	err := l.client.Request(&ReserveInputsRequest{psbt, exclusive, reserve}, &result)
+	return result.Reservations, err
+}
+
+type UnreserveInputsRequest struct {
+	Psbt    string  `json:"psbt"`
+	Reserve *uint32 `json:"reserve,omitempty"`
+}
+
+func (r *UnreserveInputsRequest) Name() string {
+	return "unreserveinputs"
+}
+
+// Take {reserve} blocks (72 if nil) off the reservation of the
+// wallet inputs in {psbt}
+func (l *Lightning) UnreserveInputs(psbt string, reserve *uint32) ([]*Reservation, error) {
+	var result ReservationsResult
+	err := l.client.Request(&UnreserveInputsRequest{psbt, reserve}, &result)
+	return result.Reservations, err
+}
+
+type SignPsbtRequest struct {
+	Psbt     string   `json:"psbt"`
+	SignOnly []uint32 `json:"signonly,omitempty"`
+}
+
+func (r *SignPsbtRequest) Name() string {
+	return "signpsbt"
+}
+
+type SignPsbtResult struct {
+	SignedPsbt string `json:"signed_psbt"`
+}
+
+// Sign the wallet's inputs in {psbt}. If {signOnly} is set, only
+// those input numbers are signed. Returns the signed psbt.
+func (l *Lightning) SignPsbt(psbt string, signOnly []uint32) (string, error) {
+	var result SignPsbtResult
+	err := l.client.Request(&SignPsbtRequest{psbt, signOnly}, &result)
+	return result.SignedPsbt, err
+}
+
+type SendPsbtRequest struct {
+	Psbt    string  `json:"psbt"`
+	Reserve *uint32 `json:"reserve,omitempty"`
+}
+
+func (r *SendPsbtRequest) Name() string {
+	return "sendpsbt"
+}
+
+type SendPsbtResult struct {
+	Tx   string `json:"tx"`
+	TxId string `json:"txid"`
+}
+
+// Finalize and broadcast a fully signed {psbt}
+func (l *Lightning) SendPsbt(psbt string, reserve *uint32) (*SendPsbtResult, error) {
+	var result SendPsbtResult
+	err := l.client.Request(&SendPsbtRequest{psbt, reserve}, &result)
+	return &result, err
+}
+
+type AddPsbtOutputRequest struct {
+	Satoshi     string  `json:"satoshi"`
+	InitialPsbt string  `json:"initialpsbt,omitempty"`
+	Locktime    *uint32 `json:"locktime,omitempty"`
+	Destination string  `json:"destination,omitempty"`
+}
+
+func (r *AddPsbtOutputRequest) Name() string {
+	return "addpsbtoutput"
+}
+
+type AddPsbtOutputResult struct {
+	Psbt                 string `json:"psbt"`
+	EstimatedAddedWeight uint32 `json:"estimated_added_weight"`
+	OutNum               uint32 `json:"outnum"`
+}
+
+// Add an output for {amount} to {initialPsbt}, or to a new psbt if
+// it's empty. The output pays {destination}, or a fresh wallet
+// address if that's empty.
+func (l *Lightning) AddPsbtOutput(amount *Sat, initialPsbt, destination string, locktime *uint32) (*AddPsbtOutputResult, error) {
+	if amount == nil || amount.Value == 0 {
+		return nil, fmt.Errorf("Must set satoshi amount for the output")
+	}
+	var result AddPsbtOutputResult
+	err := l.client.Request(&AddPsbtOutputRequest{
+		Satoshi:     amount.RawString(),
+		InitialPsbt: initialPsbt,
+		Locktime:    locktime,
+		Destination: destination,
+	}, &result)
+	return &result, err
+}
+
+type SetPsbtVersionRequest struct {
+	Psbt    string `json:"psbt"`
+	Version uint32 `json:"version"`
+}
+
+func (r *SetPsbtVersionRequest) Name() string {
+	return "setpsbtversion"
+}
+
+type SetPsbtVersionResult struct {
+	Psbt string `json:"psbt"`
+}
+
+// Convert {psbt} to psbt {version} 0 or 2
+func (l *Lightning) SetPsbtVersion(psbt string, version uint32) (string, error) {
+	var result SetPsbtVersionResult
+	err := l.client.Request(&SetPsbtVersionRequest{psbt, version}, &result)
+	return result.Psbt, err
+}
+
 type ListFundsRequest struct{}
 
 func (r *ListFundsRequest) Name() string {
@@ -2117,27 +3520,45 @@ func (l *Lightning) ListFunds() (*FundsResult, error) {
 	return &result, err
 }
 
-type ListForwardsRequest struct{}
+type ListForwardsRequest struct {
+	Status     ForwardStatus `json:"status,omitempty"`
+	InChannel  string        `json:"in_channel,omitempty"`
+	OutChannel string        `json:"out_channel,omitempty"`
+	Index      ListIndex     `json:"index,omitempty"`
+	Start      uint64        `json:"start,omitempty"`
+	Limit      uint32        `json:"limit,omitempty"`
+}
+
+type ForwardStatus string
+
+const (
+	ForwardOffered     ForwardStatus = "offered"
+	ForwardSettled     ForwardStatus = "settled"
+	ForwardFailed      ForwardStatus = "failed"
+	ForwardLocalFailed ForwardStatus = "local_failed"
+)
 
 func (r *ListForwardsRequest) Name() string {
 	return "listforwards"
 }
 
 type Forwarding struct {
-	InChannel       string  `json:"in_channel"`
-	OutChannel      string  `json:"out_channel"`
-	MilliSatoshiIn  uint64  `json:"in_msatoshi"`
-	InMsat          string  `json:"in_msat"`
-	MilliSatoshiOut uint64  `json:"out_msatoshi"`
-	OutMsat         string  `json:"out_msat"`
-	Fee             uint64  `json:"fee"`
-	FeeMsat         string  `json:"fee_msat"`
-	Status          string  `json:"status"`
-	PaymentHash     string  `json:"payment_hash"`
-	FailCode        int     `json:"failcode"`
-	FailReason      string  `json:"failreason"`
-	ReceivedTime    float64 `json:"received_time"`
-	ResolvedTime    float64 `json:"resolved_time"`
+	InChannel       string        `json:"in_channel"`
+	OutChannel      string        `json:"out_channel"`
+	MilliSatoshiIn  uint64        `json:"in_msatoshi"`
+	InMsat          string        `json:"in_msat"`
+	MilliSatoshiOut uint64        `json:"out_msatoshi"`
+	OutMsat         string        `json:"out_msat"`
+	Fee             uint64        `json:"fee"`
+	FeeMsat         string        `json:"fee_msat"`
+	Status          ForwardStatus `json:"status"`
+	PaymentHash     string        `json:"payment_hash"`
+	FailCode        int           `json:"failcode"`
+	FailReason      string        `json:"failreason"`
+	ReceivedTime    float64       `json:"received_time"`
+	ResolvedTime    float64       `json:"resolved_time"`
+	CreatedIndex    uint64        `json:"created_index,omitempty"`
+	UpdatedIndex    uint64        `json:"updated_index,omitempty"`
 }
 
 // List all forwarded payments and their information
@@ -2149,6 +3570,115 @@ func (l *Lightning) ListForwards() ([]Forwarding, error) {
 	return result.Forwards, err
 }
 
+// List up to {limit} forwards, starting from {start} of {index}
+func (l *Lightning) ListForwardsPaged(index ListIndex, start uint64, limit uint32) ([]Forwarding, error) {
+	var result struct {
+		Forwards []Forwarding `json:"forwards"`
+	}
+	err := l.client.Request(&ListForwardsRequest{
+		Index: index,
+		Start: start,
+		Limit: limit,
+	}, &result)
+	return result.Forwards, err
+}
+
+// List forwards with {status}, into {inChannel} and out of
+// {outChannel}. Leave any of them empty to not filter on it
+func (l *Lightning) ListForwardsFiltered(status ForwardStatus, inChannel, outChannel string) ([]Forwarding, error) {
+	return l.ListForwardsWithRequest(&ListForwardsRequest{
+		Status:     status,
+		InChannel:  inChannel,
+		OutChannel: outChannel,
+	})
+}
+
+// List the forwards matching all of the request's filters
+func (l *Lightning) ListForwardsWithRequest(req *ListForwardsRequest) ([]Forwarding, error) {
+	var result struct {
+		Forwards []Forwarding `json:"forwards"`
+	}
+	err := l.client.Request(req, &result)
+	return result.Forwards, err
+}
+
+// The list RPCs that can be paged, and waited on
+type WaitSubsystem string
+
+const (
+	WaitInvoices WaitSubsystem = "invoices"
+	WaitForwards WaitSubsystem = "forwards"
+	WaitSendPays WaitSubsystem = "sendpays"
+)
+
+// Invoices, forwards and sendpays each get a created_index when
+// they're added, and a new updated_index every time they change.
+// lightningd also counts deletions, which can only be waited on.
+type ListIndex string
+
+const (
+	IndexCreated ListIndex = "created"
+	IndexUpdated ListIndex = "updated"
+	IndexDeleted ListIndex = "deleted"
+)
+
+type WaitRequest struct {
+	Subsystem WaitSubsystem `json:"subsystem"`
+	IndexName ListIndex     `json:"indexname"`
+	NextValue uint64        `json:"nextvalue"`
+}
+
+func (r *WaitRequest) Name() string {
+	return "wait"
+}
+
+type WaitResult struct {
+	Subsystem WaitSubsystem `json:"subsystem"`
+	Created   *uint64       `json:"created,omitempty"`
+	Updated   *uint64       `json:"updated,omitempty"`
+	Deleted   *uint64       `json:"deleted,omitempty"`
+	// Only the one for the subsystem is set
+	Invoices *WaitDetails `json:"invoices,omitempty"`
+	Forwards *WaitDetails `json:"forwards,omitempty"`
+	SendPays *WaitDetails `json:"sendpays,omitempty"`
+}
+
+// What changed. Which fields are set depends on the subsystem
+type WaitDetails struct {
+	Status      string `json:"status,omitempty"`
+	Label       string `json:"label,omitempty"`
+	Description string `json:"description,omitempty"`
+	Bolt11      string `json:"bolt11,omitempty"`
+	Bolt12      string `json:"bolt12,omitempty"`
+	PaymentHash string `json:"payment_hash,omitempty"`
+	PartId      uint64 `json:"partid,omitempty"`
+	GroupId     uint64 `json:"groupid,omitempty"`
+	InChannel   string `json:"in_channel,omitempty"`
+	InHtlcId    uint64 `json:"in_htlc_id,omitempty"`
+	InMsat      uint64 `json:"in_msat,omitempty"`
+	OutChannel  string `json:"out_channel,omitempty"`
+}
+
+func (r *WaitResult) Details() *WaitDetails {
+	switch r.Subsystem {
+	case WaitInvoices:
+		return r.Invoices
+	case WaitForwards:
+		return r.Forwards
+	case WaitSendPays:
+		return r.SendPays
+	}
+	return nil
+}
+
+// Wait until {index} of {subsystem} reaches {nextValue}, eg for
+// the next invoice to be created. Blocks until it does.
+func (l *Lightning) Wait(subsystem WaitSubsystem, index ListIndex, nextValue uint64) (*WaitResult, error) {
+	var result WaitResult
+	err := l.client.RequestNoTimeout(&WaitRequest{subsystem, index, nextValue}, &result)
+	return &result, err
+}
+
 type DevRescanOutputsRequest struct{}
 
 func (r *DevRescanOutputsRequest) Name() string {
@@ -2211,6 +3741,29 @@ func (l *Lightning) Disconnect(peerId string, force bool) error {
 	return err
 }
 
+type SendCustomMessageRequest struct {
+	PeerId string `json:"node_id"`
+	Msg    string `json:"msg"`
+}
+
+func (r *SendCustomMessageRequest) Name() string {
+	return "sendcustommsg"
+}
+
+type SendCustomMessageResult struct {
+	Status string `json:"status"`
+}
+
+// Send a custom message to the connected peer {peerId}. {msg} is hex,
+// and must start with the 2-byte message type; it should be an odd
+// type that lightningd doesn't handle itself. Replies come in
+// through the `custommsg` hook.
+func (l *Lightning) SendCustomMessage(peerId, msg string) (*SendCustomMessageResult, error) {
+	var result SendCustomMessageResult
+	err := l.client.Request(&SendCustomMessageRequest{peerId, msg}, &result)
+	return &result, err
+}
+
 type FeeRatesRequest struct {
 	Style string `json:"style"`
 }
@@ -2376,6 +3929,362 @@ func (l *Lightning) StopPlugin(pluginName string) (string, error) {
 	return result.Result, err
 }
 
+// How `datastore` treats an existing entry
+type DatastoreMode string
+
+const (
+	DatastoreMustCreate      DatastoreMode = "must-create"
+	DatastoreMustReplace     DatastoreMode = "must-replace"
+	DatastoreCreateOrReplace DatastoreMode = "create-or-replace"
+	DatastoreMustAppend      DatastoreMode = "must-append"
+	DatastoreCreateOrAppend  DatastoreMode = "create-or-append"
+)
+
+// Error codes from the datastore RPCs
+const (
+	ErrDatastoreDelDoesNotExist       = 1200
+	ErrDatastoreDelWrongGeneration    = 1201
+	ErrDatastoreUpdateAlreadyExists   = 1202
+	ErrDatastoreUpdateDoesNotExist    = 1203
+	ErrDatastoreUpdateWrongGeneration = 1204
+	ErrDatastoreUpdateHasChildren     = 1205
+	ErrDatastoreUpdateNoChildren      = 1206
+)
+
+type DatastoreRequest struct {
+	Key        []string      `json:"key"`
+	String     string        `json:"string,omitempty"`
+	Hex        string        `json:"hex,omitempty"`
+	Mode       DatastoreMode `json:"mode,omitempty"`
+	Generation *uint64       `json:"generation,omitempty"`
+}
+
+func (r *DatastoreRequest) Name() string {
+	return "datastore"
+}
+
+// Store the string {value} at {key}. Keys are paths, eg
+// []string{"myplugin", "peers", id}; the first element should
+// be your plugin's name.
+func NewDatastoreStringRequest(key []string, value string, mode DatastoreMode) *DatastoreRequest {
+	return &DatastoreRequest{
+		Key:    key,
+		String: value,
+		Mode:   mode,
+	}
+}
+
+// Store {value} at {key}, hex encoded
+func NewDatastoreHexRequest(key []string, value []byte, mode DatastoreMode) *DatastoreRequest {
+	return &DatastoreRequest{
+		Key:  key,
+		Hex:  hex.EncodeToString(value),
+		Mode: mode,
+	}
+}
+
+// Only write the entry if it's still at {generation}, ie hasn't
+// been changed since it was read. Use with DatastoreMustReplace
+// or DatastoreMustAppend.
+func (r *DatastoreRequest) IfGeneration(generation uint64) *DatastoreRequest {
+	r.Generation = &generation
+	return r
+}
+
+type DatastoreEntry struct {
+	Key        []string `json:"key"`
+	Generation uint64   `json:"generation,omitempty"`
+	Hex        string   `json:"hex,omitempty"`
+	String     string   `json:"string,omitempty"`
+}
+
+// The entry's value. Entries without a value have children
+func (e *DatastoreEntry) Bytes() ([]byte, error) {
+	return hex.DecodeString(e.Hex)
+}
+
+// Entries without one are only there as the parent of others
+func (e *DatastoreEntry) HasValue() bool {
+	return e.Hex != "" || e.String != ""
+}
+
+// Write an entry to lightningd's datastore. Returns the new
+// entry, with its generation bumped.
+func (l *Lightning) Datastore(req *DatastoreRequest) (*DatastoreEntry, error) {
+	if len(req.Key) == 0 {
+		return nil, fmt.Errorf("Must supply a datastore key")
+	}
+	if req.String != "" && req.Hex != "" {
+		return nil, fmt.Errorf("Can't set both string and hex value")
+	}
+	var result DatastoreEntry
+	err := l.client.Request(req, &result)
+	return &result, err
+}
+
+type DelDatastoreRequest struct {
+	Key        []string `json:"key"`
+	Generation *uint64  `json:"generation,omitempty"`
+}
+
+func (r *DelDatastoreRequest) Name() string {
+	return "deldatastore"
+}
+
+// Delete the entry at {key}. If {generation} is set, it's only
+// deleted if it's still at that generation. Returns the deleted entry.
+func (l *Lightning) DelDatastore(key []string, generation *uint64) (*DatastoreEntry, error) {
+	if len(key) == 0 {
+		return nil, fmt.Errorf("Must supply a datastore key")
+	}
+	var result DatastoreEntry
+	err := l.client.Request(&DelDatastoreRequest{key, generation}, &result)
+	return &result, err
+}
+
+type ListDatastoreRequest struct {
+	Key []string `json:"key,omitempty"`
+}
+
+func (r *ListDatastoreRequest) Name() string {
+	return "listdatastore"
+}
+
+// List the entry at {key} or, if it has children, the entries
+// directly below it. An empty key lists the top level.
+func (l *Lightning) ListDatastore(key []string) ([]*DatastoreEntry, error) {
+	var result struct {
+		Datastore []*DatastoreEntry `json:"datastore"`
+	}
+	err := l.client.Request(&ListDatastoreRequest{key}, &result)
+	return result.Datastore, err
+}
+
+// Returns nil if there's no value stored at {key}
+func (l *Lightning) GetDatastore(key []string) (*DatastoreEntry, error) {
+	if len(key) == 0 {
+		return nil, fmt.Errorf("Must supply a datastore key")
+	}
+	entries, err := l.ListDatastore(key)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if len(entry.Key) == len(key) {
+			return entry, nil
+		}
+	}
+	return nil, nil
+}
+
+type CreateRuneRequest struct {
+	Rune         string     `json:"rune,omitempty"`
+	Restrictions [][]string `json:"restrictions,omitempty"`
+}
+
+func (r *CreateRuneRequest) Name() string {
+	return "createrune"
+}
+
+type CreateRuneResult struct {
+	Rune                    string `json:"rune"`
+	UniqueId                string `json:"unique_id"`
+	WarningUnrestrictedRune string `json:"warning_unrestricted_rune,omitempty"`
+}
+
+func runeRestrictionStrings(restrictions []*RuneRestriction) [][]string {
+	if len(restrictions) == 0 {
+		return nil
+	}
+	strs := make([][]string, len(restrictions))
+	for i, restriction := range restrictions {
+		strs[i] = restriction.Strings()
+	}
+	return strs
+}
+
+// Create a new rune, allowed to do whatever all of {restrictions}
+// allow. With no restrictions, it can run any command.
+func (l *Lightning) CreateRune(restrictions ...*RuneRestriction) (*CreateRuneResult, error) {
+	var result CreateRuneResult
+	err := l.client.Request(&CreateRuneRequest{
+		Restrictions: runeRestrictionStrings(restrictions),
+	}, &result)
+	return &result, err
+}
+
+// Make a copy of {encodedRune} with {restrictions} added. Anyone holding a
+// rune can do this, the new one can only do less.
+func (l *Lightning) AddRuneRestrictions(encodedRune string, restrictions ...*RuneRestriction) (*CreateRuneResult, error) {
+	if encodedRune == "" {
+		return nil, fmt.Errorf("Must supply a rune")
+	}
+	if len(restrictions) == 0 {
+		return nil, fmt.Errorf("Must supply at least one restriction")
+	}
+	var result CreateRuneResult
+	err := l.client.Request(&CreateRuneRequest{
+		Rune:         encodedRune,
+		Restrictions: runeRestrictionStrings(restrictions),
+	}, &result)
+	return &result, err
+}
+
+type CheckRuneRequest struct {
+	Rune   string      `json:"rune"`
+	NodeId string      `json:"nodeid,omitempty"`
+	Method string      `json:"method,omitempty"`
+	Params interface{} `json:"params,omitempty"`
+}
+
+func (r *CheckRuneRequest) Name() string {
+	return "checkrune"
+}
+
+// Check that {encodedRune} lets peer {nodeId} run {method} with {params}.
+// {params} may be a map of named params or a list of positional ones.
+// Returns an error saying why if it doesn't.
+func (l *Lightning) CheckRune(encodedRune, nodeId, method string, params interface{}) (bool, error) {
+	if encodedRune == "" {
+		return false, fmt.Errorf("Must supply a rune")
+	}
+	var result struct {
+		Valid bool `json:"valid"`
+	}
+	err := l.client.Request(&CheckRuneRequest{
+		Rune:   encodedRune,
+		NodeId: nodeId,
+		Method: method,
+		Params: params,
+	}, &result)
+	return result.Valid, err
+}
+
+type ShowRunesRequest struct {
+	Rune string `json:"rune,omitempty"`
+}
+
+func (r *ShowRunesRequest) Name() string {
+	return "showrunes"
+}
+
+type RuneInfo struct {
+	Rune                  string                 `json:"rune"`
+	UniqueId              string                 `json:"unique_id"`
+	Restrictions          []*RuneRestrictionInfo `json:"restrictions"`
+	RestrictionsAsEnglish string                 `json:"restrictions_as_english"`
+	Stored                *bool                  `json:"stored,omitempty"`
+	Blacklisted           bool                   `json:"blacklisted,omitempty"`
+	LastUsed              float64                `json:"last_used,omitempty"`
+	OurRune               *bool                  `json:"our_rune,omitempty"`
+}
+
+type RuneRestrictionInfo struct {
+	Alternatives []*RuneAlternativeInfo `json:"alternatives"`
+	English      string                 `json:"english"`
+}
+
+type RuneAlternativeInfo struct {
+	FieldName string        `json:"fieldname"`
+	Value     string        `json:"value"`
+	Condition RuneCondition `json:"condition"`
+	English   string        `json:"english"`
+}
+
+// List all the runes this node has created
+func (l *Lightning) ShowRunes() ([]*RuneInfo, error) {
+	var result struct {
+		Runes []*RuneInfo `json:"runes"`
+	}
+	err := l.client.Request(&ShowRunesRequest{}, &result)
+	return result.Runes, err
+}
+
+// Show {encodedRune}'s restrictions, and whether it's one of ours. It
+// needn't have been created by this node.
+func (l *Lightning) ShowRune(encodedRune string) (*RuneInfo, error) {
+	if encodedRune == "" {
+		return nil, fmt.Errorf("Must supply a rune")
+	}
+	var result struct {
+		Runes []*RuneInfo `json:"runes"`
+	}
+	err := l.client.Request(&ShowRunesRequest{encodedRune}, &result)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Runes) == 0 {
+		return nil, fmt.Errorf("No information returned for rune")
+	}
+	return result.Runes[0], nil
+}
+
+type BlacklistRuneRequest struct {
+	Start *uint64 `json:"start,omitempty"`
+	End   *uint64 `json:"end,omitempty"`
+}
+
+func (r *BlacklistRuneRequest) Name() string {
+	return "blacklistrune"
+}
+
+// A range of rune unique ids, inclusive
+type RuneIdRange struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+}
+
+// Blacklist the runes with unique ids from {start} to {end},
+// inclusive, so they can no longer be used. Returns the whole blacklist
+func (l *Lightning) BlacklistRunes(start, end uint64) ([]*RuneIdRange, error) {
+	if end < start {
+		return nil, fmt.Errorf("end (%d) is before start (%d)", end, start)
+	}
+	var result struct {
+		Blacklist []*RuneIdRange `json:"blacklist"`
+	}
+	err := l.client.Request(&BlacklistRuneRequest{&start, &end}, &result)
+	return result.Blacklist, err
+}
+
+func (l *Lightning) ListBlacklistedRunes() ([]*RuneIdRange, error) {
+	var result struct {
+		Blacklist []*RuneIdRange `json:"blacklist"`
+	}
+	err := l.client.Request(&BlacklistRuneRequest{}, &result)
+	return result.Blacklist, err
+}
+
+type CommandoRequest struct {
+	PeerId string      `json:"peer_id"`
+	Method string      `json:"method"`
+	Params interface{} `json:"params,omitempty"`
+	Rune   string      `json:"rune,omitempty"`
+}
+
+func (r *CommandoRequest) Name() string {
+	return "commando"
+}
+
+// Run {m} on the remote node {peerId}, over the lightning network,
+// using {encodedRune} to authorize it. The result is parsed into {resp}, as
+// for a local call, eg
+//
+//	var info glightning.NodeInfo
+//	err := lightning.Commando(peerId, encodedRune, &glightning.GetInfoRequest{}, &info)
+//
+// The peer must be connected.
+//
+// To run all of a Lightning's requests on a remote node, see
+// NewRemoteLightning.
+func (l *Lightning) Commando(peerId, encodedRune string, m jrpc2.Method, resp interface{}) error {
+	req, err := newCommandoRequest(peerId, encodedRune, m)
+	if err != nil {
+		return err
+	}
+	return l.client.RequestNoTimeout(req, resp)
+}
+
 type SharedSecretRequest struct {
 	Point string `json:"point"`
 }
@@ -2423,6 +4332,15 @@ func init() {
 	Lightning_RpcMethods[(&DeleteExpiredInvoiceReq{}).Name()] = func() jrpc2.Method { return new(DeleteExpiredInvoiceReq) }
 	Lightning_RpcMethods[(&AutoCleanInvoiceRequest{}).Name()] = func() jrpc2.Method { return new(AutoCleanInvoiceRequest) }
 	Lightning_RpcMethods[(&DecodePayRequest{}).Name()] = func() jrpc2.Method { return new(DecodePayRequest) }
+	Lightning_RpcMethods[(&OfferRequest{}).Name()] = func() jrpc2.Method { return new(OfferRequest) }
+	Lightning_RpcMethods[(&ListOffersRequest{}).Name()] = func() jrpc2.Method { return new(ListOffersRequest) }
+	Lightning_RpcMethods[(&DisableOfferRequest{}).Name()] = func() jrpc2.Method { return new(DisableOfferRequest) }
+	Lightning_RpcMethods[(&FetchInvoiceRequest{}).Name()] = func() jrpc2.Method { return new(FetchInvoiceRequest) }
+	Lightning_RpcMethods[(&SendInvoiceRequest{}).Name()] = func() jrpc2.Method { return new(SendInvoiceRequest) }
+	Lightning_RpcMethods[(&InvoiceRequestRequest{}).Name()] = func() jrpc2.Method { return new(InvoiceRequestRequest) }
+	Lightning_RpcMethods[(&ListInvoiceRequestsRequest{}).Name()] = func() jrpc2.Method { return new(ListInvoiceRequestsRequest) }
+	Lightning_RpcMethods[(&DecodeRequest{}).Name()] = func() jrpc2.Method { return new(DecodeRequest) }
+	Lightning_RpcMethods[(&KeysendRequest{}).Name()] = func() jrpc2.Method { return new(KeysendRequest) }
 	Lightning_RpcMethods[(&PayStatusRequest{}).Name()] = func() jrpc2.Method { return new(PayStatusRequest) }
 	Lightning_RpcMethods[(&HelpRequest{}).Name()] = func() jrpc2.Method { return new(HelpRequest) }
 	Lightning_RpcMethods[(&StopRequest{}).Name()] = func() jrpc2.Method { return new(StopRequest) }
@@ -2444,6 +4362,12 @@ func init() {
 	Lightning_RpcMethods[(&FundChannelStart{}).Name()] = func() jrpc2.Method { return new(FundChannelStart) }
 	Lightning_RpcMethods[(&FundChannelComplete{}).Name()] = func() jrpc2.Method { return new(FundChannelComplete) }
 	Lightning_RpcMethods[(&FundChannelCancel{}).Name()] = func() jrpc2.Method { return new(FundChannelCancel) }
+	Lightning_RpcMethods[(&MultiFundChannelRequest{}).Name()] = func() jrpc2.Method { return new(MultiFundChannelRequest) }
+	Lightning_RpcMethods[(&OpenChannelInitRequest{}).Name()] = func() jrpc2.Method { return new(OpenChannelInitRequest) }
+	Lightning_RpcMethods[(&OpenChannelUpdateRequest{}).Name()] = func() jrpc2.Method { return new(OpenChannelUpdateRequest) }
+	Lightning_RpcMethods[(&OpenChannelSignedRequest{}).Name()] = func() jrpc2.Method { return new(OpenChannelSignedRequest) }
+	Lightning_RpcMethods[(&OpenChannelAbortRequest{}).Name()] = func() jrpc2.Method { return new(OpenChannelAbortRequest) }
+	Lightning_RpcMethods[(&OpenChannelBumpRequest{}).Name()] = func() jrpc2.Method { return new(OpenChannelBumpRequest) }
 	Lightning_RpcMethods[(&CloseRequest{}).Name()] = func() jrpc2.Method { return new(CloseRequest) }
 	Lightning_RpcMethods[(&PingRequest{}).Name()] = func() jrpc2.Method { return new(PingRequest) }
 	Lightning_RpcMethods[(&WithdrawRequest{}).Name()] = func() jrpc2.Method { return new(WithdrawRequest) }
@@ -2453,9 +4377,30 @@ func init() {
 	Lightning_RpcMethods[(&TxSend{}).Name()] = func() jrpc2.Method { return new(TxSend) }
 	Lightning_RpcMethods[(&ListFundsRequest{}).Name()] = func() jrpc2.Method { return new(ListFundsRequest) }
 	Lightning_RpcMethods[(&ListForwardsRequest{}).Name()] = func() jrpc2.Method { return new(ListForwardsRequest) }
+	Lightning_RpcMethods[(&WaitRequest{}).Name()] = func() jrpc2.Method { return new(WaitRequest) }
 	Lightning_RpcMethods[(&DisconnectRequest{}).Name()] = func() jrpc2.Method { return new(DisconnectRequest) }
+	Lightning_RpcMethods[(&SendCustomMessageRequest{}).Name()] = func() jrpc2.Method { return new(SendCustomMessageRequest) }
 	Lightning_RpcMethods[(&FeeRatesRequest{}).Name()] = func() jrpc2.Method { return new(FeeRatesRequest) }
 	Lightning_RpcMethods[(&SetChannelFeeRequest{}).Name()] = func() jrpc2.Method { return new(SetChannelFeeRequest) }
 	Lightning_RpcMethods[(&PluginRequest{}).Name()] = func() jrpc2.Method { return new(PluginRequest) }
 	Lightning_RpcMethods[(&SharedSecretRequest{}).Name()] = func() jrpc2.Method { return new(SharedSecretRequest) }
+	Lightning_RpcMethods[(&DatastoreRequest{}).Name()] = func() jrpc2.Method { return new(DatastoreRequest) }
+	Lightning_RpcMethods[(&DelDatastoreRequest{}).Name()] = func() jrpc2.Method { return new(DelDatastoreRequest) }
+	Lightning_RpcMethods[(&ListDatastoreRequest{}).Name()] = func() jrpc2.Method { return new(ListDatastoreRequest) }
+	Lightning_RpcMethods[(&FundPsbtRequest{}).Name()] = func() jrpc2.Method { return new(FundPsbtRequest) }
+	Lightning_RpcMethods[(&UtxoPsbtRequest{}).Name()] = func() jrpc2.Method { return new(UtxoPsbtRequest) }
+	Lightning_RpcMethods[(&ReserveInputsRequest{}).Name()] = func() jrpc2.Method { return new(ReserveInputsRequest) }
+	Lightning_RpcMethods[(&UnreserveInputsRequest{}).Name()] = func() jrpc2.Method { return new(UnreserveInputsRequest) }
+	Lightning_RpcMethods[(&SignPsbtRequest{}).Name()] = func() jrpc2.Method { return new(SignPsbtRequest) }
+	Lightning_RpcMethods[(&SendPsbtRequest{}).Name()] = func() jrpc2.Method { return new(SendPsbtRequest) }
+	Lightning_RpcMethods[(&AddPsbtOutputRequest{}).Name()] = func() jrpc2.Method { return new(AddPsbtOutputRequest) }
+	Lightning_RpcMethods[(&SetPsbtVersionRequest{}).Name()] = func() jrpc2.Method { return new(SetPsbtVersionRequest) }
+	Lightning_RpcMethods[(&CreateRuneRequest{}).Name()] = func() jrpc2.Method { return new(CreateRuneRequest) }
+	Lightning_RpcMethods[(&CheckRuneRequest{}).Name()] = func() jrpc2.Method { return new(CheckRuneRequest) }
+	Lightning_RpcMethods[(&ShowRunesRequest{}).Name()] = func() jrpc2.Method { return new(ShowRunesRequest) }
+	Lightning_RpcMethods[(&BlacklistRuneRequest{}).Name()] = func() jrpc2.Method { return new(BlacklistRuneRequest) }
+	Lightning_RpcMethods[(&CommandoRequest{}).Name()] = func() jrpc2.Method { return new(CommandoRequest) }
+	Lightning_RpcMethods[(&ListPeerChannelsRequest{}).Name()] = func() jrpc2.Method { return new(ListPeerChannelsRequest) }
+	Lightning_RpcMethods[(&ListClosedChannelsRequest{}).Name()] = func() jrpc2.Method { return new(ListClosedChannelsRequest) }
+	Lightning_RpcMethods[(&ListHtlcsRequest{}).Name()] = func() jrpc2.Method { return new(ListHtlcsRequest) }
 }
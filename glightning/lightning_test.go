@@ -1177,6 +1177,183 @@ func TestTxDiscard(t *testing.T) {
 	}, result)
 }
 
+func TestFundPsbt(t *testing.T) {
+	feerate := glightning.NewFeeRate(glightning.PerKw, 253)
+	reserve := uint32(0)
+	req := `{"jsonrpc":"2.0","method":"fundpsbt","params":{"excess_as_change":true,"feerate":"253perkw","reserve":0,"satoshi":"100000","startweight":1000},"id":1}`
+	resp := wrapResult(1, `{
+   "psbt": "cHNidP8BAF4CAAAAAQ==",
+   "feerate_per_kw": 253,
+   "estimated_final_weight": 1444,
+   "excess_msat": 0,
+   "change_outnum": 0,
+   "reservations": [
+      {
+         "txid": "5c0b7f05822b0f6581cd3c588ffacfe5c5f835e1244934ea575065dd4480157c",
+         "vout": 1,
+         "was_reserved": false,
+         "reserved": true,
+         "reserved_to_block": 175
+      }
+   ]
+}`)
+
+	lightning, requestQ, replyQ := startupServer(t)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	fundReq := glightning.NewFundPsbtRequest(glightning.NewSat(100000), feerate, 1000)
+	fundReq.Reserve = &reserve
+	fundReq.ExcessAsChange = true
+	result, err := lightning.FundPsbt(fundReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changeOut := uint32(0)
+	assert.Equal(t, &glightning.FundPsbtResult{
+		Psbt:                 "cHNidP8BAF4CAAAAAQ==",
+		FeeRatePerKw:         253,
+		EstimatedFinalWeight: 1444,
+		ChangeOutNum:         &changeOut,
+		Reservations: []*glightning.Reservation{
+			&glightning.Reservation{
+				TxId:            "5c0b7f05822b0f6581cd3c588ffacfe5c5f835e1244934ea575065dd4480157c",
+				Vout:            1,
+				Reserved:        true,
+				ReservedToBlock: 175,
+			},
+		},
+	}, result)
+}
+
+func TestUtxoPsbt(t *testing.T) {
+	feerate := glightning.NewFeeRate(glightning.PerKw, 253)
+	utxos := []*glightning.Utxo{
+		&glightning.Utxo{
+			TxId:  "5c0b7f05822b0f6581cd3c588ffacfe5c5f835e1244934ea575065dd4480157c",
+			Index: 1,
+		},
+	}
+	req := `{"jsonrpc":"2.0","method":"utxopsbt","params":{"feerate":"253perkw","reservedok":true,"satoshi":"all","startweight":0,"utxos":["5c0b7f05822b0f6581cd3c588ffacfe5c5f835e1244934ea575065dd4480157c:1"]},"id":1}`
+	resp := wrapResult(1, `{
+   "psbt": "cHNidP8BAF4CAAAAAQ==",
+   "feerate_per_kw": 253,
+   "estimated_final_weight": 444,
+   "excess_msat": 99889000,
+   "reservations": []
+}`)
+
+	lightning, requestQ, replyQ := startupServer(t)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	utxoReq := glightning.NewUtxoPsbtRequest(glightning.AllSats(), feerate, 0, utxos)
+	utxoReq.ReservedOk = true
+	result, err := lightning.UtxoPsbt(utxoReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, &glightning.FundPsbtResult{
+		Psbt:                 "cHNidP8BAF4CAAAAAQ==",
+		FeeRatePerKw:         253,
+		EstimatedFinalWeight: 444,
+		ExcessMsat:           99889000,
+		Reservations:         []*glightning.Reservation{},
+	}, result)
+
+	_, err = lightning.UtxoPsbt(glightning.NewUtxoPsbtRequest(glightning.AllSats(), feerate, 0, nil))
+	assert.NotNil(t, err)
+}
+
+func TestReserveInputs(t *testing.T) {
+	req := `{"jsonrpc":"2.0","method":"reserveinputs","params":{"exclusive":false,"psbt":"cHNidP8BAF4CAAAAAQ==","reserve":144},"id":1}`
+	resp := wrapResult(1, `{
+   "reservations": [
+      {
+         "txid": "5c0b7f05822b0f6581cd3c588ffacfe5c5f835e1244934ea575065dd4480157c",
+         "vout": 1,
+         "was_reserved": true,
+         "reserved": true,
+         "reserved_to_block": 319
+      }
+   ]
+}`)
+
+	lightning, requestQ, replyQ := startupServer(t)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	reserve := uint32(144)
+	result, err := lightning.ReserveInputs("cHNidP8BAF4CAAAAAQ==", false, &reserve)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []*glightning.Reservation{
+		&glightning.Reservation{
+			TxId:            "5c0b7f05822b0f6581cd3c588ffacfe5c5f835e1244934ea575065dd4480157c",
+			Vout:            1,
+			WasReserved:     true,
+			Reserved:        true,
+			ReservedToBlock: 319,
+		},
+	}, result)
+}
+
+func TestSignPsbt(t *testing.T) {
+	req := `{"jsonrpc":"2.0","method":"signpsbt","params":{"psbt":"cHNidP8BAF4CAAAAAQ==","signonly":[0]},"id":1}`
+	resp := wrapResult(1, `{
+   "signed_psbt": "cHNidP8BAF4CAAAAAg=="
+}`)
+
+	lightning, requestQ, replyQ := startupServer(t)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	result, err := lightning.SignPsbt("cHNidP8BAF4CAAAAAQ==", []uint32{0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "cHNidP8BAF4CAAAAAg==", result)
+}
+
+func TestSendPsbt(t *testing.T) {
+	req := `{"jsonrpc":"2.0","method":"sendpsbt","params":{"psbt":"cHNidP8BAF4CAAAAAg=="},"id":1}`
+	resp := wrapResult(1, `{
+   "tx": "02000000015c0b7f05822b0f6581cd3c588ffacfe5c5f835e1244934ea575065dd4480157c0000000000ffffffff0195feff000000000016001449a59c8b2c806e554858127df08ed4aadf361b4600000000",
+   "txid": "642d8a28c9ef5fb0699c7c88237293ab79aa9bebbc7bdf897d3bb1c617fd622a"
+}`)
+
+	lightning, requestQ, replyQ := startupServer(t)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	result, err := lightning.SendPsbt("cHNidP8BAF4CAAAAAg==", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, &glightning.SendPsbtResult{
+		Tx:   "02000000015c0b7f05822b0f6581cd3c588ffacfe5c5f835e1244934ea575065dd4480157c0000000000ffffffff0195feff000000000016001449a59c8b2c806e554858127df08ed4aadf361b4600000000",
+		TxId: "642d8a28c9ef5fb0699c7c88237293ab79aa9bebbc7bdf897d3bb1c617fd622a",
+	}, result)
+}
+
+func TestAddPsbtOutput(t *testing.T) {
+	req := `{"jsonrpc":"2.0","method":"addpsbtoutput","params":{"destination":"bcrt1qeyyk6sl5pr49ycpqyckvmttus5ttj25pd0zpvg","satoshi":"50000"},"id":1}`
+	resp := wrapResult(1, `{
+   "psbt": "cHNidP8BAF4CAAAAAw==",
+   "estimated_added_weight": 172,
+   "outnum": 0
+}`)
+
+	lightning, requestQ, replyQ := startupServer(t)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	result, err := lightning.AddPsbtOutput(glightning.NewSat(50000), "", "bcrt1qeyyk6sl5pr49ycpqyckvmttus5ttj25pd0zpvg", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, &glightning.AddPsbtOutputResult{
+		Psbt:                 "cHNidP8BAF4CAAAAAw==",
+		EstimatedAddedWeight: 172,
+		OutNum:               0,
+	}, result)
+}
+
 func TestClose(t *testing.T) {
 	id := "03fb0b8a395a60084946eaf98cfb5a81ea010e0307eaf368ba21e7d6bcf0e4dc41"
 	req := `{"jsonrpc":"2.0","method":"close","params":{"id":"03fb0b8a395a60084946eaf98cfb5a81ea010e0307eaf368ba21e7d6bcf0e4dc41"},"id":1}`
@@ -1313,6 +1490,23 @@ func TestDisconnect(t *testing.T) {
 	}
 }
 
+func TestSendCustomMessage(t *testing.T) {
+	id := "03fb0b8a395a60084946eaf98cfb5a81ea010e0307eaf368ba21e7d6bcf0e4dc41"
+
+	req := fmt.Sprintf(`{"jsonrpc":"2.0","method":"sendcustommsg","params":{"msg":"8001deadbeef","node_id":"%s"},"id":%d}`, id, 1)
+	resp := wrapResult(1, `{
+  "status": "Message sent to connectd for delivery"
+}`)
+
+	lightning, requestQ, replyQ := startupServer(t)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	result, err := lightning.SendCustomMessage(id, "8001deadbeef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Message sent to connectd for delivery", result.Status)
+}
+
 func TestFundChannel(t *testing.T) {
 	id := "03fb0b8a395a60084946eaf98cfb5a81ea010e0307eaf368ba21e7d6bcf0e4dc41"
 	amount := 90000
@@ -1405,6 +1599,208 @@ func TestFundChannel(t *testing.T) {
 
 }
 
+func TestFundChannelWithRequest(t *testing.T) {
+	id := "03fb0b8a395a60084946eaf98cfb5a81ea010e0307eaf368ba21e7d6bcf0e4dc41"
+	req := `{"jsonrpc":"2.0","method":"fundchannel","params":{"amount":"1000000","announce":true,"close_to":"bcrt1qeyyk6sl5pr49ycpqyckvmttus5ttj25pd0zpvg","compact_lease":"029a00640064000000644c4b40","id":"03fb0b8a395a60084946eaf98cfb5a81ea010e0307eaf368ba21e7d6bcf0e4dc41","request_amt":"500000","utxos":["5c0b7f05822b0f6581cd3c588ffacfe5c5f835e1244934ea575065dd4480157c:1"]},"id":1}`
+	resp := wrapResult(1, `{
+  "tx": "0200000000010153bcd4cfabb72750bb8d16fc711c91b30215957549a0a93370f50475fa94575701000000",
+  "txid": "7c158044dd655057ea344924e135f8c5e5cffa8f583ccd81650f2b82057f0b5c",
+  "channel_id": "5c0b7f05822b0f6581cd3c588ffacfe5c5f835e1244934ea575065dd4480157c",
+  "outnum": 1,
+  "close_to": "0014c9096d43f408ea526020262ccdad7c8516b92a81"
+}`)
+
+	lightning, requestQ, replyQ := startupServer(t)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	fundReq := glightning.NewFundChannelRequest(id, glightning.NewSat(1000000))
+	fundReq.CloseTo = "bcrt1qeyyk6sl5pr49ycpqyckvmttus5ttj25pd0zpvg"
+	fundReq.RequestLease(glightning.NewSat(500000), "029a00640064000000644c4b40")
+	fundReq.SetUtxos([]*glightning.Utxo{
+		&glightning.Utxo{
+			TxId:  "5c0b7f05822b0f6581cd3c588ffacfe5c5f835e1244934ea575065dd4480157c",
+			Index: 1,
+		},
+	})
+	result, err := lightning.FundChannelWithRequest(fundReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &glightning.FundChannelResult{
+		FundingTx:   "0200000000010153bcd4cfabb72750bb8d16fc711c91b30215957549a0a93370f50475fa94575701000000",
+		FundingTxId: "7c158044dd655057ea344924e135f8c5e5cffa8f583ccd81650f2b82057f0b5c",
+		ChannelId:   "5c0b7f05822b0f6581cd3c588ffacfe5c5f835e1244934ea575065dd4480157c",
+		OutNum:      1,
+		CloseTo:     "0014c9096d43f408ea526020262ccdad7c8516b92a81",
+	}, result)
+
+	_, err = lightning.FundChannelWithRequest(glightning.NewFundChannelRequest("", glightning.NewSat(1000)))
+	assert.NotNil(t, err)
+}
+
+func TestMultiFundChannel(t *testing.T) {
+	idA := "03fb0b8a395a60084946eaf98cfb5a81ea010e0307eaf368ba21e7d6bcf0e4dc41"
+	idB := "02e3cd7849f177a46f137ae3bfc1a08fc6a90bf4026c74f83c1ecc8430c282fe96"
+	req := `{"jsonrpc":"2.0","method":"multifundchannel","params":{"destinations":[{"id":"03fb0b8a395a60084946eaf98cfb5a81ea010e0307eaf368ba21e7d6bcf0e4dc41@127.0.0.1:9735","amount":"100000","announce":true},{"id":"02e3cd7849f177a46f137ae3bfc1a08fc6a90bf4026c74f83c1ecc8430c282fe96","amount":"all","announce":false,"push_msat":"1000msat"}],"feerate":"normal","minchannels":1},"id":1}`
+	resp := wrapResult(1, `{
+  "tx": "02000000015c0b7f05822b0f6581cd3c588ffacfe5c5f835e1244934ea575065dd4480157c0000000000ffffffff",
+  "txid": "642d8a28c9ef5fb0699c7c88237293ab79aa9bebbc7bdf897d3bb1c617fd622a",
+  "channel_ids": [
+    {
+      "id": "03fb0b8a395a60084946eaf98cfb5a81ea010e0307eaf368ba21e7d6bcf0e4dc41",
+      "channel_id": "2a62fd17c6b13b7d89df7bbceb9baa79ab937223887c9c69b05fefc9288a2d64",
+      "outnum": 0,
+      "channel_type": {
+        "bits": [12],
+        "names": ["static_remotekey/even"]
+      }
+    }
+  ],
+  "failed": [
+    {
+      "id": "02e3cd7849f177a46f137ae3bfc1a08fc6a90bf4026c74f83c1ecc8430c282fe96",
+      "method": "connect",
+      "error": {
+        "code": 401,
+        "message": "All addresses failed"
+      }
+    }
+  ]
+}`)
+
+	lightning, requestQ, replyQ := startupServer(t)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	private := glightning.NewFundDestination(idB, glightning.AllSats())
+	private.Announce = false
+	private.PushMsat = glightning.NewMsat(1000).String()
+	mfReq := glightning.NewMultiFundChannelRequest([]*glightning.FundDestination{
+		glightning.NewFundDestination(idA+"@127.0.0.1:9735", glightning.NewSat(100000)),
+		private,
+	})
+	mfReq.FeeRate = glightning.NewFeeRateByDirective(glightning.PerKw, glightning.Normal).String()
+	mfReq.MinChannels = 1
+	result, err := lightning.MultiFundChannel(mfReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "642d8a28c9ef5fb0699c7c88237293ab79aa9bebbc7bdf897d3bb1c617fd622a", result.TxId)
+	assert.Equal(t, []*glightning.FundedChannel{
+		&glightning.FundedChannel{
+			Id:        idA,
+			ChannelId: "2a62fd17c6b13b7d89df7bbceb9baa79ab937223887c9c69b05fefc9288a2d64",
+			OutNum:    0,
+			ChannelType: &glightning.ChannelType{
+				Bits:  []uint{12},
+				Names: []string{"static_remotekey/even"},
+			},
+		},
+	}, result.ChannelIds)
+	assert.Equal(t, 1, len(result.Failed))
+	assert.Equal(t, idB, result.Failed[0].Id)
+	assert.Equal(t, "connect", result.Failed[0].Method)
+	assert.Equal(t, 401, result.Failed[0].Error.Code)
+	assert.Equal(t, "All addresses failed", result.Failed[0].Error.Message)
+
+	_, err = lightning.MultiFundChannel(glightning.NewMultiFundChannelRequest(nil))
+	assert.NotNil(t, err)
+}
+
+func TestOpenChannelV2(t *testing.T) {
+	id := "03fb0b8a395a60084946eaf98cfb5a81ea010e0307eaf368ba21e7d6bcf0e4dc41"
+	channelId := "252d1b0a1e57895e84137f28cf19ab2c35847e284c112fefdecc7afeaa5c1de7"
+	lightning, requestQ, replyQ := startupServer(t)
+
+	req := `{"jsonrpc":"2.0","method":"openchannel_init","params":{"amount":"1000000","announce":true,"funding_feerate":"7500perkw","id":"03fb0b8a395a60084946eaf98cfb5a81ea010e0307eaf368ba21e7d6bcf0e4dc41","initialpsbt":"cHNidP8BAF4CAAAAAQ=="},"id":1}`
+	resp := wrapResult(1, `{
+  "channel_id": "252d1b0a1e57895e84137f28cf19ab2c35847e284c112fefdecc7afeaa5c1de7",
+  "psbt": "cHNidP8BAF4CAAAAAg==",
+  "channel_type": {"bits": [12, 22], "names": ["static_remotekey/even", "anchors/even"]},
+  "commitments_secured": false,
+  "funding_serial": 17726150559367092000,
+  "requires_confirmed_inputs": false
+}`)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	initReq := glightning.NewOpenChannelInitRequest(id, glightning.NewSat(1000000), "cHNidP8BAF4CAAAAAQ==")
+	initReq.FundingFeeRate = glightning.NewFeeRate(glightning.PerKw, 7500).String()
+	started, err := lightning.OpenChannelInit(initReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, channelId, started.ChannelId)
+	assert.Equal(t, "cHNidP8BAF4CAAAAAg==", started.Psbt)
+	assert.Equal(t, []string{"static_remotekey/even", "anchors/even"}, started.ChannelType.Names)
+	assert.False(t, started.CommitmentsSecured)
+	assert.Equal(t, uint64(17726150559367092000), started.FundingSerial)
+
+	req = `{"jsonrpc":"2.0","method":"openchannel_update","params":{"channel_id":"252d1b0a1e57895e84137f28cf19ab2c35847e284c112fefdecc7afeaa5c1de7","psbt":"cHNidP8BAF4CAAAAAg=="},"id":2}`
+	resp = wrapResult(2, `{
+  "channel_id": "252d1b0a1e57895e84137f28cf19ab2c35847e284c112fefdecc7afeaa5c1de7",
+  "psbt": "cHNidP8BAF4CAAAAAw==",
+  "channel_type": {"bits": [12, 22], "names": ["static_remotekey/even", "anchors/even"]},
+  "commitments_secured": true,
+  "funding_outnum": 1,
+  "close_to": "0014c9096d43f408ea526020262ccdad7c8516b92a81",
+  "requires_confirmed_inputs": false
+}`)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	updated, err := lightning.OpenChannelUpdate(channelId, started.Psbt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, updated.CommitmentsSecured)
+	assert.Equal(t, uint32(1), updated.FundingOutNum)
+	assert.Equal(t, "0014c9096d43f408ea526020262ccdad7c8516b92a81", updated.CloseTo)
+
+	req = `{"jsonrpc":"2.0","method":"openchannel_signed","params":{"channel_id":"252d1b0a1e57895e84137f28cf19ab2c35847e284c112fefdecc7afeaa5c1de7","signed_psbt":"cHNidP8BAF4CAAAABA=="},"id":3}`
+	resp = wrapResult(3, `{
+  "channel_id": "252d1b0a1e57895e84137f28cf19ab2c35847e284c112fefdecc7afeaa5c1de7",
+  "tx": "02000000015c0b7f05822b0f6581cd3c588ffacfe5c5f835e1244934ea575065dd4480157c0000000000ffffffff",
+  "txid": "642d8a28c9ef5fb0699c7c88237293ab79aa9bebbc7bdf897d3bb1c617fd622a"
+}`)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	signed, err := lightning.OpenChannelSigned(channelId, "cHNidP8BAF4CAAAABA==")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &glightning.OpenChannelSignedResult{
+		ChannelId: channelId,
+		Tx:        "02000000015c0b7f05822b0f6581cd3c588ffacfe5c5f835e1244934ea575065dd4480157c0000000000ffffffff",
+		TxId:      "642d8a28c9ef5fb0699c7c88237293ab79aa9bebbc7bdf897d3bb1c617fd622a",
+	}, signed)
+
+	req = `{"jsonrpc":"2.0","method":"openchannel_bump","params":{"amount":"1000000","channel_id":"252d1b0a1e57895e84137f28cf19ab2c35847e284c112fefdecc7afeaa5c1de7","funding_feerate":"10000perkw","initialpsbt":"cHNidP8BAF4CAAAAAQ=="},"id":4}`
+	resp = wrapResult(4, `{
+  "channel_id": "252d1b0a1e57895e84137f28cf19ab2c35847e284c112fefdecc7afeaa5c1de7",
+  "psbt": "cHNidP8BAF4CAAAABQ==",
+  "commitments_secured": false,
+  "funding_serial": 7,
+  "requires_confirmed_inputs": true
+}`)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	bumped, err := lightning.OpenChannelBump(channelId, glightning.NewSat(1000000), "cHNidP8BAF4CAAAAAQ==", glightning.NewFeeRate(glightning.PerKw, 10000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "cHNidP8BAF4CAAAABQ==", bumped.Psbt)
+	assert.True(t, bumped.RequiresConfirmedInputs)
+
+	req = `{"jsonrpc":"2.0","method":"openchannel_abort","params":{"channel_id":"252d1b0a1e57895e84137f28cf19ab2c35847e284c112fefdecc7afeaa5c1de7"},"id":5}`
+	resp = wrapResult(5, `{
+  "channel_id": "252d1b0a1e57895e84137f28cf19ab2c35847e284c112fefdecc7afeaa5c1de7",
+  "channel_canceled": false,
+  "reason": "Abort requested"
+}`)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	aborted, err := lightning.OpenChannelAbort(channelId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &glightning.OpenChannelAbortResult{
+		ChannelId: channelId,
+		Reason:    "Abort requested",
+	}, aborted)
+}
+
 func TestStartFundChannel(t *testing.T) {
 	id := "0334b7c8e723c00aedb6aaab0988619a6929f0039275ac195185efbadad1a343f9"
 	sats := uint64(100000)
@@ -1959,6 +2355,969 @@ func TestDecodePayWithDescAndFallbacks(t *testing.T) {
 	}, decodedBolt)
 }
 
+func TestCreateOffer(t *testing.T) {
+	req := `{"jsonrpc":"2.0","method":"offer","params":{"amount":"10000msat","description":"coffee","issuer":"cafe","label":"menu","recurrence":"1month"},"id":1}`
+	resp := wrapResult(1, `{
+  "offer_id": "053a5c566fbea2681a5ff9c05a913da23e45b95d09ef5bd25d7d408f23da7084",
+  "active": true,
+  "single_use": false,
+  "bolt12": "lno1qgsqvgnwgcg35z6ee2h3yczraddm72xrfua9uve2rlrm9deu7xyfzrcgqgn3qzsyvfkx26qkyypvr5hfx60h9w9k934lt8s2n6zc0wwtgqlulw7dythr83dqx8tzumg",
+  "used": false,
+  "created": true,
+  "label": "menu"
+}`)
+
+	lightning, requestQ, replyQ := startupServer(t)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	offerReq := glightning.NewOfferRequest(glightning.NewMsat(10000), "coffee")
+	offerReq.Issuer = "cafe"
+	offerReq.Label = "menu"
+	offerReq.Recurrence = "1month"
+	result, err := lightning.CreateOffer(offerReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, &glightning.Offer{
+		OfferId: "053a5c566fbea2681a5ff9c05a913da23e45b95d09ef5bd25d7d408f23da7084",
+		Active:  true,
+		Bolt12:  "lno1qgsqvgnwgcg35z6ee2h3yczraddm72xrfua9uve2rlrm9deu7xyfzrcgqgn3qzsyvfkx26qkyypvr5hfx60h9w9k934lt8s2n6zc0wwtgqlulw7dythr83dqx8tzumg",
+		Label:   "menu",
+		Created: true,
+	}, result)
+
+	assert.Equal(t, "any", glightning.NewOfferRequest(nil, "tips").Amount)
+}
+
+func TestListOffers(t *testing.T) {
+	offerId := "053a5c566fbea2681a5ff9c05a913da23e45b95d09ef5bd25d7d408f23da7084"
+	offers := `{
+  "offers": [
+    {
+      "offer_id": "053a5c566fbea2681a5ff9c05a913da23e45b95d09ef5bd25d7d408f23da7084",
+      "active": true,
+      "single_use": true,
+      "bolt12": "lno1qgsqvgnwgcg35z6ee2h3yczraddm72xrfua9uve2rlrm9deu7xyfzrcgqgn3qzsyvfkx26qkyypvr5hfx60h9w9k934lt8s2n6zc0wwtgqlulw7dythr83dqx8tzumg",
+      "used": true
+    }
+  ]
+}`
+	expected := &glightning.Offer{
+		OfferId:   offerId,
+		Active:    true,
+		SingleUse: true,
+		Bolt12:    "lno1qgsqvgnwgcg35z6ee2h3yczraddm72xrfua9uve2rlrm9deu7xyfzrcgqgn3qzsyvfkx26qkyypvr5hfx60h9w9k934lt8s2n6zc0wwtgqlulw7dythr83dqx8tzumg",
+		Used:      true,
+	}
+	lightning, requestQ, replyQ := startupServer(t)
+
+	req := `{"jsonrpc":"2.0","method":"listoffers","params":{"active_only":true},"id":1}`
+	go runServerSide(t, req, wrapResult(1, offers), replyQ, requestQ)
+	result, err := lightning.ListOffers(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []*glightning.Offer{expected}, result)
+
+	req = `{"jsonrpc":"2.0","method":"listoffers","params":{"offer_id":"053a5c566fbea2681a5ff9c05a913da23e45b95d09ef5bd25d7d408f23da7084"},"id":2}`
+	go runServerSide(t, req, wrapResult(2, offers), replyQ, requestQ)
+	offer, err := lightning.GetOffer(offerId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, expected, offer)
+
+	req = `{"jsonrpc":"2.0","method":"listoffers","params":{"offer_id":"053a5c566fbea2681a5ff9c05a913da23e45b95d09ef5bd25d7d408f23da7084"},"id":3}`
+	go runServerSide(t, req, wrapResult(3, `{"offers":[]}`), replyQ, requestQ)
+	offer, err = lightning.GetOffer(offerId)
+	assert.Nil(t, err)
+	assert.Nil(t, offer)
+
+	req = `{"jsonrpc":"2.0","method":"disableoffer","params":{"offer_id":"053a5c566fbea2681a5ff9c05a913da23e45b95d09ef5bd25d7d408f23da7084"},"id":4}`
+	go runServerSide(t, req, wrapResult(4, `{
+  "offer_id": "053a5c566fbea2681a5ff9c05a913da23e45b95d09ef5bd25d7d408f23da7084",
+  "active": false,
+  "single_use": true,
+  "bolt12": "lno1qgsqvgnwgcg35z6ee2h3yczraddm72xrfua9uve2rlrm9deu7xyfzrcgqgn3qzsyvfkx26qkyypvr5hfx60h9w9k934lt8s2n6zc0wwtgqlulw7dythr83dqx8tzumg",
+  "used": true
+}`), replyQ, requestQ)
+	disabled, err := lightning.DisableOffer(offerId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, disabled.Active)
+}
+
+func TestFetchInvoice(t *testing.T) {
+	req := `{"jsonrpc":"2.0","method":"fetchinvoice","params":{"offer":"lno1qgsqvgnwgcg35z6ee2h3yczraddm72xrfua9uve2rlrm9deu7xyfzrcgqgn3qzsyvfkx26qkyypvr5hfx60h9w9k934lt8s2n6zc0wwtgqlulw7dythr83dqx8tzumg","payer_note":"thanks","recurrence_counter":1,"recurrence_label":"sub-1"},"id":1}`
+	resp := wrapResult(1, `{
+  "invoice": "lni1qqgz2d7u2smys9dc5q2447e8thjlgq3qqc3xu3s3rg94nj40zfsy866mhu5vxne6tcej5878k2mneuvgjy8s5predakx793pqfxv2rtqfajhp98c5tlsxxxkmzy0ntpzp2rtt9yum2495hqrq4wkj5pqqc3xu3s3rg94nj40zfsy866mhu5vxne6tcej5878k2mneuvgjy84yqucj6q9sggrnl24r93kfmdnatwpy72mxg7ygr9waxu0830kkpqx84pqs5x8a",
+  "changes": {
+    "description_appended": ", with oat milk",
+    "amount_msat": 12000
+  },
+  "next_period": {
+    "counter": 2,
+    "starttime": 1700000000,
+    "endtime": 1702592000,
+    "paywindow_start": 1700000000,
+    "paywindow_end": 1702592000
+  }
+}`)
+
+	lightning, requestQ, replyQ := startupServer(t)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	counter := uint64(1)
+	fetchReq := glightning.NewFetchInvoiceRequest("lno1qgsqvgnwgcg35z6ee2h3yczraddm72xrfua9uve2rlrm9deu7xyfzrcgqgn3qzsyvfkx26qkyypvr5hfx60h9w9k934lt8s2n6zc0wwtgqlulw7dythr83dqx8tzumg")
+	fetchReq.RecurrenceCounter = &counter
+	fetchReq.RecurrenceLabel = "sub-1"
+	fetchReq.PayerNote = "thanks"
+	result, err := lightning.FetchInvoice(fetchReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, &glightning.InvoiceChanges{
+		DescriptionAppended: ", with oat milk",
+		AmountMsat:          12000,
+	}, result.Changes)
+	assert.Equal(t, &glightning.RecurrenceNextPeriod{
+		Counter:        2,
+		StartTime:      1700000000,
+		EndTime:        1702592000,
+		PaywindowStart: 1700000000,
+		PaywindowEnd:   1702592000,
+	}, result.NextPeriod)
+
+	_, err = lightning.FetchInvoice(glightning.NewFetchInvoiceRequest(""))
+	assert.NotNil(t, err)
+}
+
+func TestInvoiceRequests(t *testing.T) {
+	lightning, requestQ, replyQ := startupServer(t)
+
+	req := `{"jsonrpc":"2.0","method":"invoicerequest","params":{"amount":"50000msat","description":"refund","label":"refund-7"},"id":1}`
+	go runServerSide(t, req, wrapResult(1, `{
+  "invreq_id": "bb3a6c0ee1b1d7e13e2e0ad0ebc5ba3cd46aa5ce28ba6bc2c5d3e1da0fd5be6f",
+  "active": true,
+  "single_use": true,
+  "bolt12": "lnr1qqgypua5g7rp293k00s66ayvnv26czst2d5k6urvv5s8getnw3gzqp3zderpzxstt8927ynqg044h0egcd8n5h3n9g0u0v4h8ncc3yg02gps7sjqtqssytfzxcs2xkdy0lml0tzy0jzugmyj8kjn8zfzrgq9fsgurc72x82e",
+  "used": false,
+  "label": "refund-7"
+}`), replyQ, requestQ)
+	irReq := glightning.NewInvoiceRequestRequest(glightning.NewMsat(50000), "refund")
+	irReq.Label = "refund-7"
+	created, err := lightning.CreateInvoiceRequest(irReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &glightning.Bolt12InvoiceRequest{
+		InvReqId:  "bb3a6c0ee1b1d7e13e2e0ad0ebc5ba3cd46aa5ce28ba6bc2c5d3e1da0fd5be6f",
+		Active:    true,
+		SingleUse: true,
+		Bolt12:    "lnr1qqgypua5g7rp293k00s66ayvnv26czst2d5k6urvv5s8getnw3gzqp3zderpzxstt8927ynqg044h0egcd8n5h3n9g0u0v4h8ncc3yg02gps7sjqtqssytfzxcs2xkdy0lml0tzy0jzugmyj8kjn8zfzrgq9fsgurc72x82e",
+		Label:     "refund-7",
+	}
+	assert.Equal(t, expected, created)
+
+	req = `{"jsonrpc":"2.0","method":"listinvoicerequests","params":{"invreq_id":"bb3a6c0ee1b1d7e13e2e0ad0ebc5ba3cd46aa5ce28ba6bc2c5d3e1da0fd5be6f"},"id":2}`
+	go runServerSide(t, req, wrapResult(2, `{
+  "invoicerequests": [
+    {
+      "invreq_id": "bb3a6c0ee1b1d7e13e2e0ad0ebc5ba3cd46aa5ce28ba6bc2c5d3e1da0fd5be6f",
+      "active": true,
+      "single_use": true,
+      "bolt12": "lnr1qqgypua5g7rp293k00s66ayvnv26czst2d5k6urvv5s8getnw3gzqp3zderpzxstt8927ynqg044h0egcd8n5h3n9g0u0v4h8ncc3yg02gps7sjqtqssytfzxcs2xkdy0lml0tzy0jzugmyj8kjn8zfzrgq9fsgurc72x82e",
+      "used": false,
+      "label": "refund-7"
+    }
+  ]
+}`), replyQ, requestQ)
+	found, err := lightning.GetInvoiceRequest(created.InvReqId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, expected, found)
+
+	req = `{"jsonrpc":"2.0","method":"sendinvoice","params":{"invreq":"lnr1qqgypua5g7rp293k00s66ayvnv26czst2d5k6urvv5s8getnw3gzqp3zderpzxstt8927ynqg044h0egcd8n5h3n9g0u0v4h8ncc3yg02gps7sjqtqssytfzxcs2xkdy0lml0tzy0jzugmyj8kjn8zfzrgq9fsgurc72x82e","label":"payout-7","timeout":30},"id":3}`
+	go runServerSide(t, req, wrapResult(3, `{
+  "label": "payout-7",
+  "description": "refund",
+  "payment_hash": "3b6ac4e2d3a4f1c2b6a4c0c4f2d3b1a0e9f8c7b6a5d4c3b2a1f0e9d8c7b6a5d4",
+  "status": "paid",
+  "expires_at": 1700007200,
+  "amount_msat": 50000,
+  "bolt12": "lni1qqgz2d7u2smys9dc5q2447e8thjlgq3qqc3xu3s3rg94nj40zfsy866mhu5vxne6tcej5878k2mneuvgjy8s5predakx793pqfxv2rtqfajhp98c5tlsxxxkmzy0ntpzp2rtt9yum2495hqrq4wkj5",
+  "pay_index": 4,
+  "amount_received_msat": 50000,
+  "paid_at": 1700000123,
+  "payment_preimage": "c907587348984baf0ae031b286bf1c9427abfa492b254aca67b6809fd9b58d7c"
+}`), replyQ, requestQ)
+	timeout := uint32(30)
+	sendReq := glightning.NewSendInvoiceRequest(found.Bolt12, "payout-7")
+	sendReq.Timeout = &timeout
+	invoice, err := lightning.SendInvoice(sendReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "paid", invoice.Status)
+	assert.Equal(t, uint64(50000), invoice.AmountReceivedMsat)
+	assert.Equal(t, uint64(1700000123), invoice.PaidAt)
+}
+
+func TestDecodeOffer(t *testing.T) {
+	req := `{"jsonrpc":"2.0","method":"decode","params":{"string":"lno1qgsqvgnwgcg35z6ee2h3yczraddm72xrfua9uve2rlrm9deu7xyfzrcgqgn3qzsyvfkx26qkyypvr5hfx60h9w9k934lt8s2n6zc0wwtgqlulw7dythr83dqx8tzumg"},"id":1}`
+	resp := wrapResult(1, `{
+  "type": "bolt12 offer",
+  "offer_id": "053a5c566fbea2681a5ff9c05a913da23e45b95d09ef5bd25d7d408f23da7084",
+  "offer_amount_msat": 10000,
+  "offer_description": "coffee",
+  "offer_issuer": "cafe",
+  "offer_recurrence": {
+    "time_unit": 2,
+    "time_unit_name": "days",
+    "period": 30,
+    "paywindow": {
+      "seconds_before": 60,
+      "seconds_after": 3600
+    }
+  },
+  "offer_issuer_id": "0266e4598d1d3c415f572a8488830b60f7e744ed9235eb0b1ba93283b315c03518",
+  "valid": true
+}`)
+
+	lightning, requestQ, replyQ := startupServer(t)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	result, err := lightning.Decode("lno1qgsqvgnwgcg35z6ee2h3yczraddm72xrfua9uve2rlrm9deu7xyfzrcgqgn3qzsyvfkx26qkyypvr5hfx60h9w9k934lt8s2n6zc0wwtgqlulw7dythr83dqx8tzumg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, &glightning.Decoded{
+		Type:             glightning.Bolt12OfferType,
+		Valid:            true,
+		OfferId:          "053a5c566fbea2681a5ff9c05a913da23e45b95d09ef5bd25d7d408f23da7084",
+		OfferAmountMsat:  10000,
+		OfferDescription: "coffee",
+		OfferIssuer:      "cafe",
+		OfferRecurrence: &glightning.OfferRecurrence{
+			TimeUnit:     2,
+			TimeUnitName: "days",
+			Period:       30,
+			Paywindow: &glightning.RecurrencePaywindow{
+				SecondsBefore: 60,
+				SecondsAfter:  3600,
+			},
+		},
+		OfferIssuerId: "0266e4598d1d3c415f572a8488830b60f7e744ed9235eb0b1ba93283b315c03518",
+	}, result)
+}
+
+func TestKeysend(t *testing.T) {
+	dest := "02e3cd7849f177a46f137ae3bfc1a08fc6a90bf4026c74f83c1ecc8430c282fe96"
+	req := `{"jsonrpc":"2.0","method":"keysend","params":{"amount_msat":10000,"destination":"02e3cd7849f177a46f137ae3bfc1a08fc6a90bf4026c74f83c1ecc8430c282fe96","extratlvs":{"34349334":"68656c6c6f","65537":"01"},"maxfee":"50msat","routehints":[[{"id":"03fb0b8a395a60084946eaf98cfb5a81ea010e0307eaf368ba21e7d6bcf0e4dc41","short_channel_id":"103x1x0","fee_base_msat":1000,"fee_proportional_millionths":10,"cltv_expiry_delta":6}]]},"id":1}`
+	resp := wrapResult(1, `{
+  "destination": "02e3cd7849f177a46f137ae3bfc1a08fc6a90bf4026c74f83c1ecc8430c282fe96",
+  "payment_hash": "3a9ee9a5b3bfed6ae5a2bd9dde2d0d64ff0cbb1c1d94bca3c6c5a83aa85bd5a5",
+  "created_at": 1700000000.123,
+  "parts": 1,
+  "amount_msat": 10000,
+  "amount_sent_msat": 10001,
+  "payment_preimage": "c907587348984baf0ae031b286bf1c9427abfa492b254aca67b6809fd9b58d7c",
+  "status": "complete"
+}`)
+
+	lightning, requestQ, replyQ := startupServer(t)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	ksReq := glightning.NewKeysendRequest(dest, glightning.NewMsat(10000))
+	ksReq.MaxFee = glightning.NewMsat(50).String()
+	ksReq.RouteHints = [][]*glightning.RouteHint{
+		[]*glightning.RouteHint{
+			&glightning.RouteHint{
+				Id:                        "03fb0b8a395a60084946eaf98cfb5a81ea010e0307eaf368ba21e7d6bcf0e4dc41",
+				ShortChannelId:            "103x1x0",
+				FeeBaseMsat:               1000,
+				FeeProportionalMillionths: 10,
+				CltvExpiryDelta:           6,
+			},
+		},
+	}
+	ksReq.AddTlv(34349334, []byte("hello"))
+	ksReq.AddTlv(65537, []byte{0x01})
+	result, err := lightning.Keysend(ksReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, &glightning.KeysendResult{
+		Destination:     dest,
+		PaymentHash:     "3a9ee9a5b3bfed6ae5a2bd9dde2d0d64ff0cbb1c1d94bca3c6c5a83aa85bd5a5",
+		CreatedAt:       1700000000.123,
+		Parts:           1,
+		AmountMsat:      10000,
+		AmountSentMsat:  10001,
+		PaymentPreimage: "c907587348984baf0ae031b286bf1c9427abfa492b254aca67b6809fd9b58d7c",
+		Status:          "complete",
+	}, result)
+
+	_, err = lightning.Keysend(glightning.NewKeysendRequest(dest, glightning.NewMsat(0)))
+	assert.NotNil(t, err)
+}
+
+func TestDatastore(t *testing.T) {
+	req := `{"jsonrpc":"2.0","method":"datastore","params":{"generation":3,"key":["myplugin","state"],"mode":"must-replace","string":"{}"},"id":1}`
+	resp := wrapResult(1, `{
+   "key": ["myplugin", "state"],
+   "generation": 4,
+   "hex": "7b7d",
+   "string": "{}"
+}`)
+
+	lightning, requestQ, replyQ := startupServer(t)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	dsReq := glightning.NewDatastoreStringRequest([]string{"myplugin", "state"}, "{}", glightning.DatastoreMustReplace)
+	result, err := lightning.Datastore(dsReq.IfGeneration(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &glightning.DatastoreEntry{
+		Key:        []string{"myplugin", "state"},
+		Generation: 4,
+		Hex:        "7b7d",
+		String:     "{}",
+	}, result)
+
+	req = `{"jsonrpc":"2.0","method":"listdatastore","params":{"key":["myplugin"]},"id":2}`
+	resp = wrapResult(2, `{
+   "datastore": [
+      {
+         "key": ["myplugin", "state"],
+         "generation": 4,
+         "hex": "7b7d",
+         "string": "{}"
+      }
+   ]
+}`)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	entries, err := lightning.ListDatastore([]string{"myplugin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []*glightning.DatastoreEntry{result}, entries)
+
+	_, err = lightning.Datastore(glightning.NewDatastoreStringRequest(nil, "x", glightning.DatastoreMustCreate))
+	assert.NotNil(t, err)
+}
+
+func TestListInvoicesPaged(t *testing.T) {
+	req := `{"jsonrpc":"2.0","method":"listinvoices","params":{"index":"updated","limit":2,"start":7},"id":1}`
+	resp := wrapResult(1, `{
+   "invoices": [
+      {
+         "label": "coffee",
+         "bolt11": "lnbcrt1coffee",
+         "payment_hash": "3a9ee9a5b3bfed6ae5a2bd9dde2d0d64ff0cbb1c1d94bca3c6c5a83aa85bd5a5",
+         "status": "paid",
+         "description": "a cup of coffee",
+         "expires_at": 1700003600,
+         "created_index": 3,
+         "updated_index": 7
+      }
+   ]
+}`)
+
+	lightning, requestQ, replyQ := startupServer(t)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	invoices, err := lightning.ListInvoicesPaged(glightning.IndexUpdated, 7, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, len(invoices))
+	assert.Equal(t, uint64(3), invoices[0].CreatedIndex)
+	assert.Equal(t, uint64(7), invoices[0].UpdatedIndex)
+}
+
+func TestIterateForwards(t *testing.T) {
+	lightning, requestQ, replyQ := startupServer(t)
+
+	req := `{"jsonrpc":"2.0","method":"listforwards","params":{"index":"created","limit":2,"start":1},"id":1}`
+	resp := wrapResult(1, `{
+   "forwards": [
+      {"in_channel": "103x1x0", "out_channel": "110x1x0", "status": "settled", "created_index": 1},
+      {"in_channel": "103x1x0", "out_channel": "110x1x0", "status": "failed", "created_index": 2}
+   ]
+}`)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+
+	it := lightning.IterateForwards(glightning.IndexCreated, 1, 2)
+	assert.True(t, it.Next())
+	assert.Equal(t, glightning.ForwardSettled, it.Forward().Status)
+	assert.True(t, it.Next())
+	assert.Equal(t, uint64(2), it.Forward().CreatedIndex)
+
+	req = `{"jsonrpc":"2.0","method":"listforwards","params":{"index":"created","limit":2,"start":3},"id":2}`
+	resp = wrapResult(2, `{
+   "forwards": [
+      {"in_channel": "103x1x0", "out_channel": "115x1x0", "status": "offered", "created_index": 5}
+   ]
+}`)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	assert.True(t, it.Next())
+	assert.Equal(t, "115x1x0", it.Forward().OutChannel)
+
+	// the short page was the last
+	assert.False(t, it.Next())
+	assert.Nil(t, it.Err())
+	assert.Equal(t, uint64(6), it.NextStart())
+}
+
+// lightningd versions without paging ignore the params, and
+// send everything back without indexes
+func TestIterateWithoutPaging(t *testing.T) {
+	lightning, requestQ, replyQ := startupServer(t)
+
+	req := `{"jsonrpc":"2.0","method":"listforwards","params":{"index":"created","limit":2},"id":1}`
+	resp := wrapResult(1, `{
+   "forwards": [
+      {"in_channel": "103x1x0", "out_channel": "110x1x0", "status": "settled"},
+      {"in_channel": "103x1x0", "out_channel": "110x1x0", "status": "failed"}
+   ]
+}`)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+
+	it := lightning.IterateForwards(glightning.IndexCreated, 0, 2)
+	assert.True(t, it.Next())
+	assert.True(t, it.Next())
+	assert.Equal(t, glightning.ForwardFailed, it.Forward().Status)
+	assert.False(t, it.Next())
+	assert.Nil(t, it.Err())
+
+	deleted := lightning.IterateInvoices(glightning.IndexDeleted, 0, 2)
+	assert.False(t, deleted.Next())
+	assert.Equal(t, "Can't iterate by the deleted index", deleted.Err().Error())
+}
+
+func TestWait(t *testing.T) {
+	req := `{"jsonrpc":"2.0","method":"wait","params":{"indexname":"created","nextvalue":4,"subsystem":"invoices"},"id":1}`
+	resp := wrapResult(1, `{
+   "subsystem": "invoices",
+   "created": 4,
+   "invoices": {
+      "status": "unpaid",
+      "label": "coffee",
+      "description": "a cup of coffee",
+      "bolt11": "lnbcrt1coffee"
+   }
+}`)
+
+	lightning, requestQ, replyQ := startupServer(t)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	result, err := lightning.Wait(glightning.WaitInvoices, glightning.IndexCreated, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := uint64(4)
+	assert.Equal(t, &created, result.Created)
+	assert.Nil(t, result.Updated)
+	assert.Equal(t, &glightning.WaitDetails{
+		Status:      "unpaid",
+		Label:       "coffee",
+		Description: "a cup of coffee",
+		Bolt11:      "lnbcrt1coffee",
+	}, result.Details())
+}
+
+func TestListForwardsFiltered(t *testing.T) {
+	req := `{"jsonrpc":"2.0","method":"listforwards","params":{"in_channel":"103x2x1","status":"local_failed"},"id":1}`
+	resp := wrapResult(1, `{
+   "forwards": [
+      {
+         "payment_hash": "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+         "in_channel": "103x2x1",
+         "out_channel": "110x1x0",
+         "in_msat": "100001001msat",
+         "status": "local_failed",
+         "failcode": 16392,
+         "failreason": "WIRE_PERMANENT_CHANNEL_FAILURE",
+         "received_time": 1560696343.052
+      }
+   ]
+}`)
+
+	lightning, requestQ, replyQ := startupServer(t)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	forwards, err := lightning.ListForwardsFiltered(glightning.ForwardLocalFailed, "103x2x1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, len(forwards))
+	assert.Equal(t, glightning.ForwardLocalFailed, forwards[0].Status)
+	assert.Equal(t, "110x1x0", forwards[0].OutChannel)
+}
+
+func TestListInvoicesForOffer(t *testing.T) {
+	req := `{"jsonrpc":"2.0","method":"listinvoices","params":{"offer_id":"8bd5ec7e8ab41e6c9f8ba0c2be8ac0d33c80fe5d6a2e1b0bc2d7e5b7d8c2f1a0"},"id":1}`
+	resp := wrapResult(1, `{
+   "invoices": [
+      {
+         "label": "offer-1",
+         "bolt12": "lni1qqgv5nalmz08ukj4av074kyk6pepq",
+         "local_offer_id": "8bd5ec7e8ab41e6c9f8ba0c2be8ac0d33c80fe5d6a2e1b0bc2d7e5b7d8c2f1a0",
+         "payment_hash": "3a9ee9a5b3bfed6ae5a2bd9dde2d0d64ff0cbb1c1d94bca3c6c5a83aa85bd5a5",
+         "status": "unpaid",
+         "description": "coffee",
+         "expires_at": 1700003600
+      }
+   ]
+}`)
+
+	lightning, requestQ, replyQ := startupServer(t)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	invoices, err := lightning.ListInvoicesForOffer("8bd5ec7e8ab41e6c9f8ba0c2be8ac0d33c80fe5d6a2e1b0bc2d7e5b7d8c2f1a0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, len(invoices))
+	assert.Equal(t, "lni1qqgv5nalmz08ukj4av074kyk6pepq", invoices[0].Bolt12)
+	assert.Equal(t, glightning.InvoiceUnpaid, invoices[0].Status)
+}
+
+func TestListPaysByStatus(t *testing.T) {
+	req := `{"jsonrpc":"2.0","method":"listpays","params":{"status":"failed"},"id":1}`
+	resp := wrapResult(1, `{
+   "pays": [
+      {
+         "bolt11": "lnbcrt1failed",
+         "payment_hash": "3d8705ad509bb52ee01047a4ced0cd4099da92507674e5452d19271f29df2993",
+         "status": "failed",
+         "amount_sent_msat": "0msat"
+      }
+   ]
+}`)
+
+	lightning, requestQ, replyQ := startupServer(t)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	pays, err := lightning.ListPaysByStatus(glightning.PaymentFailed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []glightning.PaymentFields{
+		glightning.PaymentFields{
+			Bolt11:                 "lnbcrt1failed",
+			PaymentHash:            "3d8705ad509bb52ee01047a4ced0cd4099da92507674e5452d19271f29df2993",
+			Status:                 "failed",
+			AmountSentMilliSatoshi: "0msat",
+		},
+	}, pays)
+}
+
+func TestCreateRune(t *testing.T) {
+	req := `{"jsonrpc":"2.0","method":"createrune","params":{"restrictions":[["method=listpeers","method=getinfo"],["pnameamountmsat\u003c10000"]]},"id":1}`
+	resp := wrapResult(1, `{
+   "rune": "zFMd1fjhrAYxUeFA54TjloZqOt8JrA_i_nYwIgXkag49MSZtZXRob2Q9bGlzdHBlZXJzfG1ldGhvZD1nZXRpbmZvJnBuYW1lYW1vdW50bXNhdDwxMDAwMA==",
+   "unique_id": "1"
+}`)
+
+	lightning, requestQ, replyQ := startupServer(t)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	result, err := lightning.CreateRune(
+		glightning.RuneAnyOf(glightning.RuneMethodIs("listpeers"), glightning.RuneMethodIs("getinfo")),
+		glightning.RuneAnyOf(glightning.RuneParam("amount_msat", glightning.RuneIntLessThan, "10000")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "1", result.UniqueId)
+	decoded, err := glightning.DecodeRune(result.Rune)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(decoded.Restrictions))
+
+	req = `{"jsonrpc":"2.0","method":"createrune","params":{"restrictions":[["time\u003c1700000000"]],"rune":"zFMd1fjhrAYxUeFA54TjloZqOt8JrA_i_nYwIgXkag49MA=="},"id":2}`
+	resp = wrapResult(2, `{
+   "rune": "wMtRlIJcFD_5ZkXTrjNInz7U0skh9IoRhM8nR0nZLq09MCZ0aW1lPDE3MDAwMDAwMDA=",
+   "unique_id": "0"
+}`)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	result, err = lightning.AddRuneRestrictions("zFMd1fjhrAYxUeFA54TjloZqOt8JrA_i_nYwIgXkag49MA==",
+		glightning.RuneAnyOf(glightning.RuneExpiresAt(1700000000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "0", result.UniqueId)
+}
+
+func TestShowRunes(t *testing.T) {
+	req := `{"jsonrpc":"2.0","method":"showrunes","params":{"rune":"zFMd1fjhrAYxUeFA54TjloZqOt8JrA_i_nYwIgXkag49MSZtZXRob2Q9bGlzdHBlZXJz"},"id":1}`
+	resp := wrapResult(1, `{
+   "runes": [
+      {
+         "rune": "zFMd1fjhrAYxUeFA54TjloZqOt8JrA_i_nYwIgXkag49MSZtZXRob2Q9bGlzdHBlZXJz",
+         "unique_id": "1",
+         "restrictions": [
+            {
+               "alternatives": [
+                  {
+                     "fieldname": "method",
+                     "value": "listpeers",
+                     "condition": "=",
+                     "english": "method equal to listpeers"
+                  }
+               ],
+               "english": "method equal to listpeers"
+            }
+         ],
+         "restrictions_as_english": "method equal to listpeers",
+         "stored": false,
+         "our_rune": true
+      }
+   ]
+}`)
+
+	lightning, requestQ, replyQ := startupServer(t)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	info, err := lightning.ShowRune("zFMd1fjhrAYxUeFA54TjloZqOt8JrA_i_nYwIgXkag49MSZtZXRob2Q9bGlzdHBlZXJz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, ours := false, true
+	assert.Equal(t, &glightning.RuneInfo{
+		Rune:     "zFMd1fjhrAYxUeFA54TjloZqOt8JrA_i_nYwIgXkag49MSZtZXRob2Q9bGlzdHBlZXJz",
+		UniqueId: "1",
+		Restrictions: []*glightning.RuneRestrictionInfo{
+			&glightning.RuneRestrictionInfo{
+				Alternatives: []*glightning.RuneAlternativeInfo{
+					&glightning.RuneAlternativeInfo{
+						FieldName: "method",
+						Value:     "listpeers",
+						Condition: glightning.RuneEqual,
+						English:   "method equal to listpeers",
+					},
+				},
+				English: "method equal to listpeers",
+			},
+		},
+		RestrictionsAsEnglish: "method equal to listpeers",
+		Stored:                &stored,
+		OurRune:               &ours,
+	}, info)
+}
+
+func TestCheckRune(t *testing.T) {
+	req := `{"jsonrpc":"2.0","method":"checkrune","params":{"method":"pay","nodeid":"02e3cd7849f177a46f137ae3bfc1a08fc6a90bf4026c74f83c1ecc8430c282fe96","params":{"bolt11":"lnbcrt1"},"rune":"zFMd1fjhrAYxUeFA54TjloZqOt8JrA_i_nYwIgXkag49MA=="},"id":1}`
+	resp := wrapResult(1, `{ "valid": true }`)
+
+	lightning, requestQ, replyQ := startupServer(t)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	valid, err := lightning.CheckRune("zFMd1fjhrAYxUeFA54TjloZqOt8JrA_i_nYwIgXkag49MA==",
+		"02e3cd7849f177a46f137ae3bfc1a08fc6a90bf4026c74f83c1ecc8430c282fe96",
+		"pay", map[string]string{"bolt11": "lnbcrt1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, valid)
+}
+
+func TestBlacklistRunes(t *testing.T) {
+	req := `{"jsonrpc":"2.0","method":"blacklistrune","params":{"end":5,"start":3},"id":1}`
+	resp := wrapResult(1, `{
+   "blacklist": [
+      { "start": 1, "end": 1 },
+      { "start": 3, "end": 5 }
+   ]
+}`)
+
+	lightning, requestQ, replyQ := startupServer(t)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	blacklist, err := lightning.BlacklistRunes(3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []*glightning.RuneIdRange{
+		&glightning.RuneIdRange{Start: 1, End: 1},
+		&glightning.RuneIdRange{Start: 3, End: 5},
+	}, blacklist)
+
+	_, err = lightning.BlacklistRunes(5, 3)
+	assert.NotNil(t, err)
+}
+
+func TestCommando(t *testing.T) {
+	req := `{"jsonrpc":"2.0","method":"commando","params":{"method":"listfunds","params":{},"peer_id":"02e3cd7849f177a46f137ae3bfc1a08fc6a90bf4026c74f83c1ecc8430c282fe96","rune":"zFMd1fjhrAYxUeFA54TjloZqOt8JrA_i_nYwIgXkag49MA=="},"id":1}`
+	resp := wrapResult(1, `{
+   "outputs": [],
+   "channels": []
+}`)
+
+	lightning, requestQ, replyQ := startupServer(t)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	var funds glightning.FundsResult
+	err := lightning.Commando("02e3cd7849f177a46f137ae3bfc1a08fc6a90bf4026c74f83c1ecc8430c282fe96",
+		"zFMd1fjhrAYxUeFA54TjloZqOt8JrA_i_nYwIgXkag49MA==", &glightning.ListFundsRequest{}, &funds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, len(funds.Outputs))
+}
+
+func TestRemoteLightning(t *testing.T) {
+	req := `{"jsonrpc":"2.0","method":"commando","params":{"method":"listpeers","params":{"id":"02e3cd7849f177a46f137ae3bfc1a08fc6a90bf4026c74f83c1ecc8430c282fe96"},"peer_id":"03a3ef6dd4d8bd2e4c6ff4cbd6ad7d36e3dc7a35a6b3bd7e25d8f1cd0d38c8d7f5","rune":"zFMd1fjhrAYxUeFA54TjloZqOt8JrA_i_nYwIgXkag49MA=="},"id":1}`
+	resp := wrapResult(1, `{
+   "peers": [
+      {
+         "id": "02e3cd7849f177a46f137ae3bfc1a08fc6a90bf4026c74f83c1ecc8430c282fe96",
+         "connected": true,
+         "netaddr": ["127.0.0.1:9735"],
+         "features": "88a0",
+         "channels": []
+      }
+   ]
+}`)
+
+	lightning, requestQ, replyQ := startupServer(t)
+	remote := glightning.NewRemoteLightning(lightning,
+		"03a3ef6dd4d8bd2e4c6ff4cbd6ad7d36e3dc7a35a6b3bd7e25d8f1cd0d38c8d7f5",
+		"zFMd1fjhrAYxUeFA54TjloZqOt8JrA_i_nYwIgXkag49MA==")
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	peer, err := remote.GetPeer("02e3cd7849f177a46f137ae3bfc1a08fc6a90bf4026c74f83c1ecc8430c282fe96")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, peer.Connected)
+	assert.True(t, remote.IsUp())
+}
+
+func TestListPeerChannels(t *testing.T) {
+	req := `{"jsonrpc":"2.0","method":"listpeerchannels","params":{"id":"022d223620a359a47ff7f7ac447c85c46c923da53389221a0054c11c1e3ca31d59"},"id":1}`
+	resp := wrapResult(1, `{
+   "channels": [
+      {
+         "peer_id": "022d223620a359a47ff7f7ac447c85c46c923da53389221a0054c11c1e3ca31d59",
+         "peer_connected": true,
+         "reestablished": true,
+         "channel_type": {
+            "bits": [12, 22],
+            "names": ["static_remotekey/even", "anchors/even"]
+         },
+         "updates": {
+            "local": { "htlc_minimum_msat": 0, "htlc_maximum_msat": 990000000, "cltv_expiry_delta": 6, "fee_base_msat": 1, "fee_proportional_millionths": 10 },
+            "remote": { "htlc_minimum_msat": 0, "htlc_maximum_msat": 990000000, "cltv_expiry_delta": 6, "fee_base_msat": 1, "fee_proportional_millionths": 10 }
+         },
+         "state": "CHANNELD_NORMAL",
+         "scratch_txid": "ece66657d7f6f8b5d4b5b8b0c6d8b8f5c6d7e8f9a0b1c2d3e4f5a6b7c8d9e0f1",
+         "feerate": { "perkw": 3750, "perkb": 15000 },
+         "owner": "channeld",
+         "short_channel_id": "103x1x0",
+         "direction": 1,
+         "channel_id": "252d1b0a1e57895e84137f28cf19ab2c35847e284c112fefdecc7afeaa5c1de7",
+         "funding_txid": "e71d5caafe7accdeef2f114c287e84352cab19cf287f13845e89571e0a1b2d25",
+         "funding_outnum": 0,
+         "close_to_addr": "bcrt1pqyp2pvzf5pqezkq8k2u8hzh4ydlcd9ddlu8e5ehc2cy3nnrqrh6s7el6an",
+         "close_to": "5120010415b049a041915807b2b87b8af5237f8695adff0f9a66f85609319cc01df5",
+         "private": false,
+         "opener": "local",
+         "alias": { "local": "5589325x1097399x44874", "remote": "16099329x13426950x62432" },
+         "features": ["option_static_remotekey", "option_anchors"],
+         "funding": {
+            "local_funds_msat": 1000000000,
+            "remote_funds_msat": 0,
+            "pushed_msat": 0
+         },
+         "to_us_msat": 989000000,
+         "min_to_us_msat": 989000000,
+         "max_to_us_msat": 1000000000,
+         "total_msat": 1000000000,
+         "fee_base_msat": 1,
+         "fee_proportional_millionths": 10,
+         "dust_limit_msat": 546000,
+         "max_total_htlc_in_msat": 18446744073709551615,
+         "their_reserve_msat": 10000000,
+         "our_reserve_msat": 10000000,
+         "spendable_msat": 973700000,
+         "receivable_msat": 1000000,
+         "minimum_htlc_in_msat": 0,
+         "minimum_htlc_out_msat": 0,
+         "maximum_htlc_out_msat": 990000000,
+         "their_to_self_delay": 5,
+         "our_to_self_delay": 5,
+         "max_accepted_htlcs": 483,
+         "state_changes": [
+            {
+               "timestamp": "2023-12-08T00:34:03.101Z",
+               "old_state": "CHANNELD_AWAITING_LOCKIN",
+               "new_state": "CHANNELD_NORMAL",
+               "cause": "user",
+               "message": "Lockin complete"
+            }
+         ],
+         "status": ["CHANNELD_NORMAL:Channel ready for use."],
+         "in_payments_offered": 0,
+         "in_offered_msat": 0,
+         "in_payments_fulfilled": 0,
+         "in_fulfilled_msat": 0,
+         "out_payments_offered": 1,
+         "out_offered_msat": 11000000,
+         "out_payments_fulfilled": 1,
+         "out_fulfilled_msat": 11000000,
+         "last_stable_connection": 1702000000,
+         "htlcs": [
+            {
+               "direction": "out",
+               "id": 1,
+               "amount_msat": 5000000,
+               "expiry": 131,
+               "payment_hash": "a5d6cdd3e1fa5a6d1b0e0f5c3b6e2d4a8c7f9e1d2b3c4a5f6e7d8c9b0a1f2e3d",
+               "state": "SENT_ADD_ACK_REVOCATION"
+            }
+         ]
+      }
+   ]
+}`)
+
+	lightning, requestQ, replyQ := startupServer(t)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	channels, err := lightning.GetPeerChannels("022d223620a359a47ff7f7ac447c85c46c923da53389221a0054c11c1e3ca31d59")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, len(channels))
+	ch := channels[0]
+	assert.True(t, ch.PeerConnected)
+	assert.Equal(t, "103x1x0", ch.ShortChannelId)
+	assert.Equal(t, glightning.ChannelSideLocal, ch.Opener)
+	assert.Equal(t, &glightning.ChannelFeerate{PerKw: 3750, PerKb: 15000}, ch.Feerate)
+	assert.Equal(t, uint64(1000000000), ch.Funding.LocalFundsMsat)
+	assert.Equal(t, uint64(989000000), ch.ToUsMsat)
+	assert.Equal(t, uint64(973700000), ch.SpendableMsat)
+	assert.Equal(t, uint64(18446744073709551615), ch.MaxTotalHtlcInMsat)
+	assert.Equal(t, "5589325x1097399x44874", ch.Alias.Local)
+	assert.Equal(t, []string{"static_remotekey/even", "anchors/even"}, ch.ChannelType.Names)
+	policy := &glightning.ChannelUpdatePolicy{
+		HtlcMaximumMsat:           990000000,
+		CltvExpiryDelta:           6,
+		FeeBaseMsat:               1,
+		FeeProportionalMillionths: 10,
+	}
+	assert.Equal(t, &glightning.ChannelUpdates{Local: policy, Remote: policy}, ch.Updates)
+	assert.Equal(t, glightning.CauseUser, ch.StateChanges[0].Cause)
+	assert.Equal(t, []*glightning.PeerChannelHtlc{
+		&glightning.PeerChannelHtlc{
+			Direction:   glightning.HtlcOut,
+			Id:          1,
+			AmountMsat:  5000000,
+			Expiry:      131,
+			PaymentHash: "a5d6cdd3e1fa5a6d1b0e0f5c3b6e2d4a8c7f9e1d2b3c4a5f6e7d8c9b0a1f2e3d",
+			State:       glightning.HtlcSentAddAckRevocation,
+		},
+	}, ch.Htlcs)
+}
+
+func TestListClosedChannels(t *testing.T) {
+	req := `{"jsonrpc":"2.0","method":"listclosedchannels","params":{},"id":1}`
+	resp := wrapResult(1, `{
+   "closedchannels": [
+      {
+         "peer_id": "022d223620a359a47ff7f7ac447c85c46c923da53389221a0054c11c1e3ca31d59",
+         "channel_id": "252d1b0a1e57895e84137f28cf19ab2c35847e284c112fefdecc7afeaa5c1de7",
+         "short_channel_id": "103x1x0",
+         "alias": { "local": "5589325x1097399x44874", "remote": "16099329x13426950x62432" },
+         "opener": "local",
+         "closer": "remote",
+         "private": false,
+         "channel_type": { "bits": [12, 22], "names": ["static_remotekey/even", "anchors/even"] },
+         "total_local_commitments": 4,
+         "total_remote_commitments": 4,
+         "total_htlcs_sent": 1,
+         "funding_txid": "e71d5caafe7accdeef2f114c287e84352cab19cf287f13845e89571e0a1b2d25",
+         "funding_outnum": 0,
+         "leased": false,
+         "total_msat": 1000000000,
+         "final_to_us_msat": 989000000,
+         "min_to_us_msat": 989000000,
+         "max_to_us_msat": 1000000000,
+         "last_commitment_txid": "d8d3f6e5c4b3a29180f7e6d5c4b3a29180f7e6d5c4b3a29180f7e6d5c4b3a291",
+         "last_commitment_fee_msat": 2896000,
+         "close_cause": "remote",
+         "last_stable_connection": 1702000000
+      }
+   ]
+}`)
+
+	lightning, requestQ, replyQ := startupServer(t)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	closed, err := lightning.ListClosedChannels("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []*glightning.ClosedChannel{
+		&glightning.ClosedChannel{
+			PeerId:         "022d223620a359a47ff7f7ac447c85c46c923da53389221a0054c11c1e3ca31d59",
+			ChannelId:      "252d1b0a1e57895e84137f28cf19ab2c35847e284c112fefdecc7afeaa5c1de7",
+			ShortChannelId: "103x1x0",
+			Alias: &glightning.ChannelAlias{
+				Local:  "5589325x1097399x44874",
+				Remote: "16099329x13426950x62432",
+			},
+			Opener: glightning.ChannelSideLocal,
+			Closer: glightning.ChannelSideRemote,
+			ChannelType: &glightning.ChannelType{
+				Bits:  []uint{12, 22},
+				Names: []string{"static_remotekey/even", "anchors/even"},
+			},
+			TotalLocalCommitments:  4,
+			TotalRemoteCommitments: 4,
+			TotalHtlcsSent:         1,
+			FundingTxId:            "e71d5caafe7accdeef2f114c287e84352cab19cf287f13845e89571e0a1b2d25",
+			TotalMsat:              1000000000,
+			FinalToUsMsat:          989000000,
+			MinToUsMsat:            989000000,
+			MaxToUsMsat:            1000000000,
+			LastCommitmentTxId:     "d8d3f6e5c4b3a29180f7e6d5c4b3a29180f7e6d5c4b3a29180f7e6d5c4b3a291",
+			LastCommitmentFeeMsat:  2896000,
+			CloseCause:             glightning.CauseRemote,
+			LastStableConnection:   1702000000,
+		},
+	}, closed)
+}
+
+func TestListHtlcs(t *testing.T) {
+	req := `{"jsonrpc":"2.0","method":"listhtlcs","params":{"id":"103x1x0"},"id":1}`
+	resp := wrapResult(1, `{
+   "htlcs": [
+      {
+         "short_channel_id": "103x1x0",
+         "id": 0,
+         "expiry": 117,
+         "amount_msat": 11000000,
+         "direction": "out",
+         "payment_hash": "3a9ee9a5b3bfed6ae5a2bd9dde2d0d64ff0cbb1c1d94bca3c6c5a83aa85bd5a5",
+         "state": "RCVD_REMOVE_ACK_REVOCATION"
+      },
+      {
+         "short_channel_id": "103x1x0",
+         "id": 0,
+         "expiry": 125,
+         "amount_msat": 5000000,
+         "direction": "in",
+         "payment_hash": "a5d6cdd3e1fa5a6d1b0e0f5c3b6e2d4a8c7f9e1d2b3c4a5f6e7d8c9b0a1f2e3d",
+         "state": "RCVD_ADD_ACK_REVOCATION"
+      }
+   ]
+}`)
+
+	lightning, requestQ, replyQ := startupServer(t)
+	go runServerSide(t, req, resp, replyQ, requestQ)
+	htlcs, err := lightning.ListHtlcs("103x1x0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, len(htlcs))
+	assert.Equal(t, glightning.HtlcOut, htlcs[0].Direction)
+	assert.Equal(t, glightning.HtlcRcvdRemoveAckRevocation, htlcs[0].State)
+	assert.Equal(t, uint64(11000000), htlcs[0].AmountMsat)
+	assert.Equal(t, glightning.HtlcIn, htlcs[1].Direction)
+	assert.Equal(t, glightning.HtlcRcvdAddAckRevocation, htlcs[1].State)
+	assert.Equal(t, uint32(125), htlcs[1].Expiry)
+}
+
 func TestConnect(t *testing.T) {
 	lightning, requestQ, replyQ := startupServer(t)
 
@@ -0,0 +1,102 @@
+package glightning
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// The chain parameters for one of the networks lightningd runs on
+type NetworkParams struct {
+	Name string
+	// The genesis block hash, as bitcoind displays it
+	GenesisHash string
+	// Human readable part of segwit addresses, eg "bc"
+	Bech32HRP string
+	// Version bytes of base58 addresses
+	PubKeyHashAddrId byte
+	ScriptHashAddrId byte
+	// What follows "ln" in a bolt11 invoice, eg "bc" for lnbc
+	InvoicePrefix string
+}
+
+var networks = map[string]*NetworkParams{
+	"bitcoin": {
+		Name:             "bitcoin",
+		GenesisHash:      "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f",
+		Bech32HRP:        "bc",
+		PubKeyHashAddrId: 0x00,
+		ScriptHashAddrId: 0x05,
+		InvoicePrefix:    "bc",
+	},
+	"testnet": {
+		Name:             "testnet",
+		GenesisHash:      "000000000933ea01ad0ee984209779baaec3ced90fa3f408719526f8d77f4943",
+		Bech32HRP:        "tb",
+		PubKeyHashAddrId: 0x6f,
+		ScriptHashAddrId: 0xc4,
+		InvoicePrefix:    "tb",
+	},
+	"testnet4": {
+		Name:             "testnet4",
+		GenesisHash:      "00000000da84f2bafbbc53dee25a72ae507ff4914b867c565be350b0da8bf043",
+		Bech32HRP:        "tb",
+		PubKeyHashAddrId: 0x6f,
+		ScriptHashAddrId: 0xc4,
+		InvoicePrefix:    "tb",
+	},
+	"signet": {
+		Name:             "signet",
+		GenesisHash:      "00000008819873e925422c1ff0f99f7cc9bbb232af63a077a480a3633bee1ef6",
+		Bech32HRP:        "tb",
+		PubKeyHashAddrId: 0x6f,
+		ScriptHashAddrId: 0xc4,
+		InvoicePrefix:    "tbs",
+	},
+	"regtest": {
+		Name:             "regtest",
+		GenesisHash:      "0f9188f13cb7b2c71f2a335e3a4fc328bf5beb436012afca590b1a11466e2206",
+		Bech32HRP:        "bcrt",
+		PubKeyHashAddrId: 0x6f,
+		ScriptHashAddrId: 0xc4,
+		InvoicePrefix:    "bcrt",
+	},
+	"litecoin": {
+		Name:             "litecoin",
+		GenesisHash:      "12a765e31ffd4059bada1e25190f6e98c99d9714d334efa41a195a7e7e04bfe2",
+		Bech32HRP:        "ltc",
+		PubKeyHashAddrId: 0x30,
+		ScriptHashAddrId: 0x32,
+		InvoicePrefix:    "ltc",
+	},
+	"litecoin-testnet": {
+		Name:             "litecoin-testnet",
+		GenesisHash:      "4966625a4b2851d9fdee139e56211a0d88575f59ed816ff5e6a63deb4e3e29a0",
+		Bech32HRP:        "tltc",
+		PubKeyHashAddrId: 0x6f,
+		ScriptHashAddrId: 0x3a,
+		InvoicePrefix:    "tltc",
+	},
+}
+
+func GetNetworkParams(network string) (*NetworkParams, error) {
+	params, ok := networks[network]
+	if !ok {
+		return nil, fmt.Errorf("Unknown network %s", network)
+	}
+	return params, nil
+}
+
+// The chain_hash used in lightning messages: the genesis
+// hash in its internal (little-endian) byte order, as hex
+func (n *NetworkParams) ChainHash() string {
+	b, _ := hex.DecodeString(n.GenesisHash)
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return hex.EncodeToString(b)
+}
+
+// The prefix of bolt11 invoices on this network, eg "lnbc"
+func (n *NetworkParams) Bolt11Prefix() string {
+	return "ln" + n.InvoicePrefix
+}
@@ -0,0 +1,273 @@
+package glightning
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// Options can be registered from the tagged fields of a struct,
+// which is filled in with their values at init. Fields can be a
+// string, bool, int (of any size), []string or []int. eg
+//
+//	type Options struct {
+//		FeeBase int      `option:"fee-base" description:"Base fee in msat" default:"1000" dynamic:"true"`
+//		Verbose bool     `option:"verbose" description:"Log more" type:"flag"`
+//		Peers   []string `option:"peer" description:"Peers to watch"`
+//	}
+//
+// Without a `default` tag, the field's value at registration is
+// the default. Values too big for a sized int field, eg an int8,
+// are refused, as are fractions for an int. `type` is only needed
+// to make a bool a flag; it's otherwise checked against the field.
+// `deprecated` is also read.
+//
+// If the struct implements OptionsValidator, it's checked once init
+// has set it, and the plugin's disabled if it's not valid. It's
+// checked again after each setconfig, which is refused (and undone)
+// if it's not.
+//
+// setconfig rewrites the fields of dynamic options while the plugin
+// runs, so read those with ReadOptions.
+type OptionsValidator interface {
+	Validate() error
+}
+
+type optionBinding struct {
+	option Option
+	field  reflect.Value
+}
+
+// Check that {value}, as the option's Set takes it, fits in the
+// struct field. Ints are narrowed to the field's size, eg int8
+func (b *optionBinding) check(value interface{}) error {
+	f, ok := value.(float64)
+	if !ok || !isIntKind(b.field.Kind()) {
+		return nil
+	}
+	if b.field.OverflowInt(int64(f)) {
+		return fmt.Errorf("Option `%s` can't be %v, it doesn't fit in a %s", b.option.GetName(), f, b.field.Type())
+	}
+	return nil
+}
+
+func isIntKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+// Copy the option's value into the struct field
+func (b *optionBinding) update() {
+	val := reflect.ValueOf(b.option.GetValue())
+	if !val.IsValid() {
+		return
+	}
+	b.field.Set(val.Convert(b.field.Type()))
+}
+
+// Register an option for each tagged field of {v}, which must
+// be a pointer to a struct.
+func (p *Plugin) RegisterOptions(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("Options must be a pointer to a struct, not %T", v)
+	}
+	elem := rv.Elem()
+	var bindings []*optionBinding
+	for i := 0; i < elem.NumField(); i++ {
+		sf := elem.Type().Field(i)
+		name := sf.Tag.Get("option")
+		if name == "" || name == "-" {
+			continue
+		}
+		if _, exists := p.options[name]; exists {
+			return fmt.Errorf("Option `%s` already registered", name)
+		}
+		field := elem.Field(i)
+		if !field.CanSet() {
+			return fmt.Errorf("Option `%s` is on unexported field %s", name, sf.Name)
+		}
+		option, err := newBoundOption(name, sf.Tag, field)
+		if err != nil {
+			return err
+		}
+		bindings = append(bindings, &optionBinding{option, field})
+	}
+
+	for _, b := range bindings {
+		p.options[b.option.GetName()] = b.option
+		if def := b.option.GetDefault(); def != nil {
+			b.field.Set(reflect.ValueOf(def).Convert(b.field.Type()))
+		}
+	}
+	p.bindings = append(p.bindings, bindings...)
+	if validator, ok := v.(OptionsValidator); ok {
+		p.validators = append(p.validators, validator)
+	}
+	return nil
+}
+
+func newBoundOption(name string, tag reflect.StructTag, field reflect.Value) (Option, error) {
+	desc := tag.Get("description")
+	def, hasDefault := tag.Lookup("default")
+
+	var option Option
+	var meta *OptionMeta
+	switch field.Kind() {
+	case reflect.String:
+		o := NewStringOption(name, desc, field.String())
+		if hasDefault {
+			o.Default = def
+		}
+		option, meta = o, &o.OptionMeta
+	case reflect.Bool:
+		o := NewBoolOption(name, desc, field.Bool())
+		o.isFlag = tag.Get("type") == string(_Flag)
+		if hasDefault {
+			b, err := strconv.ParseBool(def)
+			if err != nil {
+				return nil, fmt.Errorf("Option `%s` has a bad default %s: %s", name, def, err)
+			}
+			o.Default = b
+		}
+		option, meta = o, &o.OptionMeta
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		o := NewIntOption(name, desc, int(field.Int()))
+		if hasDefault {
+			i, err := strconv.Atoi(def)
+			if err != nil {
+				return nil, fmt.Errorf("Option `%s` has a bad default %s: %s", name, def, err)
+			}
+			if field.OverflowInt(int64(i)) {
+				return nil, fmt.Errorf("Option `%s` has a default %s that doesn't fit in a %s", name, def, field.Type())
+			}
+			o.Default = i
+		}
+		option, meta = o, &o.OptionMeta
+	case reflect.Slice:
+		if hasDefault {
+			return nil, fmt.Errorf("Option `%s` is a list, they can't have a default", name)
+		}
+		switch field.Type().Elem().Kind() {
+		case reflect.String:
+			o := NewStringListOption(name, desc)
+			option, meta = o, &o.OptionMeta
+		case reflect.Int:
+			o := NewIntListOption(name, desc)
+			option, meta = o, &o.OptionMeta
+		default:
+			return nil, fmt.Errorf("Option `%s` can't be a %s", name, field.Type())
+		}
+	default:
+		return nil, fmt.Errorf("Option `%s` can't be a %s", name, field.Type())
+	}
+
+	if typ, ok := tag.Lookup("type"); ok && typ != option.Type() {
+		return nil, fmt.Errorf("Option `%s` is a %s, not a %s", name, option.Type(), typ)
+	}
+	for key, flag := range map[string]*bool{"dynamic": &meta.Dynamic, "deprecated": &meta.Deprecated} {
+		val, ok := tag.Lookup(key)
+		if !ok {
+			continue
+		}
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return nil, fmt.Errorf("Option `%s` has a bad %s tag %s", name, key, val)
+		}
+		*flag = b
+	}
+	return option, nil
+}
+
+// Fill in the bound structs with the options set at init, and
+// check they're valid
+func (p *Plugin) bindOptions(set map[string]interface{}) error {
+	p.optionsMu.Lock()
+	for _, b := range p.bindings {
+		if _, ok := set[b.option.GetName()]; ok {
+			b.update()
+		}
+	}
+	p.optionsMu.Unlock()
+	return p.validateOptions()
+}
+
+func (p *Plugin) validateOptions() error {
+	for _, validator := range p.validators {
+		if err := validator.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Set {option} to {value} for setconfig, and copy it into any struct
+// it's bound to. If that leaves the struct invalid, the option and
+// struct go back to how they were. Called with the options locked
+func (p *Plugin) changeOption(option Option, value interface{}) error {
+	var saved reflect.Value
+	if p.isBound(option) {
+		// bound options are always one of ours, and a pointer
+		current := reflect.ValueOf(option).Elem()
+		saved = reflect.New(current.Type()).Elem()
+		saved.Set(current)
+	}
+	if err := p.setOption(option, value); err != nil {
+		return err
+	}
+	if !saved.IsValid() {
+		return nil
+	}
+	p.rebindOption(option)
+	if err := p.validateOptions(); err != nil {
+		reflect.ValueOf(option).Elem().Set(saved)
+		p.rebindOption(option)
+		return err
+	}
+	return nil
+}
+
+func (p *Plugin) isBound(option Option) bool {
+	for _, b := range p.bindings {
+		if b.option == option {
+			return true
+		}
+	}
+	return false
+}
+
+// Check {value} fits any struct field {option}'s bound to,
+// before it's set
+func (p *Plugin) checkBinding(option Option, value interface{}) error {
+	for _, b := range p.bindings {
+		if b.option != option {
+			continue
+		}
+		if err := b.check(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Called with the options locked
+func (p *Plugin) rebindOption(option Option) {
+	for _, b := range p.bindings {
+		if b.option == option {
+			b.update()
+		}
+	}
+}
+
+// Runs {fn} with the options locked against setconfig, so it can
+// read the fields of structs passed to RegisterOptions. GetOption
+// and friends lock the options themselves, and don't need it; don't
+// call them from {fn}.
+func (p *Plugin) ReadOptions(fn func()) {
+	p.optionsMu.RLock()
+	defer p.optionsMu.RUnlock()
+	fn()
+}
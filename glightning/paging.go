@@ -0,0 +1,181 @@
+package glightning
+
+import (
+	"fmt"
+)
+
+// The paging shared by the iterators
+type pageIterator struct {
+	index    ListIndex
+	next     uint64
+	pageSize uint32
+	count    int
+	pos      int
+	done     bool
+	err      error
+	// fetch a page starting at {start}, returning how many records it has
+	fetch func(start uint64) (int, error)
+	// the {index} value of the i'th record of the page
+	indexAt func(i int) uint64
+}
+
+func newPageIterator(index ListIndex, start uint64, pageSize uint32) pageIterator {
+	if pageSize == 0 {
+		pageSize = 100
+	}
+	it := pageIterator{
+		index:    index,
+		next:     start,
+		pageSize: pageSize,
+		pos:      -1,
+	}
+	// deleted records are gone, there's nothing to page through
+	if index != IndexCreated && index != IndexUpdated {
+		it.err = fmt.Errorf("Can't iterate by the %s index", index)
+	}
+	return it
+}
+
+// Move to the next record, fetching the next page if need be.
+// Returns false once there are no more, or there's an error
+func (it *pageIterator) Next() bool {
+	it.pos++
+	if it.pos < it.count {
+		return true
+	}
+	if it.done || it.err != nil {
+		return false
+	}
+
+	start := it.next
+	n, err := it.fetch(start)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	it.count, it.pos = n, 0
+	// a short page is the last one. A long one, or one without
+	// indexes, means lightningd doesn't page and we've had everything
+	if n != int(it.pageSize) {
+		it.done = true
+	}
+	if n == 0 {
+		return false
+	}
+	last := it.indexAt(n - 1)
+	if last == 0 {
+		it.done = true
+		return true
+	}
+	it.next = last + 1
+	if it.next <= start {
+		it.done = true
+	}
+	return true
+}
+
+// The error that stopped the iteration, if any
+func (it *pageIterator) Err() error {
+	return it.err
+}
+
+// The {index} value to start from to carry on after the records
+// seen so far, eg after a restart
+func (it *pageIterator) NextStart() uint64 {
+	return it.next
+}
+
+func pickIndex(index ListIndex, created, updated uint64) uint64 {
+	if index == IndexUpdated {
+		return updated
+	}
+	return created
+}
+
+// Iterators go through invoices, payments or forwards a page at a
+// time, so they never all have to be in memory at once. eg
+//
+//	it := lightning.IterateInvoices(glightning.IndexCreated, 0, 100)
+//	for it.Next() {
+//		inv := it.Invoice()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+//
+// Iterating by IndexUpdated goes through records in the order they
+// last changed, so starting from a saved NextStart picks up
+// everything that's changed since. IndexDeleted can't be iterated
+// by; Err says so.
+type InvoiceIterator struct {
+	pageIterator
+	page []*Invoice
+}
+
+// Iterate through invoices from {start} of {index}, fetching
+// {pageSize} at a time
+func (l *Lightning) IterateInvoices(index ListIndex, start uint64, pageSize uint32) *InvoiceIterator {
+	it := &InvoiceIterator{pageIterator: newPageIterator(index, start, pageSize)}
+	it.fetch = func(start uint64) (int, error) {
+		var err error
+		it.page, err = l.ListInvoicesPaged(it.index, start, it.pageSize)
+		return len(it.page), err
+	}
+	it.indexAt = func(i int) uint64 {
+		return pickIndex(it.index, it.page[i].CreatedIndex, it.page[i].UpdatedIndex)
+	}
+	return it
+}
+
+func (it *InvoiceIterator) Invoice() *Invoice {
+	return it.page[it.pos]
+}
+
+type SendPayIterator struct {
+	pageIterator
+	page []SendPayFields
+}
+
+// Iterate through payment parts from {start} of {index}, fetching
+// {pageSize} at a time
+func (l *Lightning) IterateSendPays(index ListIndex, start uint64, pageSize uint32) *SendPayIterator {
+	it := &SendPayIterator{pageIterator: newPageIterator(index, start, pageSize)}
+	it.fetch = func(start uint64) (int, error) {
+		var err error
+		it.page, err = l.ListSendPaysPaged(it.index, start, it.pageSize)
+		return len(it.page), err
+	}
+	it.indexAt = func(i int) uint64 {
+		return pickIndex(it.index, it.page[i].CreatedIndex, it.page[i].UpdatedIndex)
+	}
+	return it
+}
+
+func (it *SendPayIterator) SendPay() *SendPayFields {
+	return &it.page[it.pos]
+}
+
+type ForwardIterator struct {
+	pageIterator
+	page []Forwarding
+}
+
+// Iterate through forwards from {start} of {index}, fetching
+// {pageSize} at a time
+func (l *Lightning) IterateForwards(index ListIndex, start uint64, pageSize uint32) *ForwardIterator {
+	it := &ForwardIterator{pageIterator: newPageIterator(index, start, pageSize)}
+	it.fetch = func(start uint64) (int, error) {
+		var err error
+		it.page, err = l.ListForwardsPaged(it.index, start, it.pageSize)
+		return len(it.page), err
+	}
+	it.indexAt = func(i int) uint64 {
+		return pickIndex(it.index, it.page[i].CreatedIndex, it.page[i].UpdatedIndex)
+	}
+	return it
+}
+
+func (it *ForwardIterator) Forward() *Forwarding {
+	return &it.page[it.pos]
+}
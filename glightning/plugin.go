@@ -2,15 +2,23 @@ package glightning
 
 import (
 	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/niftynei/glightning/jrpc2"
 	"io"
 	"log"
+	"math"
 	"os"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Subscription string
@@ -31,6 +39,25 @@ const (
 	_OpenChannel    Hook         = "openchannel"
 	_HtlcAccepted   Hook         = "htlc_accepted"
 	_RpcCommand     Hook         = "rpc_command"
+
+	_CustomMsg              Hook = "custommsg"
+	_OnionMessageRecv       Hook = "onion_message_recv"
+	_OnionMessageRecvSecret Hook = "onion_message_recv_secret"
+	_CommitmentRevocation   Hook = "commitment_revocation"
+
+	_OpenChannel2        Hook = "openchannel2"
+	_OpenChannel2Changed Hook = "openchannel2_changed"
+	_OpenChannel2Sign    Hook = "openchannel2_sign"
+	_RbfChannel          Hook = "rbf_channel"
+
+	_ChannelStateChanged Subscription = "channel_state_changed"
+	_CoinMovement        Subscription = "coin_movement"
+	_BalanceSnapshot     Subscription = "balance_snapshot"
+	_BlockAdded          Subscription = "block_added"
+	_OpenChannelPeerSigs Subscription = "openchannel_peer_sigs"
+	_ChannelOpenFailed   Subscription = "channel_open_failed"
+	_InvoiceCreation     Subscription = "invoice_creation"
+	_Shutdown            Subscription = "shutdown"
 )
 
 var lightningMethodRegistry map[string]*jrpc2.Method
@@ -39,8 +66,10 @@ var lightningMethodRegistry map[string]*jrpc2.Method
 //   the cryptographic handshake. The parameters have the following structure if
 //   there is a channel with the peer:
 type PeerConnectedEvent struct {
-	Peer PeerEvent `json:"peer"`
-	hook func(*PeerConnectedEvent) (*PeerConnectedResponse, error)
+	Peer     PeerEvent `json:"peer"`
+	hook     func(*PeerConnectedEvent) (*PeerConnectedResponse, error)
+	plugin   *Plugin
+	deferred *Deferred
 }
 
 type PeerEvent struct {
@@ -62,7 +91,8 @@ type PeerConnectedResponse struct {
 
 func (pc *PeerConnectedEvent) New() interface{} {
 	return &PeerConnectedEvent{
-		hook: pc.hook,
+		hook:   pc.hook,
+		plugin: pc.plugin,
 	}
 }
 
@@ -71,7 +101,14 @@ func (pc *PeerConnectedEvent) Name() string {
 }
 
 func (pc *PeerConnectedEvent) Call() (jrpc2.Result, error) {
-	return pc.hook(pc)
+	resp, err := pc.hook(pc)
+	return hookResult(pc.Name(), pc.deferred, resp, err)
+}
+
+// Respond to this hook later, via the returned handle. See Plugin.Defer
+func (pc *PeerConnectedEvent) Defer(key string, timeout time.Duration, fallback *PeerConnectedResponse) *Deferred {
+	pc.deferred = pc.plugin.Defer(key, timeout, fallback)
+	return pc.deferred
 }
 
 func (pc *PeerConnectedEvent) Continue() *PeerConnectedResponse {
@@ -149,13 +186,16 @@ type InvoicePaymentResponse struct {
 }
 
 type InvoicePaymentEvent struct {
-	Payment Payment `json:"payment"`
-	hook    func(*InvoicePaymentEvent) (*InvoicePaymentResponse, error)
+	Payment  Payment `json:"payment"`
+	hook     func(*InvoicePaymentEvent) (*InvoicePaymentResponse, error)
+	plugin   *Plugin
+	deferred *Deferred
 }
 
 func (ip *InvoicePaymentEvent) New() interface{} {
 	return &InvoicePaymentEvent{
-		hook: ip.hook,
+		hook:   ip.hook,
+		plugin: ip.plugin,
 	}
 }
 
@@ -164,7 +204,14 @@ func (ip *InvoicePaymentEvent) Name() string {
 }
 
 func (ip *InvoicePaymentEvent) Call() (jrpc2.Result, error) {
-	return ip.hook(ip)
+	resp, err := ip.hook(ip)
+	return hookResult(ip.Name(), ip.deferred, resp, err)
+}
+
+// Respond to this hook later, via the returned handle. See Plugin.Defer
+func (ip *InvoicePaymentEvent) Defer(key string, timeout time.Duration, fallback *InvoicePaymentResponse) *Deferred {
+	ip.deferred = ip.plugin.Defer(key, timeout, fallback)
+	return ip.deferred
 }
 
 func (ip *InvoicePaymentEvent) Continue() *InvoicePaymentResponse {
@@ -182,6 +229,8 @@ func (ip *InvoicePaymentEvent) Fail(failureCode uint16) *InvoicePaymentResponse
 type OpenChannelEvent struct {
 	OpenChannel OpenChannel `json:"openchannel"`
 	hook        func(*OpenChannelEvent) (*OpenChannelResponse, error)
+	plugin      *Plugin
+	deferred    *Deferred
 }
 
 type OpenChannel struct {
@@ -214,7 +263,8 @@ type OpenChannelResponse struct {
 
 func (oc *OpenChannelEvent) New() interface{} {
 	return &OpenChannelEvent{
-		hook: oc.hook,
+		hook:   oc.hook,
+		plugin: oc.plugin,
 	}
 }
 
@@ -223,7 +273,14 @@ func (oc *OpenChannelEvent) Name() string {
 }
 
 func (oc *OpenChannelEvent) Call() (jrpc2.Result, error) {
-	return oc.hook(oc)
+	resp, err := oc.hook(oc)
+	return hookResult(oc.Name(), oc.deferred, resp, err)
+}
+
+// Respond to this hook later, via the returned handle. See Plugin.Defer
+func (oc *OpenChannelEvent) Defer(key string, timeout time.Duration, fallback *OpenChannelResponse) *Deferred {
+	oc.deferred = oc.plugin.Defer(key, timeout, fallback)
+	return oc.deferred
 }
 
 func (oc *OpenChannelEvent) Reject(errorMessage string) *OpenChannelResponse {
@@ -247,8 +304,10 @@ func (oc *OpenChannelEvent) ContinueWithCloseTo(address string) *OpenChannelResp
 }
 
 type RpcCommandEvent struct {
-	Cmd  RpcCmd `json:"rpc_command"`
-	hook func(*RpcCommandEvent) (*RpcCommandResponse, error)
+	Cmd      RpcCmd `json:"rpc_command"`
+	hook     func(*RpcCommandEvent) (*RpcCommandResponse, error)
+	plugin   *Plugin
+	deferred *Deferred
 }
 
 type RpcCmd struct {
@@ -262,7 +321,8 @@ type RpcCmd struct {
 
 func (rc *RpcCommandEvent) New() interface{} {
 	return &RpcCommandEvent{
-		hook: rc.hook,
+		hook:   rc.hook,
+		plugin: rc.plugin,
 	}
 }
 
@@ -271,7 +331,14 @@ func (rc *RpcCommandEvent) Name() string {
 }
 
 func (rc *RpcCommandEvent) Call() (jrpc2.Result, error) {
-	return rc.hook(rc)
+	resp, err := rc.hook(rc)
+	return hookResult(rc.Name(), rc.deferred, resp, err)
+}
+
+// Respond to this hook later, via the returned handle. See Plugin.Defer
+func (rc *RpcCommandEvent) Defer(key string, timeout time.Duration, fallback *RpcCommandResponse) *Deferred {
+	rc.deferred = rc.plugin.Defer(key, timeout, fallback)
+	return rc.deferred
 }
 
 func (r *RpcCmd) Id() (*jrpc2.Id, error) {
@@ -410,9 +477,11 @@ func (rc *RpcCommandEvent) ReturnError(errMsg string, errCode int) (*RpcCommandR
 //   may see the same HTLC again during startup. It is therefore paramount that the
 //   plugin is idempotent if it talks to an external system.
 type HtlcAcceptedEvent struct {
-	Onion Onion     `json:"onion"`
-	Htlc  HtlcOffer `json:"htlc"`
-	hook  func(*HtlcAcceptedEvent) (*HtlcAcceptedResponse, error)
+	Onion    Onion     `json:"onion"`
+	Htlc     HtlcOffer `json:"htlc"`
+	hook     func(*HtlcAcceptedEvent) (*HtlcAcceptedResponse, error)
+	plugin   *Plugin
+	deferred *Deferred
 }
 
 type Onion struct {
@@ -467,7 +536,8 @@ type HtlcAcceptedResponse struct {
 
 func (ha *HtlcAcceptedEvent) New() interface{} {
 	return &HtlcAcceptedEvent{
-		hook: ha.hook,
+		hook:   ha.hook,
+		plugin: ha.plugin,
 	}
 }
 
@@ -476,7 +546,16 @@ func (ha *HtlcAcceptedEvent) Name() string {
 }
 
 func (ha *HtlcAcceptedEvent) Call() (jrpc2.Result, error) {
-	return ha.hook(ha)
+	resp, err := ha.hook(ha)
+	return hookResult(ha.Name(), ha.deferred, resp, err)
+}
+
+// Respond to this hook later, via the returned handle. Useful for
+// holding an htlc until some external condition is met, without tying
+// up the hook. See Plugin.Defer
+func (ha *HtlcAcceptedEvent) Defer(key string, timeout time.Duration, fallback *HtlcAcceptedResponse) *Deferred {
+	ha.deferred = ha.plugin.Defer(key, timeout, fallback)
+	return ha.deferred
 }
 
 func (ha *HtlcAcceptedEvent) Continue() *HtlcAcceptedResponse {
@@ -506,6 +585,235 @@ func (ha *HtlcAcceptedEvent) Resolve(paymentKey string) *HtlcAcceptedResponse {
 	}
 }
 
+// The `custommsg` hook is called whenever a peer sends us a message
+// with a type that lightningd doesn't handle itself (odd types,
+// outside of the internally used ranges). Send messages back with
+// Lightning.SendCustomMessage
+type CustomMsgEvent struct {
+	PeerId string `json:"peer_id"`
+	// hex, includes the 2-byte message type
+	Payload  string `json:"payload"`
+	hook     func(*CustomMsgEvent) (*CustomMsgResponse, error)
+	plugin   *Plugin
+	deferred *Deferred
+}
+
+type _CustomMsgResult string
+
+const _CmContinue _CustomMsgResult = "continue"
+
+type CustomMsgResponse struct {
+	Result _CustomMsgResult `json:"result"`
+}
+
+func (cm *CustomMsgEvent) New() interface{} {
+	return &CustomMsgEvent{
+		hook:   cm.hook,
+		plugin: cm.plugin,
+	}
+}
+
+func (cm *CustomMsgEvent) Name() string {
+	return string(_CustomMsg)
+}
+
+func (cm *CustomMsgEvent) Call() (jrpc2.Result, error) {
+	resp, err := cm.hook(cm)
+	return hookResult(cm.Name(), cm.deferred, resp, err)
+}
+
+// Respond to this hook later, via the returned handle. See Plugin.Defer
+func (cm *CustomMsgEvent) Defer(key string, timeout time.Duration, fallback *CustomMsgResponse) *Deferred {
+	cm.deferred = cm.plugin.Defer(key, timeout, fallback)
+	return cm.deferred
+}
+
+// The message type, ie the first two bytes of the payload
+func (cm *CustomMsgEvent) MessageType() (uint16, error) {
+	payload, err := hex.DecodeString(cm.Payload)
+	if err != nil {
+		return 0, err
+	}
+	if len(payload) < 2 {
+		return 0, fmt.Errorf("Payload too short for a message type: %s", cm.Payload)
+	}
+	return binary.BigEndian.Uint16(payload[:2]), nil
+}
+
+func (cm *CustomMsgEvent) Continue() *CustomMsgResponse {
+	return &CustomMsgResponse{
+		Result: _CmContinue,
+	}
+}
+
+// An incoming onion message, for either of the onion_message_recv hooks.
+// Only the fields included in the message are set; the tlv
+// fields are left as hex.
+type OnionMessage struct {
+	// Only for onion_message_recv_secret
+	PathSecret       string              `json:"pathsecret"`
+	ReplyBlindedPath *BlindedPath        `json:"reply_blindedpath"`
+	InvoiceRequest   string              `json:"invoice_request"`
+	Invoice          string              `json:"invoice"`
+	InvoiceError     string              `json:"invoice_error"`
+	UnknownFields    []OnionMessageField `json:"unknown_fields"`
+}
+
+type BlindedPath struct {
+	FirstNodeId  string `json:"first_node_id"`
+	FirstScid    string `json:"first_scid"`
+	FirstScidDir uint   `json:"first_scid_dir"`
+	FirstPathKey string `json:"first_path_key"`
+	// Older versions call the path key the 'blinding'
+	Blinding string        `json:"blinding"`
+	Hops     []*BlindedHop `json:"hops"`
+}
+
+type BlindedHop struct {
+	BlindedNodeId          string `json:"blinded_node_id"`
+	EncryptedRecipientData string `json:"encrypted_recipient_data"`
+}
+
+type OnionMessageField struct {
+	Number uint64 `json:"number"`
+	Value  string `json:"value"`
+}
+
+type _OnionMessageResult string
+
+const _OmContinue _OnionMessageResult = "continue"
+
+type OnionMessageResponse struct {
+	Result _OnionMessageResult `json:"result"`
+}
+
+// The `onion_message_recv` hook is called for onion messages sent
+// to us that didn't come in over a blinded path we created.
+type OnionMessageRecvEvent struct {
+	OnionMessage OnionMessage `json:"onion_message"`
+	hook         func(*OnionMessageRecvEvent) (*OnionMessageResponse, error)
+	plugin       *Plugin
+	deferred     *Deferred
+}
+
+func (om *OnionMessageRecvEvent) New() interface{} {
+	return &OnionMessageRecvEvent{
+		hook:   om.hook,
+		plugin: om.plugin,
+	}
+}
+
+func (om *OnionMessageRecvEvent) Name() string {
+	return string(_OnionMessageRecv)
+}
+
+func (om *OnionMessageRecvEvent) Call() (jrpc2.Result, error) {
+	resp, err := om.hook(om)
+	return hookResult(om.Name(), om.deferred, resp, err)
+}
+
+// Respond to this hook later, via the returned handle. See Plugin.Defer
+func (om *OnionMessageRecvEvent) Defer(key string, timeout time.Duration, fallback *OnionMessageResponse) *Deferred {
+	om.deferred = om.plugin.Defer(key, timeout, fallback)
+	return om.deferred
+}
+
+func (om *OnionMessageRecvEvent) Continue() *OnionMessageResponse {
+	return &OnionMessageResponse{
+		Result: _OmContinue,
+	}
+}
+
+// The `onion_message_recv_secret` hook is called for onion messages
+// that came in over a blinded path we created. The OnionMessage's
+// PathSecret says which one.
+type OnionMessageRecvSecretEvent struct {
+	OnionMessage OnionMessage `json:"onion_message"`
+	hook         func(*OnionMessageRecvSecretEvent) (*OnionMessageResponse, error)
+	plugin       *Plugin
+	deferred     *Deferred
+}
+
+func (om *OnionMessageRecvSecretEvent) New() interface{} {
+	return &OnionMessageRecvSecretEvent{
+		hook:   om.hook,
+		plugin: om.plugin,
+	}
+}
+
+func (om *OnionMessageRecvSecretEvent) Name() string {
+	return string(_OnionMessageRecvSecret)
+}
+
+func (om *OnionMessageRecvSecretEvent) Call() (jrpc2.Result, error) {
+	resp, err := om.hook(om)
+	return hookResult(om.Name(), om.deferred, resp, err)
+}
+
+// Respond to this hook later, via the returned handle. See Plugin.Defer
+func (om *OnionMessageRecvSecretEvent) Defer(key string, timeout time.Duration, fallback *OnionMessageResponse) *Deferred {
+	om.deferred = om.plugin.Defer(key, timeout, fallback)
+	return om.deferred
+}
+
+func (om *OnionMessageRecvSecretEvent) Continue() *OnionMessageResponse {
+	return &OnionMessageResponse{
+		Result: _OmContinue,
+	}
+}
+
+// The `commitment_revocation` hook is called whenever a channel
+// state is updated and the old state revoked. The penalty tx
+// spends the revoked commitment, should it ever be broadcast;
+// hand it to a watchtower.
+type CommitmentRevocationEvent struct {
+	CommitmentTxId string `json:"commitment_txid"`
+	PenaltyTx      string `json:"penalty_tx"`
+	ChannelId      string `json:"channel_id"`
+	CommitNum      uint64 `json:"commitnum"`
+	hook           func(*CommitmentRevocationEvent) (*CommitmentRevocationResponse, error)
+	plugin         *Plugin
+	deferred       *Deferred
+}
+
+type _CommitmentRevocationResult string
+
+const _CrContinue _CommitmentRevocationResult = "continue"
+
+type CommitmentRevocationResponse struct {
+	Result _CommitmentRevocationResult `json:"result"`
+}
+
+func (cr *CommitmentRevocationEvent) New() interface{} {
+	return &CommitmentRevocationEvent{
+		hook:   cr.hook,
+		plugin: cr.plugin,
+	}
+}
+
+func (cr *CommitmentRevocationEvent) Name() string {
+	return string(_CommitmentRevocation)
+}
+
+func (cr *CommitmentRevocationEvent) Call() (jrpc2.Result, error) {
+	resp, err := cr.hook(cr)
+	return hookResult(cr.Name(), cr.deferred, resp, err)
+}
+
+// Respond to this hook later, via the returned handle. Useful for
+// holding on until a watchtower has acknowledged the penalty tx.
+// See Plugin.Defer
+func (cr *CommitmentRevocationEvent) Defer(key string, timeout time.Duration, fallback *CommitmentRevocationResponse) *Deferred {
+	cr.deferred = cr.plugin.Defer(key, timeout, fallback)
+	return cr.deferred
+}
+
+func (cr *CommitmentRevocationEvent) Continue() *CommitmentRevocationResponse {
+	return &CommitmentRevocationResponse{
+		Result: _CrContinue,
+	}
+}
+
 type ConnectEvent struct {
 	PeerId  string  `json:"id"`
 	Address Address `json:"address"`
@@ -691,6 +999,250 @@ func (e *SendPayFailureEvent) Call() (jrpc2.Result, error) {
 	return nil, nil
 }
 
+type ChannelStateChanged struct {
+	PeerId         string `json:"peer_id"`
+	ChannelId      string `json:"channel_id"`
+	ShortChannelId string `json:"short_channel_id"`
+	Timestamp      string `json:"timestamp"`
+	// Empty for a channel's first state
+	OldState string `json:"old_state"`
+	NewState string `json:"new_state"`
+	// One of "unknown", "local", "user", "remote",
+	// "protocol" or "onchain"
+	Cause   string `json:"cause"`
+	Message string `json:"message"`
+}
+
+type ChannelStateChangedEvent struct {
+	ChannelStateChanged *ChannelStateChanged `json:"channel_state_changed"`
+	cb                  func(*ChannelStateChanged)
+}
+
+func (e *ChannelStateChangedEvent) Name() string {
+	return string(_ChannelStateChanged)
+}
+
+func (e *ChannelStateChangedEvent) New() interface{} {
+	return &ChannelStateChangedEvent{
+		cb: e.cb,
+	}
+}
+
+func (e *ChannelStateChangedEvent) Call() (jrpc2.Result, error) {
+	e.cb(e.ChannelStateChanged)
+	return nil, nil
+}
+
+type CoinMovementType string
+
+const (
+	ChainMovement   CoinMovementType = "chain_mvt"
+	ChannelMovement CoinMovementType = "channel_mvt"
+)
+
+// A change to one of the node's accounts. Chain movements have
+// the txid/utxo fields set, channel movements the payment ones.
+type CoinMovement struct {
+	Version            uint             `json:"version"`
+	NodeId             string           `json:"node_id"`
+	Type               CoinMovementType `json:"type"`
+	AccountId          string           `json:"account_id"`
+	OriginatingAccount string           `json:"originating_account"`
+	TxId               string           `json:"txid"`
+	UtxoTxId           string           `json:"utxo_txid"`
+	Vout               uint32           `json:"vout"`
+	PaymentHash        string           `json:"payment_hash"`
+	PartId             uint64           `json:"part_id"`
+	GroupId            uint64           `json:"group_id"`
+	CreditMsat         uint64           `json:"credit_msat"`
+	DebitMsat          uint64           `json:"debit_msat"`
+	OutputMsat         uint64           `json:"output_msat"`
+	OutputCount        uint32           `json:"output_count"`
+	FeesMsat           uint64           `json:"fees_msat"`
+	Tags               []string         `json:"tags"`
+	BlockHeight        uint32           `json:"blockheight"`
+	Timestamp          uint64           `json:"timestamp"`
+	CoinType           string           `json:"coin_type"`
+}
+
+type CoinMovementEvent struct {
+	CoinMovement *CoinMovement `json:"coin_movement"`
+	cb           func(*CoinMovement)
+}
+
+func (e *CoinMovementEvent) Name() string {
+	return string(_CoinMovement)
+}
+
+func (e *CoinMovementEvent) New() interface{} {
+	return &CoinMovementEvent{
+		cb: e.cb,
+	}
+}
+
+func (e *CoinMovementEvent) Call() (jrpc2.Result, error) {
+	e.cb(e.CoinMovement)
+	return nil, nil
+}
+
+type BalanceSnapshot struct {
+	NodeId      string            `json:"node_id"`
+	BlockHeight uint32            `json:"blockheight"`
+	Timestamp   uint64            `json:"timestamp"`
+	Accounts    []*AccountBalance `json:"accounts"`
+}
+
+type AccountBalance struct {
+	AccountId   string `json:"account_id"`
+	BalanceMsat uint64 `json:"balance_msat"`
+	CoinType    string `json:"coin_type"`
+}
+
+type BalanceSnapshotEvent struct {
+	BalanceSnapshot *BalanceSnapshot `json:"balance_snapshot"`
+	cb              func(*BalanceSnapshot)
+}
+
+func (e *BalanceSnapshotEvent) Name() string {
+	return string(_BalanceSnapshot)
+}
+
+func (e *BalanceSnapshotEvent) New() interface{} {
+	return &BalanceSnapshotEvent{
+		cb: e.cb,
+	}
+}
+
+func (e *BalanceSnapshotEvent) Call() (jrpc2.Result, error) {
+	e.cb(e.BalanceSnapshot)
+	return nil, nil
+}
+
+type BlockAdded struct {
+	Hash   string `json:"hash"`
+	Height uint32 `json:"height"`
+}
+
+type BlockAddedEvent struct {
+	Block *BlockAdded `json:"block_added"`
+	cb    func(*BlockAdded)
+}
+
+func (e *BlockAddedEvent) Name() string {
+	return string(_BlockAdded)
+}
+
+func (e *BlockAddedEvent) New() interface{} {
+	return &BlockAddedEvent{
+		cb: e.cb,
+	}
+}
+
+func (e *BlockAddedEvent) Call() (jrpc2.Result, error) {
+	e.cb(e.Block)
+	return nil, nil
+}
+
+type OpenChannelPeerSigs struct {
+	ChannelId string `json:"channel_id"`
+	// base64, with the peer's signatures on their inputs
+	SignedPsbt string `json:"signed_psbt"`
+}
+
+type OpenChannelPeerSigsEvent struct {
+	PeerSigs *OpenChannelPeerSigs `json:"openchannel_peer_sigs"`
+	cb       func(*OpenChannelPeerSigs)
+}
+
+func (e *OpenChannelPeerSigsEvent) Name() string {
+	return string(_OpenChannelPeerSigs)
+}
+
+func (e *OpenChannelPeerSigsEvent) New() interface{} {
+	return &OpenChannelPeerSigsEvent{
+		cb: e.cb,
+	}
+}
+
+func (e *OpenChannelPeerSigsEvent) Call() (jrpc2.Result, error) {
+	e.cb(e.PeerSigs)
+	return nil, nil
+}
+
+type ChannelOpenFailed struct {
+	ChannelId string `json:"channel_id"`
+}
+
+type ChannelOpenFailedEvent struct {
+	ChannelOpenFailed *ChannelOpenFailed `json:"channel_open_failed"`
+	cb                func(*ChannelOpenFailed)
+}
+
+func (e *ChannelOpenFailedEvent) Name() string {
+	return string(_ChannelOpenFailed)
+}
+
+func (e *ChannelOpenFailedEvent) New() interface{} {
+	return &ChannelOpenFailedEvent{
+		cb: e.cb,
+	}
+}
+
+func (e *ChannelOpenFailedEvent) Call() (jrpc2.Result, error) {
+	e.cb(e.ChannelOpenFailed)
+	return nil, nil
+}
+
+type InvoiceCreation struct {
+	Label    string `json:"label"`
+	PreImage string `json:"preimage"`
+	// Unset for 'any' amount invoices
+	MilliSatoshis uint64 `json:"msat"`
+}
+
+type InvoiceCreationEvent struct {
+	InvoiceCreation *InvoiceCreation `json:"invoice_creation"`
+	cb              func(*InvoiceCreation)
+}
+
+func (e *InvoiceCreationEvent) Name() string {
+	return string(_InvoiceCreation)
+}
+
+func (e *InvoiceCreationEvent) New() interface{} {
+	return &InvoiceCreationEvent{
+		cb: e.cb,
+	}
+}
+
+func (e *InvoiceCreationEvent) Call() (jrpc2.Result, error) {
+	e.cb(e.InvoiceCreation)
+	return nil, nil
+}
+
+// Sent when lightningd is shutting down, or the plugin's been
+// stopped with `plugin stop`. Every plugin subscribes to it, so
+// lightningd waits (briefly) for the plugin to exit by itself,
+// rather than killing it outright. See OnShutdown.
+type ShutdownEvent struct {
+	plugin *Plugin
+}
+
+func (e *ShutdownEvent) Name() string {
+	return string(_Shutdown)
+}
+
+func (e *ShutdownEvent) New() interface{} {
+	return &ShutdownEvent{
+		plugin: e.plugin,
+	}
+}
+
+func (e *ShutdownEvent) Call() (jrpc2.Result, error) {
+	e.plugin.shutdown()
+	return nil, nil
+}
+
 type WarnEvent struct {
 	Warning Warning `json:"warning"`
 	cb      func(*Warning)
@@ -736,11 +1288,41 @@ type Option interface {
 	Type() string
 }
 
+// Properties shared by all the option types
+type OptionMeta struct {
+	// Can be changed while lightningd's running, with `setconfig`.
+	// Read its value with GetOption and friends, or within
+	// ReadOptions, rather than from the option itself
+	Dynamic    bool
+	Deprecated bool
+	// Called with the new value, before it's set at init or by
+	// setconfig. Return an error to refuse it.
+	Validate func(value interface{}) error
+	// Called after a dynamic option's been changed by setconfig
+	OnChange func(o Option)
+}
+
+func (m *OptionMeta) meta() *OptionMeta {
+	return m
+}
+
+func (m *OptionMeta) check(value interface{}) error {
+	if m.Validate == nil {
+		return nil
+	}
+	return m.Validate(value)
+}
+
+type hasMeta interface {
+	meta() *OptionMeta
+}
+
 type StringOption struct {
 	Name        string
 	description string
 	Default     string
 	Val         string
+	OptionMeta
 }
 
 type IntOption struct {
@@ -748,6 +1330,7 @@ type IntOption struct {
 	description string
 	Default     int
 	Val         int
+	OptionMeta
 }
 
 type BoolOption struct {
@@ -756,6 +1339,24 @@ type BoolOption struct {
 	Default     bool
 	Val         bool
 	isFlag      bool
+	OptionMeta
+}
+
+// An option that can be given more than once. They
+// start out empty; there's no default.
+type StringListOption struct {
+	Name        string
+	description string
+	Val         []string
+	OptionMeta
+}
+
+// An int option that can be given more than once
+type IntListOption struct {
+	Name        string
+	description string
+	Val         []int
+	OptionMeta
 }
 
 func (o *StringOption) Type() string {
@@ -778,6 +1379,9 @@ func (o *StringOption) Set(value interface{}) error {
 	if !ok {
 		return fmt.Errorf("Got value %v for option %s, not a string", value, o.Name)
 	}
+	if err := o.check(val); err != nil {
+		return err
+	}
 	o.Val = val
 	return nil
 }
@@ -813,6 +1417,9 @@ func (o *BoolOption) Set(value interface{}) error {
 	if !ok {
 		return fmt.Errorf("Got value %v for option %s, not a boolean", value, o.Name)
 	}
+	if err := o.check(val); err != nil {
+		return err
+	}
 	o.Val = val
 	return nil
 }
@@ -832,9 +1439,12 @@ func (o *IntOption) Type() string {
 func (o *IntOption) Set(value interface{}) error {
 	// all incoming json numbers are parsed as floats
 	val, ok := value.(float64)
-	if !ok {
+	if !ok || val != math.Trunc(val) {
 		return fmt.Errorf("Got value %v for option %s, not an int", value, o.Name)
 	}
+	if err := o.check(int(val)); err != nil {
+		return err
+	}
 	o.Val = int(val)
 	return nil
 }
@@ -858,76 +1468,194 @@ func (o *IntOption) GetName() string {
 	return o.Name
 }
 
-func NewOption(name, desc, defaultValue string) *StringOption {
-	return NewStringOption(name, desc, defaultValue)
+func (o *StringListOption) Type() string {
+	return string(_String)
 }
 
-func NewStringOption(name, description, defaultValue string) *StringOption {
-	return &StringOption{
-		Name:        name,
-		Default:     defaultValue,
-		description: description,
-	}
+func (o *StringListOption) GetDefault() interface{} {
+	return nil
 }
 
-func NewBoolOption(name, description string, defaultValue bool) *BoolOption {
-	return &BoolOption{
-		Name:        name,
-		Default:     defaultValue,
-		description: description,
+func (o *StringListOption) GetDesc() string {
+	if o.description != "" {
+		return o.description
 	}
+	return _defaultDesc
 }
 
-func NewIntOption(name, description string, defaultValue int) *IntOption {
-	return &IntOption{
-		Name:        name,
-		Default:     defaultValue,
-		description: description,
+// Takes every value for the option at once, as a list
+func (o *StringListOption) Set(value interface{}) error {
+	vals, err := listValue(value)
+	if err != nil {
+		return fmt.Errorf("Got value %v for option %s, %s", value, o.Name, err)
+	}
+	list := make([]string, len(vals))
+	for i, v := range vals {
+		val, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("Got value %v for option %s, not a string", v, o.Name)
+		}
+		list[i] = val
+	}
+	if err := o.check(list); err != nil {
+		return err
 	}
+	o.Val = list
+	return nil
 }
 
-func (o *StringOption) MarshalJSON() ([]byte, error) {
-	return json.Marshal(&struct {
-		Name        string      `json:"name"`
-		Type        string      `json:"type"`
-		Default     interface{} `json:"default"`
-		Description string      `json:"description"`
-		Category    string      `json:"category,omitempty"`
-	}{
-		Name:        o.GetName(),
-		Type:        o.Type(),
-		Default:     o.GetDefault(),
-		Description: o.GetDesc(),
-	})
+func (o *StringListOption) GetName() string {
+	return o.Name
+}
+
+func (o *StringListOption) GetValue() interface{} {
+	return o.Val
+}
+
+func (o *IntListOption) Type() string {
+	return string(_Int)
+}
+
+func (o *IntListOption) GetDefault() interface{} {
+	return nil
+}
+
+func (o *IntListOption) GetDesc() string {
+	if o.description != "" {
+		return o.description
+	}
+	return _defaultDesc
+}
+
+// Takes every value for the option at once, as a list
+func (o *IntListOption) Set(value interface{}) error {
+	vals, err := listValue(value)
+	if err != nil {
+		return fmt.Errorf("Got value %v for option %s, %s", value, o.Name, err)
+	}
+	list := make([]int, len(vals))
+	for i, v := range vals {
+		// all incoming json numbers are parsed as floats
+		val, ok := v.(float64)
+		if !ok || val != math.Trunc(val) {
+			return fmt.Errorf("Got value %v for option %s, not an int", v, o.Name)
+		}
+		list[i] = int(val)
+	}
+	if err := o.check(list); err != nil {
+		return err
+	}
+	o.Val = list
+	return nil
+}
+
+func (o *IntListOption) GetName() string {
+	return o.Name
+}
+
+func (o *IntListOption) GetValue() interface{} {
+	return o.Val
+}
+
+// lightningd passes multi options as a list, but
+// we'll take a single value too
+func listValue(value interface{}) ([]interface{}, error) {
+	switch v := value.(type) {
+	case []interface{}:
+		return v, nil
+	case []string:
+		vals := make([]interface{}, len(v))
+		for i := range v {
+			vals[i] = v[i]
+		}
+		return vals, nil
+	case nil:
+		return nil, errors.New("not a list")
+	default:
+		return []interface{}{v}, nil
+	}
+}
+
+func NewOption(name, desc, defaultValue string) *StringOption {
+	return NewStringOption(name, desc, defaultValue)
+}
+
+func NewStringOption(name, description, defaultValue string) *StringOption {
+	return &StringOption{
+		Name:        name,
+		Default:     defaultValue,
+		description: description,
+	}
+}
+
+func NewBoolOption(name, description string, defaultValue bool) *BoolOption {
+	return &BoolOption{
+		Name:        name,
+		Default:     defaultValue,
+		description: description,
+	}
+}
+
+func NewIntOption(name, description string, defaultValue int) *IntOption {
+	return &IntOption{
+		Name:        name,
+		Default:     defaultValue,
+		description: description,
+	}
+}
+
+func NewStringListOption(name, description string) *StringListOption {
+	return &StringListOption{
+		Name:        name,
+		description: description,
+	}
+}
+
+func NewIntListOption(name, description string) *IntListOption {
+	return &IntListOption{
+		Name:        name,
+		description: description,
+	}
+}
+
+func (o *StringOption) MarshalJSON() ([]byte, error) {
+	return marshalOption(o, &o.OptionMeta, false)
 }
 
 func (o *BoolOption) MarshalJSON() ([]byte, error) {
-	return json.Marshal(&struct {
-		Name        string      `json:"name"`
-		Type        string      `json:"type"`
-		Default     interface{} `json:"default"`
-		Description string      `json:"description"`
-		Category    string      `json:"category,omitempty"`
-	}{
-		Name:        o.GetName(),
-		Type:        o.Type(),
-		Default:     o.GetDefault(),
-		Description: o.GetDesc(),
-	})
+	return marshalOption(o, &o.OptionMeta, false)
 }
 
 func (o *IntOption) MarshalJSON() ([]byte, error) {
+	return marshalOption(o, &o.OptionMeta, false)
+}
+
+func (o *StringListOption) MarshalJSON() ([]byte, error) {
+	return marshalOption(o, &o.OptionMeta, true)
+}
+
+func (o *IntListOption) MarshalJSON() ([]byte, error) {
+	return marshalOption(o, &o.OptionMeta, true)
+}
+
+func marshalOption(o Option, meta *OptionMeta, multi bool) ([]byte, error) {
 	return json.Marshal(&struct {
 		Name        string      `json:"name"`
 		Type        string      `json:"type"`
-		Default     interface{} `json:"default"`
+		Default     interface{} `json:"default,omitempty"`
 		Description string      `json:"description"`
 		Category    string      `json:"category,omitempty"`
+		Dynamic     bool        `json:"dynamic,omitempty"`
+		Multi       bool        `json:"multi,omitempty"`
+		Deprecated  bool        `json:"deprecated,omitempty"`
 	}{
 		Name:        o.GetName(),
 		Type:        o.Type(),
 		Default:     o.GetDefault(),
 		Description: o.GetDesc(),
+		Dynamic:     meta.Dynamic,
+		Multi:       multi,
+		Deprecated:  meta.Deprecated,
 	})
 }
 
@@ -1002,12 +1730,87 @@ func (fb *FeatureBits) AreSet() bool {
 }
 
 type Manifest struct {
-	Options       []Option     `json:"options"`
-	RpcMethods    []*RpcMethod `json:"rpcmethods"`
-	Dynamic       bool         `json:"dynamic"`
-	Subscriptions []string     `json:"subscriptions,omitempty"`
-	Hooks         []Hook       `json:"hooks,omitempty"`
-	FeatureBits   *FeatureBits `json:"featurebits,omitempty"`
+	Options       []Option       `json:"options"`
+	RpcMethods    []*RpcMethod   `json:"rpcmethods"`
+	Dynamic       bool           `json:"dynamic"`
+	Subscriptions []string       `json:"subscriptions,omitempty"`
+	Hooks         []ManifestHook `json:"hooks,omitempty"`
+	FeatureBits   *FeatureBits   `json:"featurebits,omitempty"`
+	// Custom notification topics this plugin emits
+	Notifications []NotificationTopic `json:"notifications,omitempty"`
+	// Set if the plugin can't run; lightningd disables it
+	Disable string `json:"disable,omitempty"`
+}
+
+type NotificationTopic struct {
+	Method string `json:"method"`
+}
+
+// How the plugin's registered for a hook. Listed by name only,
+// unless it has options.
+type ManifestHook struct {
+	Name Hook `json:"name"`
+	*HookOptions
+}
+
+func (mh ManifestHook) MarshalJSON() ([]byte, error) {
+	if mh.HookOptions == nil {
+		return json.Marshal(mh.Name)
+	}
+	type alias ManifestHook
+	return json.Marshal(alias(mh))
+}
+
+// Where this plugin's hook goes in the chain, relative to other
+// plugins registered for the same hook, and which calls it's
+// interested in. Plugins are named by their filename, eg
+// "funder" or "mypluginbinary"
+type HookOptions struct {
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+	// Only supported for custommsg and rpc_command. See
+	// MessageTypeFilters and MethodFilters
+	Filters []HookFilter `json:"filters,omitempty"`
+}
+
+// Narrows down which calls a hook gets. Either a
+// MessageTypeFilter or a MethodFilter
+type HookFilter interface {
+	filterFor() Hook
+}
+
+// A custommsg message type
+type MessageTypeFilter uint16
+
+// An rpc_command command name
+type MethodFilter string
+
+func (f MessageTypeFilter) filterFor() Hook {
+	return _CustomMsg
+}
+
+func (f MethodFilter) filterFor() Hook {
+	return _RpcCommand
+}
+
+// Filters for the custommsg hook: only call it for
+// these message types
+func MessageTypeFilters(msgTypes ...uint16) []HookFilter {
+	filters := make([]HookFilter, len(msgTypes))
+	for i, msgType := range msgTypes {
+		filters[i] = MessageTypeFilter(msgType)
+	}
+	return filters
+}
+
+// Filters for the rpc_command hook: only call it for
+// these commands
+func MethodFilters(methods ...string) []HookFilter {
+	filters := make([]HookFilter, len(methods))
+	for i, method := range methods {
+		filters[i] = MethodFilter(method)
+	}
+	return filters
 }
 
 func (gm GetManifestMethod) Name() string {
@@ -1017,7 +1820,8 @@ func (gm GetManifestMethod) Name() string {
 // Don't include 'built-in' methods in manifest list
 func isBuiltInMethod(name string) bool {
 	return name == "getmanifest" ||
-		name == "init"
+		name == "init" ||
+		name == "setconfig"
 }
 
 // Builds the manifest object that's returned from the
@@ -1041,9 +1845,12 @@ func (gm GetManifestMethod) Call() (jrpc2.Result, error) {
 	for i, sub := range gm.plugin.subscriptions {
 		m.Subscriptions[i] = sub
 	}
-	m.Hooks = make([]Hook, len(gm.plugin.hooks))
+	m.Hooks = make([]ManifestHook, len(gm.plugin.hooks))
 	for i, hook := range gm.plugin.hooks {
-		m.Hooks[i] = hook
+		m.Hooks[i] = ManifestHook{hook, gm.plugin.hookOptions[hook]}
+	}
+	for _, topic := range gm.plugin.topics {
+		m.Notifications = append(m.Notifications, NotificationTopic{topic})
 	}
 
 	m.Dynamic = gm.plugin.dynamic
@@ -1056,20 +1863,107 @@ func (gm GetManifestMethod) Call() (jrpc2.Result, error) {
 	}
 	m.FeatureBits = gm.plugin.features
 
+	if gm.plugin.manifestCheck != nil {
+		if err := gm.plugin.manifestCheck(gm.plugin); err != nil {
+			m.Disable = err.Error()
+		}
+	}
 	return m, nil
 }
 
 type Config struct {
-	LightningDir string       `json:"lightning-dir"`
-	RpcFile      string       `json:"rpc-file"`
-	Startup      bool         `json:"startup,omitempty"`
-	Network      string       `json:"network,omitempty"`
-	Features     *FeatureBits `json:"feature_set,omitempty"`
+	LightningDir   string        `json:"lightning-dir"`
+	RpcFile        string        `json:"rpc-file"`
+	Startup        bool          `json:"startup,omitempty"`
+	Network        string        `json:"network,omitempty"`
+	Features       *FeatureBits  `json:"feature_set,omitempty"`
+	Proxy          *ProxyAddress `json:"proxy,omitempty"`
+	TorV3Enabled   bool          `json:"torv3-enabled,omitempty"`
+	AlwaysUseProxy bool          `json:"always_use_proxy,omitempty"`
+	// Anything else lightningd sent in the configuration,
+	// eg fields added by newer versions
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+type ProxyAddress struct {
+	Type    string `json:"type"`
+	Address string `json:"address"`
+	Port    uint16 `json:"port"`
+}
+
+func (c *Config) UnmarshalJSON(data []byte) error {
+	type config Config
+	var known config
+	if err := json.Unmarshal(data, &known); err != nil {
+		return err
+	}
+	var extra map[string]json.RawMessage
+	if err := json.Unmarshal(data, &extra); err != nil {
+		return err
+	}
+	for _, key := range jsonKeys(reflect.TypeOf(known)) {
+		delete(extra, key)
+	}
+	*c = Config(known)
+	if len(extra) > 0 {
+		c.Extra = extra
+	}
+	return nil
+}
+
+func (c *Config) MarshalJSON() ([]byte, error) {
+	type config Config
+	data, err := json.Marshal((*config)(c))
+	if err != nil || len(c.Extra) == 0 {
+		return data, err
+	}
+	var all map[string]json.RawMessage
+	if err = json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	for key, value := range c.Extra {
+		if _, known := all[key]; !known {
+			all[key] = value
+		}
+	}
+	return json.Marshal(all)
+}
+
+// Unmarshal one of the Extra fields into {v}
+func (c *Config) GetExtra(key string, v interface{}) error {
+	value, ok := c.Extra[key]
+	if !ok {
+		return fmt.Errorf("No %s in the configuration", key)
+	}
+	return json.Unmarshal(value, v)
+}
+
+// The parameters for the network lightningd's running on
+func (c *Config) NetworkParams() (*NetworkParams, error) {
+	return GetNetworkParams(c.Network)
+}
+
+// The json field names of a struct type
+func jsonKeys(t reflect.Type) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if tag != "" && tag != "-" {
+			keys = append(keys, tag)
+		}
+	}
+	return keys
+}
+
+// What a plugin sends back from `init` when it can't run, eg
+// because it was given a bad option. lightningd will stop it.
+type InitResponse struct {
+	Disable string `json:"disable"`
 }
 
 type InitMethod struct {
 	Options       json.RawMessage `json:"options"`
-	Configuration *Config         `json:"configuration"`
+	Configuration json.RawMessage `json:"configuration"`
 	plugin        *Plugin
 }
 
@@ -1097,30 +1991,145 @@ func (im InitMethod) Call() (jrpc2.Result, error) {
 	if err != nil {
 		return nil, err
 	}
-	// flesh out the options!
-	for name, value := range opts {
-		option, exists := im.plugin.options[name]
-		if !exists {
-			log.Printf("No option %s registered on this plugin", name)
-			continue
-		}
-		opt := option
-		err := opt.Set(value)
-		if err != nil {
+	var config *Config
+	if len(im.Configuration) > 0 {
+		config = new(Config)
+		if err = json.Unmarshal(im.Configuration, config); err != nil {
 			return nil, err
 		}
 	}
+	// flesh out the options!
+	if err := im.plugin.setOptions(opts); err != nil {
+		return &InitResponse{Disable: err.Error()}, nil
+	}
+	if err := im.plugin.bindOptions(opts); err != nil {
+		return &InitResponse{Disable: err.Error()}, nil
+	}
 	// stash the config...
-	im.plugin.Config = im.Configuration
+	im.plugin.Config = config
 	im.plugin.initialized = true
 
 	// call init hook
-	im.plugin.initFn(im.plugin, im.plugin.getOptionSet(), im.Configuration)
+	err = im.plugin.initFn(im.plugin, im.plugin.getOptionSet(), config)
+	if err != nil {
+		im.plugin.initialized = false
+		return &InitResponse{Disable: err.Error()}, nil
+	}
 
 	// Result of `init` is currently discarded by c-lightning
 	return "ok", nil
 }
 
+func (p *Plugin) setOptions(opts map[string]interface{}) error {
+	p.optionsMu.Lock()
+	defer p.optionsMu.Unlock()
+	for name, value := range opts {
+		option, exists := p.options[name]
+		if !exists {
+			log.Printf("No option %s registered on this plugin", name)
+			continue
+		}
+		if err := p.setOption(option, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Called with the options locked
+func (p *Plugin) setOption(option Option, value interface{}) error {
+	if err := p.checkBinding(option, value); err != nil {
+		return err
+	}
+	return option.Set(value)
+}
+
+// lightningd calls `setconfig` on the plugin when one of its
+// dynamic options is changed at runtime
+type SetConfigMethod struct {
+	Config string          `json:"config"`
+	Val    json.RawMessage `json:"val"`
+	plugin *Plugin
+}
+
+func NewSetConfigRpcMethod(p *Plugin) *RpcMethod {
+	return &RpcMethod{
+		Method: &SetConfigMethod{
+			plugin: p,
+		},
+	}
+}
+
+func (sc *SetConfigMethod) New() interface{} {
+	return &SetConfigMethod{
+		plugin: sc.plugin,
+	}
+}
+
+func (sc *SetConfigMethod) Name() string {
+	return "setconfig"
+}
+
+func (sc *SetConfigMethod) Call() (jrpc2.Result, error) {
+	option, exists := sc.plugin.options[sc.Config]
+	if !exists {
+		return nil, fmt.Errorf("No option %s registered on this plugin", sc.Config)
+	}
+	var meta *OptionMeta
+	if m, ok := option.(hasMeta); ok {
+		meta = m.meta()
+	}
+	if meta == nil || !meta.Dynamic {
+		return nil, fmt.Errorf("Option %s is not dynamic", sc.Config)
+	}
+
+	value, err := sc.value(option)
+	if err != nil {
+		return nil, err
+	}
+	sc.plugin.optionsMu.Lock()
+	err = sc.plugin.changeOption(option, value)
+	sc.plugin.optionsMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if meta.OnChange != nil {
+		meta.OnChange(option)
+	}
+	return map[string]interface{}{}, nil
+}
+
+// The new value, in the form option.Set expects
+func (sc *SetConfigMethod) value(option Option) (interface{}, error) {
+	// flags are just turned on
+	if len(sc.Val) == 0 || string(sc.Val) == "null" {
+		return true, nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(sc.Val, &value); err != nil {
+		return nil, err
+	}
+	str, isStr := value.(string)
+	if !isStr {
+		return value, nil
+	}
+	switch option.Type() {
+	case string(_Int):
+		i, err := strconv.Atoi(str)
+		if err != nil {
+			return nil, fmt.Errorf("Option %s takes an int, not %s", sc.Config, str)
+		}
+		return float64(i), nil
+	case string(_Bool), string(_Flag):
+		b, err := strconv.ParseBool(str)
+		if err != nil {
+			return nil, fmt.Errorf("Option %s takes a bool, not %s", sc.Config, str)
+		}
+		return b, nil
+	}
+	return str, nil
+}
+
 type LogNotification struct {
 	Level   string `json:"level"`
 	Message string `json:"message"`
@@ -1136,6 +2145,115 @@ func (p *Plugin) Log(message string, level LogLevel) {
 	}
 }
 
+// A custom notification, as sent by Emit
+type customNotification struct {
+	topic   string
+	payload interface{}
+}
+
+func (n *customNotification) Name() string {
+	return n.topic
+}
+
+func (n *customNotification) RawParams() (json.RawMessage, error) {
+	return json.Marshal(n.payload)
+}
+
+// Declare a custom notification {topic}, to be sent with Emit.
+// Other plugins can subscribe to it by name.
+func (p *Plugin) RegisterNotificationTopic(topic string) {
+	p.topics = append(p.topics, topic)
+}
+
+// Send a notification for one of this plugin's registered topics.
+// The {payload} is marshalled to JSON, and should be an object.
+// lightningd passes it on to subscribers, along with the
+// name of this plugin.
+func (p *Plugin) Emit(topic string, payload interface{}) error {
+	registered := false
+	for _, t := range p.topics {
+		registered = registered || t == topic
+	}
+	if !registered {
+		return fmt.Errorf("Notification topic %s hasn't been registered", topic)
+	}
+	return p.server.Notify(&customNotification{topic, payload})
+}
+
+// A notification, unparsed. For custom notifications the
+// Origin and Payload are filled in; for anything else they're
+// empty and the Params hold the notification as sent.
+type RawNotification struct {
+	Method  string
+	Params  json.RawMessage
+	Origin  string
+	Payload json.RawMessage
+}
+
+// Unmarshal the notification's payload into {into}. For
+// notifications that don't have one, uses the params.
+func (n *RawNotification) ParsePayload(into interface{}) error {
+	if len(n.Payload) > 0 {
+		return json.Unmarshal(n.Payload, into)
+	}
+	return json.Unmarshal(n.Params, into)
+}
+
+type rawSubscription struct {
+	topic        string
+	cb           func(*RawNotification)
+	notification *RawNotification
+}
+
+func (r *rawSubscription) Name() string {
+	return r.topic
+}
+
+func (r *rawSubscription) New() interface{} {
+	return &rawSubscription{
+		topic: r.topic,
+		cb:    r.cb,
+	}
+}
+
+func (r *rawSubscription) SetRawParams(method string, params json.RawMessage) error {
+	r.notification = &RawNotification{
+		Method: method,
+		Params: params,
+	}
+	// custom notifications come wrapped with who sent them
+	var custom struct {
+		Origin  string          `json:"origin"`
+		Payload json.RawMessage `json:"payload"`
+	}
+	if json.Unmarshal(params, &custom) == nil {
+		r.notification.Origin = custom.Origin
+		r.notification.Payload = custom.Payload
+	}
+	return nil
+}
+
+func (r *rawSubscription) Call() (jrpc2.Result, error) {
+	r.cb(r.notification)
+	return nil, nil
+}
+
+// Subscribe to notifications for {topic}, without parsing them.
+// Works for any topic, including other plugins' custom ones.
+func (p *Plugin) SubscribeTopic(topic string, cb func(n *RawNotification)) {
+	p.subscribe(&rawSubscription{
+		topic: topic,
+		cb:    cb,
+	})
+}
+
+// Subscribe to every notification lightningd sends. This is in
+// addition to any other subscriptions the plugin has; those
+// still get called as normal.
+func (p *Plugin) SubscribeAll(cb func(n *RawNotification)) {
+	p.SubscribeTopic(jrpc2.Wildcard, cb)
+}
+
 // Map for registering hooks. Not the *most* elegant but
 //   it'll do for now.
 type Hooks struct {
@@ -1145,6 +2263,16 @@ type Hooks struct {
 	OpenChannel    func(*OpenChannelEvent) (*OpenChannelResponse, error)
 	HtlcAccepted   func(*HtlcAcceptedEvent) (*HtlcAcceptedResponse, error)
 	RpcCommand     func(*RpcCommandEvent) (*RpcCommandResponse, error)
+
+	CustomMsg              func(*CustomMsgEvent) (*CustomMsgResponse, error)
+	OnionMessageRecv       func(*OnionMessageRecvEvent) (*OnionMessageResponse, error)
+	OnionMessageRecvSecret func(*OnionMessageRecvSecretEvent) (*OnionMessageResponse, error)
+	CommitmentRevocation   func(*CommitmentRevocationEvent) (*CommitmentRevocationResponse, error)
+
+	OpenChannel2        func(*OpenChannel2Event) (*OpenChannel2Response, error)
+	OpenChannel2Changed func(*OpenChannel2ChangedEvent) (*OpenChannel2ChangedResponse, error)
+	OpenChannel2Sign    func(*OpenChannel2SignEvent) (*OpenChannel2SignResponse, error)
+	RbfChannel          func(*RbfChannelEvent) (*OpenChannel2Response, error)
 }
 
 func (p *Plugin) RegisterHooks(hooks *Hooks) error {
@@ -1159,7 +2287,8 @@ func (p *Plugin) RegisterHooks(hooks *Hooks) error {
 	}
 	if hooks.PeerConnected != nil {
 		err := p.server.Register(&PeerConnectedEvent{
-			hook: hooks.PeerConnected,
+			hook:   hooks.PeerConnected,
+			plugin: p,
 		})
 		if err != nil {
 			return err
@@ -1168,7 +2297,8 @@ func (p *Plugin) RegisterHooks(hooks *Hooks) error {
 	}
 	if hooks.InvoicePayment != nil {
 		err := p.server.Register(&InvoicePaymentEvent{
-			hook: hooks.InvoicePayment,
+			hook:   hooks.InvoicePayment,
+			plugin: p,
 		})
 		if err != nil {
 			return err
@@ -1177,7 +2307,8 @@ func (p *Plugin) RegisterHooks(hooks *Hooks) error {
 	}
 	if hooks.OpenChannel != nil {
 		err := p.server.Register(&OpenChannelEvent{
-			hook: hooks.OpenChannel,
+			hook:   hooks.OpenChannel,
+			plugin: p,
 		})
 		if err != nil {
 			return err
@@ -1186,7 +2317,8 @@ func (p *Plugin) RegisterHooks(hooks *Hooks) error {
 	}
 	if hooks.HtlcAccepted != nil {
 		err := p.server.Register(&HtlcAcceptedEvent{
-			hook: hooks.HtlcAccepted,
+			hook:   hooks.HtlcAccepted,
+			plugin: p,
 		})
 		if err != nil {
 			return err
@@ -1195,13 +2327,139 @@ func (p *Plugin) RegisterHooks(hooks *Hooks) error {
 	}
 	if hooks.RpcCommand != nil {
 		err := p.server.Register(&RpcCommandEvent{
-			hook: hooks.RpcCommand,
+			hook:   hooks.RpcCommand,
+			plugin: p,
 		})
 		if err != nil {
 			return err
 		}
 		p.hooks = append(p.hooks, _RpcCommand)
 	}
+	if hooks.CustomMsg != nil {
+		err := p.server.Register(&CustomMsgEvent{
+			hook:   hooks.CustomMsg,
+			plugin: p,
+		})
+		if err != nil {
+			return err
+		}
+		p.hooks = append(p.hooks, _CustomMsg)
+	}
+	if hooks.OnionMessageRecv != nil {
+		err := p.server.Register(&OnionMessageRecvEvent{
+			hook:   hooks.OnionMessageRecv,
+			plugin: p,
+		})
+		if err != nil {
+			return err
+		}
+		p.hooks = append(p.hooks, _OnionMessageRecv)
+	}
+	if hooks.OnionMessageRecvSecret != nil {
+		err := p.server.Register(&OnionMessageRecvSecretEvent{
+			hook:   hooks.OnionMessageRecvSecret,
+			plugin: p,
+		})
+		if err != nil {
+			return err
+		}
+		p.hooks = append(p.hooks, _OnionMessageRecvSecret)
+	}
+	if hooks.CommitmentRevocation != nil {
+		err := p.server.Register(&CommitmentRevocationEvent{
+			hook:   hooks.CommitmentRevocation,
+			plugin: p,
+		})
+		if err != nil {
+			return err
+		}
+		p.hooks = append(p.hooks, _CommitmentRevocation)
+	}
+	if hooks.OpenChannel2 != nil {
+		err := p.server.Register(&OpenChannel2Event{
+			hook:   hooks.OpenChannel2,
+			plugin: p,
+		})
+		if err != nil {
+			return err
+		}
+		p.hooks = append(p.hooks, _OpenChannel2)
+	}
+	if hooks.OpenChannel2Changed != nil {
+		err := p.server.Register(&OpenChannel2ChangedEvent{
+			hook:   hooks.OpenChannel2Changed,
+			plugin: p,
+		})
+		if err != nil {
+			return err
+		}
+		p.hooks = append(p.hooks, _OpenChannel2Changed)
+	}
+	if hooks.OpenChannel2Sign != nil {
+		err := p.server.Register(&OpenChannel2SignEvent{
+			hook:   hooks.OpenChannel2Sign,
+			plugin: p,
+		})
+		if err != nil {
+			return err
+		}
+		p.hooks = append(p.hooks, _OpenChannel2Sign)
+	}
+	if hooks.RbfChannel != nil {
+		err := p.server.Register(&RbfChannelEvent{
+			hook:   hooks.RbfChannel,
+			plugin: p,
+		})
+		if err != nil {
+			return err
+		}
+		p.hooks = append(p.hooks, _RbfChannel)
+	}
+	return nil
+}
+
+var knownHooks = []Hook{
+	_PeerConnected,
+	_DbWrite,
+	_InvoicePayment,
+	_OpenChannel,
+	_HtlcAccepted,
+	_RpcCommand,
+	_CustomMsg,
+	_OnionMessageRecv,
+	_OnionMessageRecvSecret,
+	_CommitmentRevocation,
+	_OpenChannel2,
+	_OpenChannel2Changed,
+	_OpenChannel2Sign,
+	_RbfChannel,
+}
+
+// Set the chaining options for {hook}, eg "htlc_accepted".
+// Can be called before or after the hook is registered,
+// but has to be done before the plugin starts.
+func (p *Plugin) SetHookOptions(hook Hook, options *HookOptions) error {
+	if atomic.LoadInt32(&p.started) != 0 {
+		return fmt.Errorf("Can't set options for hook %s, the plugin's already started", hook)
+	}
+	known := false
+	for _, h := range knownHooks {
+		known = known || h == hook
+	}
+	if !known {
+		return fmt.Errorf("Unknown hook %s", hook)
+	}
+	if options != nil {
+		for _, filter := range options.Filters {
+			if filter.filterFor() != hook {
+				return fmt.Errorf("Hook %s can't be filtered by %v", hook, filter)
+			}
+		}
+	}
+	if p.hookOptions == nil {
+		p.hookOptions = make(map[Hook]*HookOptions)
+	}
+	p.hookOptions[hook] = options
 	return nil
 }
 
@@ -1210,13 +2468,33 @@ type Plugin struct {
 	options       map[string]Option
 	methods       map[string]*RpcMethod
 	hooks         []Hook
+	hookOptions   map[Hook]*HookOptions
+	bindings      []*optionBinding
+	validators    []OptionsValidator
 	subscriptions []string
+	topics        []string
 	initialized   bool
-	initFn        func(plugin *Plugin, options map[string]Option, c *Config)
+	initFn        func(plugin *Plugin, options map[string]Option, c *Config) error
+	manifestCheck func(plugin *Plugin) error
+	shutdownFns   []func(ctx context.Context)
 	Config        *Config
 	stopped       bool
+	stopOnce      sync.Once
 	dynamic       bool
 	features      *FeatureBits
+	deferred      map[string]*Deferred
+	rpc           *Lightning
+	rpcOnce       sync.Once
+	// guards the options' values, and the struct fields
+	// they're bound to, which setconfig can change
+	optionsMu sync.RWMutex
+	// set once Start's called, accessed atomically
+	started int32
+	// from getinfo, once it's been asked for
+	node   *NodeInfo
+	nodeMu sync.Mutex
+	// guards deferred, the pending keyed responses
+	deferredMu sync.Mutex
 }
 
 func NewPlugin(initHandler func(p *Plugin, o map[string]Option, c *Config)) *Plugin {
@@ -1224,24 +2502,150 @@ func NewPlugin(initHandler func(p *Plugin, o map[string]Option, c *Config)) *Plu
 	plugin.server = jrpc2.NewServer()
 	plugin.options = make(map[string]Option)
 	plugin.methods = make(map[string]*RpcMethod)
-	plugin.initFn = initHandler
+	plugin.deferred = make(map[string]*Deferred)
+	plugin.initFn = func(p *Plugin, o map[string]Option, c *Config) error {
+		if initHandler != nil {
+			initHandler(p, o, c)
+		}
+		return nil
+	}
 	plugin.dynamic = true
 	plugin.features = new(FeatureBits)
 	return plugin
 }
 
 func (p *Plugin) Start(in, out *os.File) error {
+	atomic.StoreInt32(&p.started, 1)
 	p.checkForMonkeyPatch()
 	// register the init & getmanifest commands
 	p.RegisterMethod(NewManifestRpcMethod(p))
 	p.RegisterMethod(NewInitRpcMethod(p))
+	p.RegisterMethod(NewSetConfigRpcMethod(p))
+	// so we drain and exit when lightningd stops us, callbacks or not
+	p.subscribe(&ShutdownEvent{
+		plugin: p,
+	})
 
-	return p.server.StartUp(in, out)
+	err := p.server.StartUp(in, out)
+	// lightningd's gone away, no one to talk to
+	p.stopLightning()
+	return err
 }
 
+// Stops the plugin; Start returns once anything queued has been
+// written out.
 func (p *Plugin) Stop() {
-	p.stopped = true
-	p.server.Shutdown()
+	p.stopOnce.Do(func() {
+		p.stopped = true
+		p.stopLightning()
+		p.server.Shutdown()
+	})
+}
+
+// How long in-flight calls and OnShutdown callbacks get to finish,
+// once lightningd says it's shutting down. lightningd kills plugins
+// that haven't exited after 30 seconds.
+var ShutdownTimeout = 25 * time.Second
+
+// Register a callback for when lightningd shuts down or stops
+// the plugin. Once any hook or method calls in progress are
+// answered, the callbacks are run in the order they were
+// registered; {ctx} expires after ShutdownTimeout. Then the
+// plugin stops, and Start returns.
+func (p *Plugin) OnShutdown(cb func(ctx context.Context)) {
+	p.shutdownFns = append(p.shutdownFns, cb)
+}
+
+func (p *Plugin) shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+
+	if !p.server.Drain(ShutdownTimeout) {
+		log.Printf("Stopping with calls still in progress")
+	}
+	done := make(chan struct{})
+	go func() {
+		for _, cb := range p.shutdownFns {
+			cb(ctx)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("Shutdown callbacks didn't finish in %s", ShutdownTimeout)
+	}
+	p.Stop()
+}
+
+// How long to wait between attempts to reconnect
+// the plugin's Lightning client
+var RpcReconnectInterval = time.Second
+
+// Returns an RPC client for the lightningd that started this plugin,
+// connected to the socket passed in at init. The connection is
+// made on first use, re-established if it drops, and closed when
+// the plugin stops. Safe to use from hooks and methods.
+//
+// Returns nil if the plugin hasn't been initialized yet.
+func (p *Plugin) Lightning() *Lightning {
+	if !p.initialized || p.Config == nil {
+		return nil
+	}
+	p.rpcOnce.Do(func() {
+		rpc := NewLightning()
+		err := rpc.StartUpWithReconnect(p.Config.RpcFile, p.Config.LightningDir, RpcReconnectInterval)
+		if err != nil {
+			log.Printf("Unable to connect to lightningd, will keep trying: %s", err)
+		}
+		p.rpc = rpc
+	})
+	return p.rpc
+}
+
+// The id of the node running this plugin. It's looked up with
+// getinfo the first time it, or the alias, is asked for.
+func (p *Plugin) NodeId() (string, error) {
+	node, err := p.nodeInfo()
+	if err != nil {
+		return "", err
+	}
+	return node.Id, nil
+}
+
+// The alias of the node running this plugin. See NodeId
+func (p *Plugin) Alias() (string, error) {
+	node, err := p.nodeInfo()
+	if err != nil {
+		return "", err
+	}
+	return node.Alias, nil
+}
+
+func (p *Plugin) nodeInfo() (*NodeInfo, error) {
+	p.nodeMu.Lock()
+	defer p.nodeMu.Unlock()
+	if p.node != nil {
+		return p.node, nil
+	}
+	rpc := p.Lightning()
+	if rpc == nil {
+		return nil, fmt.Errorf("Plugin hasn't been initialized yet")
+	}
+	node, err := rpc.GetInfo()
+	if err != nil {
+		return nil, err
+	}
+	p.node = node
+	return node, nil
+}
+
+func (p *Plugin) stopLightning() {
+	// make sure no one starts one up after this
+	p.rpcOnce.Do(func() {})
+	if p.rpc != nil {
+		p.rpc.Shutdown()
+	}
 }
 
 // Remaps stdout to print logs to c-lightning via notifications
@@ -1400,6 +2804,8 @@ func (p *Plugin) UnregisterOption(o Option) error {
 
 // this always returns a string option. left as is for legacy reasons
 func (p *Plugin) GetOption(name string) (string, error) {
+	p.optionsMu.RLock()
+	defer p.optionsMu.RUnlock()
 	opt := p.options[name]
 	if opt == nil {
 		return "", errors.New(fmt.Sprintf("Option '%s' not found", name))
@@ -1412,6 +2818,8 @@ func (p *Plugin) GetOption(name string) (string, error) {
 }
 
 func (p *Plugin) GetIntOption(name string) (int, error) {
+	p.optionsMu.RLock()
+	defer p.optionsMu.RUnlock()
 	opt := p.options[name]
 	if opt == nil {
 		return -1, errors.New(fmt.Sprintf("Option '%s' not found", name))
@@ -1424,6 +2832,8 @@ func (p *Plugin) GetIntOption(name string) (int, error) {
 }
 
 func (p *Plugin) GetBoolOption(name string) (bool, error) {
+	p.optionsMu.RLock()
+	defer p.optionsMu.RUnlock()
 	opt := p.options[name]
 	if opt == nil {
 		return false, errors.New(fmt.Sprintf("Option '%s' not found", name))
@@ -1435,7 +2845,37 @@ func (p *Plugin) GetBoolOption(name string) (bool, error) {
 	return bopt.Val, nil
 }
 
+func (p *Plugin) GetStringListOption(name string) ([]string, error) {
+	p.optionsMu.RLock()
+	defer p.optionsMu.RUnlock()
+	opt := p.options[name]
+	if opt == nil {
+		return nil, errors.New(fmt.Sprintf("Option '%s' not found", name))
+	}
+	lopt, ok := opt.(*StringListOption)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("%s is not a string list option", name))
+	}
+	return lopt.Val, nil
+}
+
+func (p *Plugin) GetIntListOption(name string) ([]int, error) {
+	p.optionsMu.RLock()
+	defer p.optionsMu.RUnlock()
+	opt := p.options[name]
+	if opt == nil {
+		return nil, errors.New(fmt.Sprintf("Option '%s' not found", name))
+	}
+	lopt, ok := opt.(*IntListOption)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("%s is not an int list option", name))
+	}
+	return lopt.Val, nil
+}
+
 func (p *Plugin) IsOptionFlagged(name string) (bool, error) {
+	p.optionsMu.RLock()
+	defer p.optionsMu.RUnlock()
 	opt := p.options[name]
 	// Flag options aren't passed down if not present
 	if opt == nil {
@@ -1504,15 +2944,80 @@ func (p *Plugin) SubscribeForwardings(cb func(c *Forwarding)) {
 	})
 }
 
+func (p *Plugin) SubscribeChannelStateChanged(cb func(c *ChannelStateChanged)) {
+	p.subscribe(&ChannelStateChangedEvent{
+		cb: cb,
+	})
+}
+
+func (p *Plugin) SubscribeCoinMovement(cb func(c *CoinMovement)) {
+	p.subscribe(&CoinMovementEvent{
+		cb: cb,
+	})
+}
+
+func (p *Plugin) SubscribeBalanceSnapshot(cb func(c *BalanceSnapshot)) {
+	p.subscribe(&BalanceSnapshotEvent{
+		cb: cb,
+	})
+}
+
+func (p *Plugin) SubscribeBlockAdded(cb func(c *BlockAdded)) {
+	p.subscribe(&BlockAddedEvent{
+		cb: cb,
+	})
+}
+
+func (p *Plugin) SubscribeOpenChannelPeerSigs(cb func(c *OpenChannelPeerSigs)) {
+	p.subscribe(&OpenChannelPeerSigsEvent{
+		cb: cb,
+	})
+}
+
+func (p *Plugin) SubscribeChannelOpenFailed(cb func(c *ChannelOpenFailed)) {
+	p.subscribe(&ChannelOpenFailedEvent{
+		cb: cb,
+	})
+}
+
+func (p *Plugin) SubscribeInvoiceCreation(cb func(c *InvoiceCreation)) {
+	p.subscribe(&InvoiceCreationEvent{
+		cb: cb,
+	})
+}
+
+func (p *Plugin) SubscribeShutdown(cb func()) {
+	p.OnShutdown(func(ctx context.Context) {
+		cb()
+	})
+}
+
 func (p *Plugin) subscribe(subscription jrpc2.ServerMethod) {
 	p.server.Register(subscription)
 	p.subscriptions = append(p.subscriptions, subscription.Name())
 }
 
+// Dynamic plugins (the default) can be started and stopped while
+// lightningd's running, with `plugin start` and `plugin stop`.
+// Setting feature bits makes a plugin static.
 func (p *Plugin) SetDynamic(d bool) {
 	p.dynamic = d
 }
 
+// Replaces the init handler given to NewPlugin with one that can
+// fail. If it returns an error, the plugin is disabled, with the
+// error as the reason.
+func (p *Plugin) SetInitHandler(initHandler func(p *Plugin, o map[string]Option, c *Config) error) {
+	p.initFn = initHandler
+}
+
+// Called when lightningd asks for the manifest, before any options
+// are set. Return an error to disable the plugin, eg if something
+// it needs isn't installed.
+func (p *Plugin) SetManifestCheck(check func(p *Plugin) error) {
+	p.manifestCheck = check
+}
+
 // Returns a list of params for this call, wrap
 // optional (i.e. omitempty) marked params with []
 func getUsageList(method jrpc2.ServerMethod) string {
@@ -1529,7 +3034,7 @@ func getUsageList(method jrpc2.ServerMethod) string {
 		}
 		tag, _ := fieldType.Tag.Lookup("json")
 		// Ignore ignored fields
-		if tag == "-" {
+		if jrpc2.IsIgnoredField(fieldType) {
 			continue
 		}
 		optional := strings.Contains(tag, "omitempty")
@@ -2,13 +2,17 @@ package glightning_test
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"github.com/niftynei/glightning/glightning"
 	"github.com/niftynei/glightning/jrpc2"
 	"github.com/stretchr/testify/assert"
 	"io"
+	"io/ioutil"
 	"log"
+	"net"
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -140,6 +144,106 @@ func TestInit(t *testing.T) {
 	runTest(t, plugin, initJson, expectedJson)
 }
 
+func TestInitFullConfig(t *testing.T) {
+	initTestFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
+		assert.Equal(t, "bitcoin", config.Network)
+		assert.Equal(t, &glightning.ProxyAddress{Type: "ipv4", Address: "127.0.0.1", Port: 9050}, config.Proxy)
+		assert.True(t, config.TorV3Enabled)
+		assert.True(t, config.AlwaysUseProxy)
+		assert.Equal(t, "8000000000000000002822aaa2", config.Features.Init.String())
+
+		var autoconnect int
+		assert.Nil(t, config.GetExtra("autoconnect-seeker-peers", &autoconnect))
+		assert.Equal(t, 10, autoconnect)
+		assert.Equal(t, 1, len(config.Extra))
+		assert.NotNil(t, config.GetExtra("alias", &autoconnect))
+
+		params, err := config.NetworkParams()
+		assert.Nil(t, err)
+		assert.Equal(t, "bc", params.Bech32HRP)
+	})
+	plugin := glightning.NewPlugin(initTestFn)
+
+	initJson := `{"jsonrpc":"2.0","method":"init","params":{"options":{},"configuration":{"lightning-dir":"/home/user/.lightning/bitcoin","rpc-file":"lightning-rpc","startup":true,"network":"bitcoin","feature_set":{"init":"8000000000000000002822aaa2","node":"8000000000000000002822aaa2","channel":"","invoice":"02000000024100"},"proxy":{"type":"ipv4","address":"127.0.0.1","port":9050},"torv3-enabled":true,"always_use_proxy":true,"autoconnect-seeker-peers":10}},"id":1}` + "\n\n"
+	runTest(t, plugin, initJson, "{\"jsonrpc\":\"2.0\",\"result\":\"ok\",\"id\":1}")
+}
+
+func TestNetworkParams(t *testing.T) {
+	params, err := glightning.GetNetworkParams("bitcoin")
+	assert.Nil(t, err)
+	assert.Equal(t, "6fe28c0ab6f1b372c1a6a246ae63f74f931e8365e15a089c68d6190000000000", params.ChainHash())
+	assert.Equal(t, "lnbc", params.Bolt11Prefix())
+	assert.Equal(t, byte(0x05), params.ScriptHashAddrId)
+
+	params, err = glightning.GetNetworkParams("regtest")
+	assert.Nil(t, err)
+	assert.Equal(t, "06226e46111a0b59caaf126043eb5bbf28c34f3a5e332a1fc7b2b73cf188910f", params.ChainHash())
+	assert.Equal(t, "lnbcrt", params.Bolt11Prefix())
+	assert.Equal(t, "bcrt", params.Bech32HRP)
+
+	_, err = glightning.GetNetworkParams("dogecoin")
+	assert.NotNil(t, err)
+}
+
+func TestPluginLightning(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lightning")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ln, err := net.Listen("unix", filepath.Join(dir, "rpc.file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// answer a single request on each connection, then hang up
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			var req struct {
+				Id json.RawMessage `json:"id"`
+			}
+			if err := json.NewDecoder(conn).Decode(&req); err == nil {
+				fmt.Fprintf(conn, "{\"jsonrpc\":\"2.0\",\"id\":%s,\"result\":{\"network\":\"regtest\"}}\n\n", req.Id)
+			}
+			conn.Close()
+		}
+	}()
+
+	glightning.RpcReconnectInterval = 10 * time.Millisecond
+	var plugin *glightning.Plugin
+	plugin = glightning.NewPlugin(func(p *glightning.Plugin, o map[string]glightning.Option, c *glightning.Config) {
+		network, err := p.Lightning().GetConfig("network")
+		assert.Nil(t, err)
+		assert.Equal(t, "regtest", network)
+	})
+	assert.Nil(t, plugin.Lightning())
+
+	initJson := fmt.Sprintf("{\"jsonrpc\":\"2.0\",\"method\":\"init\",\"params\":{\"options\":{},\"configuration\":{\"rpc-file\":\"rpc.file\",\"startup\":true,\"network\":\"regtest\",\"lightning-dir\":\"%s\"}},\"id\":1}\n\n", dir)
+	runTest(t, plugin, initJson, "{\"jsonrpc\":\"2.0\",\"result\":\"ok\",\"id\":1}")
+
+	// the server hung up on us, we should reconnect
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		network, err := plugin.Lightning().GetConfig("network")
+		if err == nil {
+			assert.Equal(t, "regtest", network)
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("never reconnected: %s", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	plugin.Stop()
+	assert.False(t, plugin.Lightning().IsUp())
+}
+
 func TestMissingOptionRpcCall(t *testing.T) {
 	initTestFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
 		t.Error("Should not have called init when calling get manifest")
@@ -168,10 +272,190 @@ func TestGetManifest(t *testing.T) {
 	plugin.SetDynamic(true)
 
 	msg := "{\"jsonrpc\":\"2.0\",\"method\":\"getmanifest\",\"id\":\"aloha\"}\n\n"
-	resp := "{\"jsonrpc\":\"2.0\",\"result\":{\"options\":[{\"name\":\"greeting\",\"type\":\"string\",\"default\":\"Mary\",\"description\":\"How you'd like to be called\"}],\"rpcmethods\":[{\"name\":\"hi\",\"description\":\"Send a greeting.\",\"usage\":\"\"}],\"dynamic\":true,\"subscriptions\":[\"connect\"],\"featurebits\":{}},\"id\":\"aloha\"}"
+	resp := "{\"jsonrpc\":\"2.0\",\"result\":{\"options\":[{\"name\":\"greeting\",\"type\":\"string\",\"default\":\"Mary\",\"description\":\"How you'd like to be called\"}],\"rpcmethods\":[{\"name\":\"hi\",\"description\":\"Send a greeting.\",\"usage\":\"\"}],\"dynamic\":true,\"subscriptions\":[\"connect\",\"shutdown\"],\"featurebits\":{}},\"id\":\"aloha\"}"
 	runTest(t, plugin, msg, resp)
 }
 
+// Plugins are dynamic, so `plugin stop` works on them, unless
+// they say otherwise or set feature bits
+func TestManifestDynamic(t *testing.T) {
+	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
+		t.Error("Should not have called init when calling get manifest")
+	})
+	msg := "{\"jsonrpc\":\"2.0\",\"method\":\"getmanifest\",\"id\":\"aloha\"}\n\n"
+
+	plugin := glightning.NewPlugin(initFn)
+	runTest(t, plugin, msg, `{"jsonrpc":"2.0","result":{"options":[],"rpcmethods":[],"dynamic":true,"subscriptions":["shutdown"],"featurebits":{}},"id":"aloha"}`)
+
+	plugin = glightning.NewPlugin(initFn)
+	plugin.SetDynamic(false)
+	runTest(t, plugin, msg, `{"jsonrpc":"2.0","result":{"options":[],"rpcmethods":[],"dynamic":false,"subscriptions":["shutdown"],"featurebits":{}},"id":"aloha"}`)
+
+	plugin = glightning.NewPlugin(initFn)
+	plugin.AddNodeFeatures([]byte{0x02})
+	runTest(t, plugin, msg, `{"jsonrpc":"2.0","result":{"options":[],"rpcmethods":[],"dynamic":false,"subscriptions":["shutdown"],"featurebits":{"node":"02"}},"id":"aloha"}`)
+}
+
+func TestManifestWithDynamicOption(t *testing.T) {
+	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
+		t.Error("Should not have called init when calling get manifest")
+	})
+	plugin := glightning.NewPlugin(initFn)
+	fee := glightning.NewIntOption("fee-base", "Base fee to charge", 1000)
+	fee.Dynamic = true
+	plugin.RegisterOption(fee)
+
+	msg := "{\"jsonrpc\":\"2.0\",\"method\":\"getmanifest\",\"id\":\"aloha\"}\n\n"
+	resp := `{"jsonrpc":"2.0","result":{"options":[{"name":"fee-base","type":"int","default":1000,"description":"Base fee to charge","dynamic":true}],"rpcmethods":[],"dynamic":true,"subscriptions":["shutdown"],"featurebits":{}},"id":"aloha"}`
+	runTest(t, plugin, msg, resp)
+}
+
+func TestInitMultiOption(t *testing.T) {
+	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
+		peers := options["peer"].(*glightning.StringListOption)
+		assert.Equal(t, []string{"alice", "bob"}, peers.Val)
+		ports := options["port"].(*glightning.IntListOption)
+		assert.Equal(t, []int{9735}, ports.Val)
+	})
+	plugin := glightning.NewPlugin(initFn)
+	plugin.RegisterOption(glightning.NewStringListOption("peer", "Peers to watch"))
+	plugin.RegisterOption(glightning.NewIntListOption("port", "Ports to listen on"))
+
+	msg := `{"jsonrpc":"2.0","method":"init","params":{"options":{"peer":["alice","bob"],"port":9735},"configuration":{"rpc-file":"rpc.file","startup":true,"network":"testnet","lightning-dir":"dirforlightning"}},"id":1}` + "\n\n"
+	runTest(t, plugin, msg, "{\"jsonrpc\":\"2.0\",\"result\":\"ok\",\"id\":1}")
+}
+
+type feeOptions struct {
+	FeeBase int64    `option:"fee-base" description:"Base fee to charge" default:"1000" dynamic:"true"`
+	Verbose bool     `option:"verbose" description:"Log more" type:"flag"`
+	Peers   []string `option:"peer" description:"Peers to watch"`
+	Note    string
+}
+
+func (o *feeOptions) Validate() error {
+	if o.FeeBase < 0 {
+		return fmt.Errorf("fee-base can't be negative")
+	}
+	return nil
+}
+
+func TestInitBoundOptions(t *testing.T) {
+	opts := &feeOptions{}
+	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
+		assert.Equal(t, int64(2000), opts.FeeBase)
+		assert.True(t, opts.Verbose)
+		assert.Equal(t, []string{"alice"}, opts.Peers)
+	})
+	plugin := glightning.NewPlugin(initFn)
+	assert.Nil(t, plugin.RegisterOptions(opts))
+	assert.Equal(t, int64(1000), opts.FeeBase)
+
+	msg := `{"jsonrpc":"2.0","method":"init","params":{"options":{"fee-base":2000,"verbose":true,"peer":["alice"]},"configuration":{"rpc-file":"rpc.file","startup":true,"network":"testnet","lightning-dir":"dirforlightning"}},"id":1}` + "\n\n"
+	runTest(t, plugin, msg, "{\"jsonrpc\":\"2.0\",\"result\":\"ok\",\"id\":1}")
+}
+
+func TestInitBoundOptionsInvalid(t *testing.T) {
+	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
+		t.Error("Should not have called init with invalid options")
+	})
+	plugin := glightning.NewPlugin(initFn)
+	assert.Nil(t, plugin.RegisterOptions(&feeOptions{}))
+
+	msg := `{"jsonrpc":"2.0","method":"init","params":{"options":{"fee-base":-5},"configuration":{"rpc-file":"rpc.file","startup":true,"network":"testnet","lightning-dir":"dirforlightning"}},"id":1}` + "\n\n"
+	runTest(t, plugin, msg, `{"jsonrpc":"2.0","result":{"disable":"fee-base can't be negative"},"id":1}`)
+}
+
+func TestInitDisable(t *testing.T) {
+	plugin := glightning.NewPlugin(nil)
+	plugin.SetInitHandler(func(p *glightning.Plugin, o map[string]glightning.Option, c *glightning.Config) error {
+		if c.Network != "bitcoin" {
+			return fmt.Errorf("only runs on mainnet, not %s", c.Network)
+		}
+		return nil
+	})
+
+	msg := `{"jsonrpc":"2.0","method":"init","params":{"options":{},"configuration":{"rpc-file":"rpc.file","startup":true,"network":"testnet","lightning-dir":"dirforlightning"}},"id":1}` + "\n\n"
+	runTest(t, plugin, msg, `{"jsonrpc":"2.0","result":{"disable":"only runs on mainnet, not testnet"},"id":1}`)
+	assert.Nil(t, plugin.Lightning())
+}
+
+func TestManifestDisable(t *testing.T) {
+	plugin := glightning.NewPlugin(nullInitFunc)
+	plugin.SetManifestCheck(func(p *glightning.Plugin) error {
+		return fmt.Errorf("bitcoind not found")
+	})
+
+	msg := "{\"jsonrpc\":\"2.0\",\"method\":\"getmanifest\",\"id\":\"aloha\"}\n\n"
+	resp := `{"jsonrpc":"2.0","result":{"options":[],"rpcmethods":[],"dynamic":true,"subscriptions":["shutdown"],"featurebits":{},"disable":"bitcoind not found"},"id":"aloha"}`
+	runTest(t, plugin, msg, resp)
+}
+
+func TestRegisterOptionsErrors(t *testing.T) {
+	plugin := glightning.NewPlugin(nullInitFunc)
+	assert.NotNil(t, plugin.RegisterOptions(feeOptions{}))
+	assert.NotNil(t, plugin.RegisterOptions(&struct {
+		Rate float64 `option:"rate"`
+	}{}))
+	assert.NotNil(t, plugin.RegisterOptions(&struct {
+		Fee int `option:"fee" default:"lots"`
+	}{}))
+	assert.NotNil(t, plugin.RegisterOptions(&struct {
+		Fee int `option:"fee" type:"string"`
+	}{}))
+	assert.NotNil(t, plugin.RegisterOptions(&struct {
+		Fee int8 `option:"fee" default:"1000"`
+	}{}))
+
+	assert.Nil(t, plugin.RegisterOptions(&feeOptions{}))
+	assert.NotNil(t, plugin.RegisterOptions(&feeOptions{}))
+}
+
+func dynamicFeePlugin(changed chan int) *glightning.Plugin {
+	plugin := glightning.NewPlugin(nullInitFunc)
+	fee := glightning.NewIntOption("fee-base", "Base fee to charge", 1000)
+	fee.Dynamic = true
+	fee.Validate = func(value interface{}) error {
+		if value.(int) < 0 {
+			return fmt.Errorf("fee-base can't be negative")
+		}
+		return nil
+	}
+	fee.OnChange = func(o glightning.Option) {
+		changed <- o.GetValue().(int)
+	}
+	plugin.RegisterOption(fee)
+	plugin.RegisterOption(glightning.NewOption("greeting", "How you'd like to be called", "Mary"))
+	return plugin
+}
+
+func TestSetConfig(t *testing.T) {
+	changed := make(chan int, 1)
+	plugin := dynamicFeePlugin(changed)
+
+	msg := `{"jsonrpc":"2.0","method":"setconfig","params":{"config":"fee-base","val":"2000"},"id":1}` + "\n\n"
+	runTest(t, plugin, msg, `{"jsonrpc":"2.0","result":{},"id":1}`)
+	assert.Equal(t, 2000, <-changed)
+	fee, err := plugin.GetIntOption("fee-base")
+	assert.Nil(t, err)
+	assert.Equal(t, 2000, fee)
+}
+
+func TestSetConfigRejected(t *testing.T) {
+	changed := make(chan int, 1)
+	plugin := dynamicFeePlugin(changed)
+
+	msg := `{"jsonrpc":"2.0","method":"setconfig","params":{"config":"fee-base","val":-1},"id":1}` + "\n\n"
+	runTest(t, plugin, msg, `{"jsonrpc":"2.0","error":{"code":-1,"message":"fee-base can't be negative"},"id":1}`)
+	assert.Equal(t, 0, len(changed))
+}
+
+func TestSetConfigNotDynamic(t *testing.T) {
+	plugin := dynamicFeePlugin(make(chan int, 1))
+
+	msg := `{"jsonrpc":"2.0","method":"setconfig","params":{"config":"greeting","val":"Jenny"},"id":1}` + "\n\n"
+	runTest(t, plugin, msg, `{"jsonrpc":"2.0","error":{"code":-1,"message":"Option greeting is not dynamic"},"id":1}`)
+}
+
 func TestManifestWithHooks(t *testing.T) {
 	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
 		t.Error("Should not have called init when calling get manifest")
@@ -186,10 +470,101 @@ func TestManifestWithHooks(t *testing.T) {
 	})
 
 	msg := "{\"jsonrpc\":\"2.0\",\"method\":\"getmanifest\",\"id\":\"aloha\"}\n\n"
-	resp := `{"jsonrpc":"2.0","result":{"options":[],"rpcmethods":[],"dynamic":true,"hooks":["db_write","peer_connected","invoice_payment","openchannel","htlc_accepted"],"featurebits":{}},"id":"aloha"}`
+	resp := `{"jsonrpc":"2.0","result":{"options":[],"rpcmethods":[],"dynamic":true,"subscriptions":["shutdown"],"hooks":["db_write","peer_connected","invoice_payment","openchannel","htlc_accepted"],"featurebits":{}},"id":"aloha"}`
 	runTest(t, plugin, msg, resp)
 }
 
+func TestManifestWithHookOptions(t *testing.T) {
+	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
+		t.Error("Should not have called init when calling get manifest")
+	})
+	plugin := glightning.NewPlugin(initFn)
+	plugin.RegisterHooks(&glightning.Hooks{
+		HtlcAccepted: OnHtlcAccepted,
+		CustomMsg: func(event *glightning.CustomMsgEvent) (*glightning.CustomMsgResponse, error) {
+			return event.Continue(), nil
+		},
+		RpcCommand: func(event *glightning.RpcCommandEvent) (*glightning.RpcCommandResponse, error) {
+			return event.Continue(), nil
+		},
+	})
+	err := plugin.SetHookOptions("htlc_accepted", &glightning.HookOptions{
+		Before: []string{"funder"},
+		After:  []string{"keysend", "offers"},
+	})
+	assert.Nil(t, err)
+	err = plugin.SetHookOptions("custommsg", &glightning.HookOptions{
+		Filters: glightning.MessageTypeFilters(32769, 32771),
+	})
+	assert.Nil(t, err)
+	err = plugin.SetHookOptions("rpc_command", &glightning.HookOptions{
+		Filters: glightning.MethodFilters("pay"),
+	})
+	assert.Nil(t, err)
+
+	err = plugin.SetHookOptions("htlc_acepted", &glightning.HookOptions{})
+	assert.Equal(t, "Unknown hook htlc_acepted", err.Error())
+	err = plugin.SetHookOptions("custommsg", &glightning.HookOptions{
+		Filters: glightning.MethodFilters("pay"),
+	})
+	assert.Equal(t, "Hook custommsg can't be filtered by pay", err.Error())
+
+	msg := "{\"jsonrpc\":\"2.0\",\"method\":\"getmanifest\",\"id\":\"aloha\"}\n\n"
+	resp := `{"jsonrpc":"2.0","result":{"options":[],"rpcmethods":[],"dynamic":true,"subscriptions":["shutdown"],"hooks":[{"name":"htlc_accepted","before":["funder"],"after":["keysend","offers"]},{"name":"rpc_command","filters":["pay"]},{"name":"custommsg","filters":[32769,32771]}],"featurebits":{}},"id":"aloha"}`
+	runTest(t, plugin, msg, resp)
+
+	err = plugin.SetHookOptions("htlc_accepted", nil)
+	assert.Equal(t, "Can't set options for hook htlc_accepted, the plugin's already started", err.Error())
+}
+
+func TestManifestWithNotificationTopics(t *testing.T) {
+	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
+		t.Error("Should not have called init when calling get manifest")
+	})
+	plugin := glightning.NewPlugin(initFn)
+	plugin.RegisterNotificationTopic("catnap")
+	plugin.SubscribeTopic("dognap", func(n *glightning.RawNotification) {})
+	plugin.SubscribeAll(func(n *glightning.RawNotification) {})
+
+	msg := "{\"jsonrpc\":\"2.0\",\"method\":\"getmanifest\",\"id\":\"aloha\"}\n\n"
+	resp := `{"jsonrpc":"2.0","result":{"options":[],"rpcmethods":[],"dynamic":true,"subscriptions":["dognap","*","shutdown"],"featurebits":{},"notifications":[{"method":"catnap"}]},"id":"aloha"}`
+	runTest(t, plugin, msg, resp)
+}
+
+type NapMethod struct {
+	plugin *glightning.Plugin
+}
+
+func (n *NapMethod) Name() string {
+	return "nap"
+}
+
+func (n *NapMethod) New() interface{} {
+	return &NapMethod{n.plugin}
+}
+
+func (n *NapMethod) Call() (jrpc2.Result, error) {
+	if err := n.plugin.Emit("dognap", map[string]int{"hours": 1}); err == nil {
+		return nil, fmt.Errorf("dognap isn't one of ours")
+	}
+	err := n.plugin.Emit("catnap", map[string]int{"hours": 16})
+	return "zzz", err
+}
+
+func TestEmitNotification(t *testing.T) {
+	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
+		t.Error("Should not have called init")
+	})
+	plugin := glightning.NewPlugin(initFn)
+	plugin.RegisterNotificationTopic("catnap")
+	plugin.RegisterMethod(glightning.NewRpcMethod(&NapMethod{plugin}, "Take a nap"))
+
+	// the notification goes out before the method returns
+	msg := `{"jsonrpc":"2.0","method":"nap","params":{},"id":3}`
+	resp := `{"jsonrpc":"2.0","method":"catnap","params":{"hours":16}}`
+	runTest(t, plugin, msg+"\n\n", resp)
+}
+
 func TestHook_DbWriteOk(t *testing.T) {
 	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
 		t.Error("Should not have called init when calling get manifest")
@@ -281,6 +656,28 @@ func TestHook_PeerConnectedDisconnect(t *testing.T) {
 	runTest(t, plugin, msg+"\n\n", resp)
 }
 
+func TestHook_PeerConnectedDeferredIgnoresResponse(t *testing.T) {
+	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
+		t.Error("Should not have called init when calling get manifest")
+	})
+	plugin := glightning.NewPlugin(initFn)
+	plugin.RegisterHooks(&glightning.Hooks{
+		PeerConnected: func(event *glightning.PeerConnectedEvent) (*glightning.PeerConnectedResponse, error) {
+			d := event.Defer("", time.Minute, nil)
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				assert.Nil(t, d.Resolve(event.Disconnect("later")))
+			}()
+			// the deferred answer wins
+			return event.Continue(), nil
+		},
+	})
+
+	msg := `{"jsonrpc":"2.0","id":"aloha","method":"peer_connected","params":{"peer":{"id":"02c0114aac5ea2bce7759eb48d5aa75129700c1eb7fe6cc8743968a202f26505d6","addr":"127.0.0.1:58366","features":"aa"}}}`
+	resp := `{"jsonrpc":"2.0","result":{"result":"disconnect","error_message":"later"},"id":"aloha"}`
+	runTest(t, plugin, msg+"\n\n", resp)
+}
+
 func TestHook_OpenChannelOk(t *testing.T) {
 	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
 		t.Error("Should not have called init when calling get manifest")
@@ -467,6 +864,95 @@ func TestHook_HtlcAcceptedFail(t *testing.T) {
 	runTest(t, plugin, msg+"\n\n", resp)
 }
 
+func TestHook_HtlcAcceptedDeferred(t *testing.T) {
+	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
+		t.Error("Should not have called init when calling get manifest")
+	})
+	plugin := glightning.NewPlugin(initFn)
+	plugin.RegisterHooks(&glightning.Hooks{
+		HtlcAccepted: func(event *glightning.HtlcAcceptedEvent) (*glightning.HtlcAcceptedResponse, error) {
+			event.Defer("hold", time.Minute, event.Fail(uint16(55)))
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				err := plugin.ResolveDeferred("hold", event.Resolve("payment_key"))
+				assert.Nil(t, err)
+			}()
+			return nil, nil
+		},
+	})
+
+	msg := `{"jsonrpc":"2.0","id":"aloha","method":"htlc_accepted","params":{"onion":{"payload":"0000000000000000000000000000c3500000014b000000000000000000000000","per_hop_v0":{"realm":"00","short_channel_id":"0x0x0","forward_amount":"50000msat","outgoing_cltv_value":331},"next_onion":"0003ff512b805f80ba69052342482401cda5f4986ed8600316ba8caf72b4fcc5826f0000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000171bd5ff2190087d1572def9e35dd7c14e9ab3e06ce797b0480c9ccc8fb00a7d2390daf2fcead26d6775d7feac22f21fce0353b7fe77491401d18f7d69379c336d0000000000000000000000000000000000000000000000000000000000000000","shared_secret":"eb5ab3e3db045e589597687e0eba89a98af0d19fd1967e1f24feb6f2814cb9c5"},"htlc":{"amount":"50000msat","cltv_expiry":331,"cltv_expiry_relative":23,"payment_hash":"6440c8f51f2ee53213ef9f2e58ffdf46982fe91dd7c9228a92a557450ae2f2f5"}}}`
+	resp := `{"jsonrpc":"2.0","result":{"result":"resolve","payment_key":"payment_key"},"id":"aloha"}`
+	runTest(t, plugin, msg+"\n\n", resp)
+
+	_, ok := plugin.GetDeferred("hold")
+	assert.False(t, ok)
+	assert.Equal(t, 0, len(plugin.PendingDeferred()))
+}
+
+func TestHook_HtlcAcceptedDeferredTimeout(t *testing.T) {
+	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
+		t.Error("Should not have called init when calling get manifest")
+	})
+	plugin := glightning.NewPlugin(initFn)
+	plugin.RegisterHooks(&glightning.Hooks{
+		HtlcAccepted: func(event *glightning.HtlcAcceptedEvent) (*glightning.HtlcAcceptedResponse, error) {
+			event.Defer("hold", 10*time.Millisecond, event.Fail(uint16(55)))
+			return nil, nil
+		},
+	})
+
+	msg := `{"jsonrpc":"2.0","id":"aloha","method":"htlc_accepted","params":{"onion":{"payload":"0000000000000000000000000000c3500000014b000000000000000000000000","per_hop_v0":{"realm":"00","short_channel_id":"0x0x0","forward_amount":"50000msat","outgoing_cltv_value":331},"next_onion":"0003ff512b805f80ba69052342482401cda5f4986ed8600316ba8caf72b4fcc5826f0000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000171bd5ff2190087d1572def9e35dd7c14e9ab3e06ce797b0480c9ccc8fb00a7d2390daf2fcead26d6775d7feac22f21fce0353b7fe77491401d18f7d69379c336d0000000000000000000000000000000000000000000000000000000000000000","shared_secret":"eb5ab3e3db045e589597687e0eba89a98af0d19fd1967e1f24feb6f2814cb9c5"},"htlc":{"amount":"50000msat","cltv_expiry":331,"cltv_expiry_relative":23,"payment_hash":"6440c8f51f2ee53213ef9f2e58ffdf46982fe91dd7c9228a92a557450ae2f2f5"}}}`
+	resp := `{"jsonrpc":"2.0","result":{"result":"fail","failure_code":55},"id":"aloha"}`
+	runTest(t, plugin, msg+"\n\n", resp)
+
+	err := plugin.ResolveDeferred("hold", nil)
+	assert.NotNil(t, err)
+}
+
+func TestDeferSameKey(t *testing.T) {
+	plugin := glightning.NewPlugin(nullInitFunc)
+	first := plugin.Defer("hold", time.Minute, nil)
+	second := plugin.Defer("hold", time.Minute, nil)
+
+	// the first one's been answered, so it isn't left hanging
+	assert.True(t, first.IsDone())
+	assert.NotNil(t, first.Resolve("late"))
+	d, ok := plugin.GetDeferred("hold")
+	assert.True(t, ok)
+	assert.Equal(t, second, d)
+
+	assert.Nil(t, plugin.ResolveDeferred("hold", "held"))
+	assert.Equal(t, 0, len(plugin.PendingDeferred()))
+}
+
+type HoldMethod struct {
+	plugin *glightning.Plugin
+}
+
+func (h *HoldMethod) Name() string {
+	return "hold"
+}
+
+func (h *HoldMethod) New() interface{} {
+	return &HoldMethod{h.plugin}
+}
+
+func (h *HoldMethod) Call() (jrpc2.Result, error) {
+	d := h.plugin.Defer("", time.Minute, nil)
+	go d.Resolve("held")
+	return d, nil
+}
+
+func TestRpcMethodDeferred(t *testing.T) {
+	plugin := glightning.NewPlugin(nullInitFunc)
+	plugin.RegisterMethod(glightning.NewRpcMethod(&HoldMethod{plugin}, "Hold on"))
+
+	msg := `{"jsonrpc":"2.0","method":"hold","params":{},"id":7}`
+	resp := `{"jsonrpc":"2.0","result":"held","id":7}`
+	runTest(t, plugin, msg+"\n\n", resp)
+}
+
 func TestHook_InvoicePayment(t *testing.T) {
 	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
 		t.Error("Should not have called init when calling get manifest")
@@ -503,6 +989,163 @@ func TestHook_InvoicePaymentFail(t *testing.T) {
 	runTest(t, plugin, msg+"\n\n", resp)
 }
 
+func TestHook_CustomMsg(t *testing.T) {
+	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
+		t.Error("Should not have called init when calling get manifest")
+	})
+	plugin := glightning.NewPlugin(initFn)
+	plugin.RegisterHooks(&glightning.Hooks{
+		CustomMsg: func(event *glightning.CustomMsgEvent) (*glightning.CustomMsgResponse, error) {
+			assert.Equal(t, "02a4a3c4ed4b3ae2fc2a3e0b2c3c3a0cc3b4d5e7db3bb4ddd6c0b6c9c1e1f2a3b4", event.PeerId)
+			msgType, err := event.MessageType()
+			assert.Nil(t, err)
+			assert.Equal(t, uint16(32769), msgType)
+			return event.Continue(), nil
+		},
+	})
+	msg := `{"jsonrpc":"2.0","id":"aloha","method":"custommsg","params":{"peer_id":"02a4a3c4ed4b3ae2fc2a3e0b2c3c3a0cc3b4d5e7db3bb4ddd6c0b6c9c1e1f2a3b4","payload":"8001deadbeef"}}`
+	resp := `{"jsonrpc":"2.0","result":{"result":"continue"},"id":"aloha"}`
+	runTest(t, plugin, msg+"\n\n", resp)
+}
+
+func TestHook_OnionMessageRecv(t *testing.T) {
+	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
+		t.Error("Should not have called init when calling get manifest")
+	})
+	plugin := glightning.NewPlugin(initFn)
+	plugin.RegisterHooks(&glightning.Hooks{
+		OnionMessageRecv: func(event *glightning.OnionMessageRecvEvent) (*glightning.OnionMessageResponse, error) {
+			om := event.OnionMessage
+			assert.Equal(t, "", om.PathSecret)
+			assert.NotNil(t, om.ReplyBlindedPath)
+			assert.Equal(t, "0266e4598d1d3c415f572a8488830b60f7e744ed9235eb0b1ba93283b315c03518", om.ReplyBlindedPath.FirstNodeId)
+			assert.Equal(t, 2, len(om.ReplyBlindedPath.Hops))
+			assert.Equal(t, "aabb", om.ReplyBlindedPath.Hops[1].EncryptedRecipientData)
+			assert.Equal(t, "0a0b", om.InvoiceRequest)
+			assert.Equal(t, []glightning.OnionMessageField{{Number: 77, Value: "ff"}}, om.UnknownFields)
+			return event.Continue(), nil
+		},
+	})
+	msg := `{"jsonrpc":"2.0","id":"aloha","method":"onion_message_recv","params":{"onion_message":{"reply_blindedpath":{"first_node_id":"0266e4598d1d3c415f572a8488830b60f7e744ed9235eb0b1ba93283b315c03518","first_path_key":"02bb","hops":[{"blinded_node_id":"02cc","encrypted_recipient_data":"00"},{"blinded_node_id":"02dd","encrypted_recipient_data":"aabb"}]},"invoice_request":"0a0b","unknown_fields":[{"number":77,"value":"ff"}]}}}`
+	resp := `{"jsonrpc":"2.0","result":{"result":"continue"},"id":"aloha"}`
+	runTest(t, plugin, msg+"\n\n", resp)
+}
+
+func TestHook_OnionMessageRecvSecret(t *testing.T) {
+	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
+		t.Error("Should not have called init when calling get manifest")
+	})
+	plugin := glightning.NewPlugin(initFn)
+	plugin.RegisterHooks(&glightning.Hooks{
+		OnionMessageRecvSecret: func(event *glightning.OnionMessageRecvSecretEvent) (*glightning.OnionMessageResponse, error) {
+			assert.Equal(t, "5c85bf402b87d4860f4a728e2e58a2418bda92cd7aea0ce494f11670cfbfb206", event.OnionMessage.PathSecret)
+			assert.Equal(t, "0c0d", event.OnionMessage.Invoice)
+			return event.Continue(), nil
+		},
+	})
+	msg := `{"jsonrpc":"2.0","id":"aloha","method":"onion_message_recv_secret","params":{"onion_message":{"pathsecret":"5c85bf402b87d4860f4a728e2e58a2418bda92cd7aea0ce494f11670cfbfb206","invoice":"0c0d"}}}`
+	resp := `{"jsonrpc":"2.0","result":{"result":"continue"},"id":"aloha"}`
+	runTest(t, plugin, msg+"\n\n", resp)
+}
+
+func TestHook_CommitmentRevocation(t *testing.T) {
+	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
+		t.Error("Should not have called init when calling get manifest")
+	})
+	plugin := glightning.NewPlugin(initFn)
+	plugin.RegisterHooks(&glightning.Hooks{
+		CommitmentRevocation: func(event *glightning.CommitmentRevocationEvent) (*glightning.CommitmentRevocationResponse, error) {
+			assert.Equal(t, "58eea9a0ba8fb2e2c0b3c8d5f0e0f9bd69b4b4ba3d2d2d5b7b36b7bd2e2e3e52", event.CommitmentTxId)
+			assert.Equal(t, "02000000000101", event.PenaltyTx)
+			assert.Equal(t, "5c0b7f05822b0f6581cd3c588ffacfe5c5f835e1244934ea575065dd4480157c", event.ChannelId)
+			assert.Equal(t, uint64(12), event.CommitNum)
+			return event.Continue(), nil
+		},
+	})
+	msg := `{"jsonrpc":"2.0","id":"aloha","method":"commitment_revocation","params":{"commitment_txid":"58eea9a0ba8fb2e2c0b3c8d5f0e0f9bd69b4b4ba3d2d2d5b7b36b7bd2e2e3e52","penalty_tx":"02000000000101","channel_id":"5c0b7f05822b0f6581cd3c588ffacfe5c5f835e1244934ea575065dd4480157c","commitnum":12}}`
+	resp := `{"jsonrpc":"2.0","result":{"result":"continue"},"id":"aloha"}`
+	runTest(t, plugin, msg+"\n\n", resp)
+}
+
+func TestHook_OpenChannel2Fund(t *testing.T) {
+	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
+		t.Error("Should not have called init when calling get manifest")
+	})
+	plugin := glightning.NewPlugin(initFn)
+	plugin.RegisterHooks(&glightning.Hooks{
+		OpenChannel2: func(event *glightning.OpenChannel2Event) (*glightning.OpenChannel2Response, error) {
+			oc := event.OpenChannel2
+			assert.Equal(t, "03fb0b8a395a60084946eaf98cfb5a81ea010e0307eaf368ba21e7d6bcf0e4dc41", oc.PeerId)
+			assert.Equal(t, uint64(1000000000), oc.TheirFundingMsat)
+			assert.Equal(t, uint(7500), oc.FundingFeeratePerKw)
+			assert.Equal(t, uint32(101), oc.Locktime)
+			assert.True(t, oc.RequireConfirmedInputs)
+			assert.Equal(t, []string{"static_remotekey/even"}, oc.ChannelType.Names)
+
+			psbt := glightning.NewPsbt(oc.Locktime)
+			psbt.AddInput("5c0b7f05822b0f6581cd3c588ffacfe5c5f835e1244934ea575065dd4480157c", 1, glightning.DefaultSequence)
+			return event.Fund(psbt, glightning.NewMsat(500000000)), nil
+		},
+	})
+	msg := `{"jsonrpc":"2.0","id":"aloha","method":"openchannel2","params":{"openchannel2":{"id":"03fb0b8a395a60084946eaf98cfb5a81ea010e0307eaf368ba21e7d6bcf0e4dc41","channel_id":"252d1b0a1e57895e84137f28cf19ab2c35847e284c112fefdecc7afeaa5c1de7","their_funding_msat":1000000000,"dust_limit_msat":546000,"max_htlc_value_in_flight_msat":18446744073709551615,"htlc_minimum_msat":0,"funding_feerate_per_kw":7500,"commitment_feerate_per_kw":7500,"feerate_our_max":10000,"feerate_our_min":253,"to_self_delay":5,"max_accepted_htlcs":483,"channel_flags":1,"locktime":101,"channel_max_msat":16777215000,"require_confirmed_inputs":true,"channel_type":{"bits":[12],"names":["static_remotekey/even"]}}}}`
+	resp := `{"jsonrpc":"2.0","result":{"result":"continue","psbt":"cHNidP8BADMCAAAAAXwVgETdZVBX6jRJJOE1+MXlz/qPWDzNgWUPK4IFfwtcAQAAAAD9////AGUAAAAADPwJbGlnaHRuaW5nAQgAAAAAAAAAAQA=","our_funding_msat":500000000},"id":"aloha"}`
+	runTest(t, plugin, msg+"\n\n", resp)
+}
+
+func TestHook_RbfChannelReject(t *testing.T) {
+	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
+		t.Error("Should not have called init when calling get manifest")
+	})
+	plugin := glightning.NewPlugin(initFn)
+	plugin.RegisterHooks(&glightning.Hooks{
+		RbfChannel: func(event *glightning.RbfChannelEvent) (*glightning.OpenChannel2Response, error) {
+			assert.Equal(t, uint64(1000000000), event.RbfChannel.TheirLastFundingMsat)
+			assert.Equal(t, uint64(2000000000), event.RbfChannel.TheirCurrentFundingMsat)
+			return event.Reject("not today"), nil
+		},
+	})
+	msg := `{"jsonrpc":"2.0","id":"aloha","method":"rbf_channel","params":{"rbf_channel":{"id":"03fb0b8a395a60084946eaf98cfb5a81ea010e0307eaf368ba21e7d6bcf0e4dc41","channel_id":"252d1b0a1e57895e84137f28cf19ab2c35847e284c112fefdecc7afeaa5c1de7","their_last_funding_msat":1000000000,"their_current_funding_msat":2000000000,"our_last_funding_msat":0,"funding_feerate_per_kw":9000,"feerate_our_max":10000,"feerate_our_min":253,"channel_max_msat":16777215000,"locktime":102,"require_confirmed_inputs":false}}}`
+	resp := `{"jsonrpc":"2.0","result":{"result":"reject","error_message":"not today"},"id":"aloha"}`
+	runTest(t, plugin, msg+"\n\n", resp)
+}
+
+func TestHook_OpenChannel2Changed(t *testing.T) {
+	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
+		t.Error("Should not have called init when calling get manifest")
+	})
+	plugin := glightning.NewPlugin(initFn)
+	plugin.RegisterHooks(&glightning.Hooks{
+		OpenChannel2Changed: func(event *glightning.OpenChannel2ChangedEvent) (*glightning.OpenChannel2ChangedResponse, error) {
+			assert.Equal(t, "252d1b0a1e57895e84137f28cf19ab2c35847e284c112fefdecc7afeaa5c1de7", event.Changed.ChannelId)
+			psbt, err := event.ParsePsbt()
+			assert.Nil(t, err)
+			assert.Equal(t, 1, psbt.InputCount())
+			return event.Continue(), nil
+		},
+	})
+	msg := `{"jsonrpc":"2.0","id":"aloha","method":"openchannel2_changed","params":{"openchannel2_changed":{"channel_id":"252d1b0a1e57895e84137f28cf19ab2c35847e284c112fefdecc7afeaa5c1de7","psbt":"cHNidP8BADMCAAAAAXwVgETdZVBX6jRJJOE1+MXlz/qPWDzNgWUPK4IFfwtcAQAAAAD9////AGUAAAAADPwJbGlnaHRuaW5nAQgAAAAAAAAAAQA=","require_confirmed_inputs":false}}}`
+	resp := `{"jsonrpc":"2.0","result":{"result":"continue","psbt":"cHNidP8BADMCAAAAAXwVgETdZVBX6jRJJOE1+MXlz/qPWDzNgWUPK4IFfwtcAQAAAAD9////AGUAAAAADPwJbGlnaHRuaW5nAQgAAAAAAAAAAQA="},"id":"aloha"}`
+	runTest(t, plugin, msg+"\n\n", resp)
+}
+
+func TestHook_OpenChannel2Sign(t *testing.T) {
+	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
+		t.Error("Should not have called init when calling get manifest")
+	})
+	plugin := glightning.NewPlugin(initFn)
+	plugin.RegisterHooks(&glightning.Hooks{
+		OpenChannel2Sign: func(event *glightning.OpenChannel2SignEvent) (*glightning.OpenChannel2SignResponse, error) {
+			psbt, err := event.ParsePsbt()
+			assert.Nil(t, err)
+			assert.Equal(t, []uint{0}, psbt.InputsFor(glightning.TxAccepter))
+			return event.Signed("c2lnbmVk"), nil
+		},
+	})
+	msg := `{"jsonrpc":"2.0","id":"aloha","method":"openchannel2_sign","params":{"openchannel2_sign":{"channel_id":"252d1b0a1e57895e84137f28cf19ab2c35847e284c112fefdecc7afeaa5c1de7","psbt":"cHNidP8BADMCAAAAAXwVgETdZVBX6jRJJOE1+MXlz/qPWDzNgWUPK4IFfwtcAQAAAAD9////AGUAAAAADPwJbGlnaHRuaW5nAQgAAAAAAAAAAQA="}}}`
+	resp := `{"jsonrpc":"2.0","result":{"result":"continue","psbt":"c2lnbmVk"},"id":"aloha"}`
+	runTest(t, plugin, msg+"\n\n", resp)
+}
+
 func TestSubscription_SendPaySuccess(t *testing.T) {
 	var wg sync.WaitGroup
 	defer await(t, &wg)
@@ -725,6 +1368,229 @@ func TestSubscription_Disconnected(t *testing.T) {
 	runTest(t, plugin, msg+"\n\n", "")
 }
 
+func TestSubscription_ChannelStateChanged(t *testing.T) {
+	var wg sync.WaitGroup
+	defer await(t, &wg)
+
+	wg.Add(1)
+	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
+		t.Error("Should not have called init when calling get manifest")
+	})
+	plugin := glightning.NewPlugin(initFn)
+	plugin.SubscribeChannelStateChanged(func(event *glightning.ChannelStateChanged) {
+		defer wg.Done()
+		expected := &glightning.ChannelStateChanged{
+			PeerId:    "03bc9337c7a28bb784d67742ebedd30a93bacdf7e4ca16436ef3798000242b2251",
+			ChannelId: "a2d0851832f0e30a0cf778a826d72f077ca86b69f72677e0267f23f63a0599b4",
+			Timestamp: "2023-01-05T18:27:12.145Z",
+			NewState:  "DUALOPEND_OPEN_INIT",
+			Cause:     "user",
+			Message:   "Sigs exchanged, waiting for lock-in",
+		}
+		assert.Equal(t, expected, event)
+	})
+
+	msg := `{"jsonrpc":"2.0","method":"channel_state_changed","params":{"channel_state_changed":{"peer_id":"03bc9337c7a28bb784d67742ebedd30a93bacdf7e4ca16436ef3798000242b2251","channel_id":"a2d0851832f0e30a0cf778a826d72f077ca86b69f72677e0267f23f63a0599b4","timestamp":"2023-01-05T18:27:12.145Z","old_state":null,"new_state":"DUALOPEND_OPEN_INIT","cause":"user","message":"Sigs exchanged, waiting for lock-in"}}}`
+
+	runTest(t, plugin, msg+"\n\n", "")
+}
+
+func TestSubscription_CoinMovement(t *testing.T) {
+	var wg sync.WaitGroup
+	defer await(t, &wg)
+
+	wg.Add(1)
+	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
+		t.Error("Should not have called init when calling get manifest")
+	})
+	plugin := glightning.NewPlugin(initFn)
+	plugin.SubscribeCoinMovement(func(event *glightning.CoinMovement) {
+		defer wg.Done()
+		expected := &glightning.CoinMovement{
+			Version:     2,
+			NodeId:      "03a7103a2322b811f7369cbb27fb213d30bbc0b012082fed3cad7e4498da2dc56b",
+			Type:        glightning.ChainMovement,
+			AccountId:   "wallet",
+			TxId:        "0159693d8f3876b4def468b208712c630309381e9d106a9836fa0a9571a28722",
+			UtxoTxId:    "0159693d8f3876b4def468b208712c630309381e9d106a9836fa0a9571a28722",
+			Vout:        1,
+			CreditMsat:  2000000000,
+			OutputMsat:  2000000000,
+			Tags:        []string{"deposit"},
+			BlockHeight: 102,
+			Timestamp:   1585948198,
+			CoinType:    "bcrt",
+		}
+		assert.Equal(t, expected, event)
+	})
+
+	msg := `{"jsonrpc":"2.0","method":"coin_movement","params":{"coin_movement":{"version":2,"node_id":"03a7103a2322b811f7369cbb27fb213d30bbc0b012082fed3cad7e4498da2dc56b","type":"chain_mvt","account_id":"wallet","txid":"0159693d8f3876b4def468b208712c630309381e9d106a9836fa0a9571a28722","utxo_txid":"0159693d8f3876b4def468b208712c630309381e9d106a9836fa0a9571a28722","vout":1,"credit_msat":2000000000,"debit_msat":0,"output_msat":2000000000,"tags":["deposit"],"blockheight":102,"timestamp":1585948198,"coin_type":"bcrt"}}}`
+
+	runTest(t, plugin, msg+"\n\n", "")
+}
+
+func TestSubscription_BalanceSnapshot(t *testing.T) {
+	var wg sync.WaitGroup
+	defer await(t, &wg)
+
+	wg.Add(1)
+	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
+		t.Error("Should not have called init when calling get manifest")
+	})
+	plugin := glightning.NewPlugin(initFn)
+	plugin.SubscribeBalanceSnapshot(func(event *glightning.BalanceSnapshot) {
+		defer wg.Done()
+		expected := &glightning.BalanceSnapshot{
+			NodeId:      "035d2b1192dfba134e10e540875d366ebc8bc353d5aa766b80c090b39c3a5d885d",
+			BlockHeight: 101,
+			Timestamp:   1639076327,
+			Accounts: []*glightning.AccountBalance{
+				{
+					AccountId:   "wallet",
+					BalanceMsat: 1000000000,
+					CoinType:    "bcrt",
+				},
+				{
+					AccountId:   "5b65c199ee862f49758603a5a29081912c8816a7c0243d1667489d244d3d055f",
+					BalanceMsat: 500000000,
+					CoinType:    "bcrt",
+				},
+			},
+		}
+		assert.Equal(t, expected, event)
+	})
+
+	msg := `{"jsonrpc":"2.0","method":"balance_snapshot","params":{"balance_snapshot":{"node_id":"035d2b1192dfba134e10e540875d366ebc8bc353d5aa766b80c090b39c3a5d885d","blockheight":101,"timestamp":1639076327,"accounts":[{"account_id":"wallet","balance_msat":1000000000,"coin_type":"bcrt"},{"account_id":"5b65c199ee862f49758603a5a29081912c8816a7c0243d1667489d244d3d055f","balance_msat":500000000,"coin_type":"bcrt"}]}}}`
+
+	runTest(t, plugin, msg+"\n\n", "")
+}
+
+func TestSubscription_BlockAdded(t *testing.T) {
+	var wg sync.WaitGroup
+	defer await(t, &wg)
+
+	wg.Add(1)
+	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
+		t.Error("Should not have called init when calling get manifest")
+	})
+	plugin := glightning.NewPlugin(initFn)
+	plugin.SubscribeBlockAdded(func(event *glightning.BlockAdded) {
+		defer wg.Done()
+		expected := &glightning.BlockAdded{
+			Hash:   "000000000000000000034ddb1ffdf6c4e0b85d8a3bc0ba5c87f2e6d4d1e4d1f3",
+			Height: 753304,
+		}
+		assert.Equal(t, expected, event)
+	})
+
+	msg := `{"jsonrpc":"2.0","method":"block_added","params":{"block_added":{"hash":"000000000000000000034ddb1ffdf6c4e0b85d8a3bc0ba5c87f2e6d4d1e4d1f3","height":753304}}}`
+
+	runTest(t, plugin, msg+"\n\n", "")
+}
+
+func TestSubscription_InvoiceCreation(t *testing.T) {
+	var wg sync.WaitGroup
+	defer await(t, &wg)
+
+	wg.Add(1)
+	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
+		t.Error("Should not have called init when calling get manifest")
+	})
+	plugin := glightning.NewPlugin(initFn)
+	plugin.SubscribeInvoiceCreation(func(event *glightning.InvoiceCreation) {
+		defer wg.Done()
+		expected := &glightning.InvoiceCreation{
+			Label:         "test_4",
+			PreImage:      "09d686f01fbbc6d36996f6c68b09d62600b9da32bd249892904350e31bc51c6e",
+			MilliSatoshis: 50000,
+		}
+		assert.Equal(t, expected, event)
+	})
+
+	msg := `{"jsonrpc":"2.0","method":"invoice_creation","params":{"invoice_creation":{"label":"test_4","preimage":"09d686f01fbbc6d36996f6c68b09d62600b9da32bd249892904350e31bc51c6e","msat":50000}}}`
+
+	runTest(t, plugin, msg+"\n\n", "")
+}
+
+func TestSubscription_Shutdown(t *testing.T) {
+	var wg sync.WaitGroup
+	defer await(t, &wg)
+
+	wg.Add(1)
+	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
+		t.Error("Should not have called init when calling get manifest")
+	})
+	plugin := glightning.NewPlugin(initFn)
+	plugin.SubscribeShutdown(func() {
+		wg.Done()
+	})
+
+	msg := `{"jsonrpc":"2.0","method":"shutdown","params":{}}`
+
+	runTest(t, plugin, msg+"\n\n", "")
+}
+
+func TestSubscription_CustomTopic(t *testing.T) {
+	var wg sync.WaitGroup
+	defer await(t, &wg)
+
+	wg.Add(1)
+	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
+		t.Error("Should not have called init when calling get manifest")
+	})
+	plugin := glightning.NewPlugin(initFn)
+	plugin.SubscribeTopic("catnap", func(n *glightning.RawNotification) {
+		defer wg.Done()
+		assert.Equal(t, "catnap", n.Method)
+		assert.Equal(t, "napper.go", n.Origin)
+		var nap struct {
+			Hours int `json:"hours"`
+		}
+		assert.Nil(t, n.ParsePayload(&nap))
+		assert.Equal(t, 16, nap.Hours)
+	})
+
+	msg := `{"jsonrpc":"2.0","method":"catnap","params":{"origin":"napper.go","payload":{"hours":16}}}`
+
+	runTest(t, plugin, msg+"\n\n", "")
+}
+
+func TestSubscription_All(t *testing.T) {
+	var wg sync.WaitGroup
+	defer await(t, &wg)
+
+	// connect goes to both subscriptions
+	wg.Add(3)
+	initFn := getInitFunc(t, func(t *testing.T, options map[string]glightning.Option, config *glightning.Config) {
+		t.Error("Should not have called init when calling get manifest")
+	})
+	plugin := glightning.NewPlugin(initFn)
+	plugin.SubscribeConnect(func(event *glightning.ConnectEvent) {
+		defer wg.Done()
+		assert.Equal(t, "02c0114aac5ea2bce7759eb48d5aa75129700c1eb7fe6cc8743968a202f26505d6", event.PeerId)
+	})
+	var mu sync.Mutex
+	seen := make(map[string]string)
+	plugin.SubscribeAll(func(n *glightning.RawNotification) {
+		defer wg.Done()
+		var event struct {
+			Id string `json:"id"`
+		}
+		assert.Nil(t, n.ParsePayload(&event))
+		mu.Lock()
+		seen[n.Method] = event.Id
+		mu.Unlock()
+	})
+
+	msg := `{"jsonrpc":"2.0","method":"connect","params":{"id":"02c0114aac5ea2bce7759eb48d5aa75129700c1eb7fe6cc8743968a202f26505d6","address":{"type":"ipv4","address":"127.0.0.1","port":9090}}}`
+	msg += "\n\n" + `{"jsonrpc":"2.0","method":"disconnect","params":{"id":"02c0114aac5ea2bce7759eb48d5aa75129700c1eb7fe6cc8743968a202f26505d6"}}`
+
+	runTest(t, plugin, msg+"\n\n", "")
+	await(t, &wg)
+	assert.Equal(t, "02c0114aac5ea2bce7759eb48d5aa75129700c1eb7fe6cc8743968a202f26505d6", seen["connect"])
+	assert.Equal(t, "02c0114aac5ea2bce7759eb48d5aa75129700c1eb7fe6cc8743968a202f26505d6", seen["disconnect"])
+}
+
 func await(t *testing.T, wg *sync.WaitGroup) {
 	awaitWithTimeout(t, wg, 1*time.Second)
 }
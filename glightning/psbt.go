@@ -0,0 +1,550 @@
+package glightning
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// A minimal BIP174 partially signed bitcoin transaction.
+// It knows enough to add inputs and outputs to a PSBT, combine
+// two of them and tag their lightning serial_ids, which is
+// what you need to contribute funds to a dual-funded channel.
+// Every other field is passed through untouched.
+//
+// Both version 0 and version 2 (BIP370) PSBTs are supported.
+type Psbt struct {
+	Global  []*PsbtField
+	Inputs  [][]*PsbtField
+	Outputs [][]*PsbtField
+
+	// v0 only: the unsigned tx (global key 0x00)
+	tx *psbtTx
+}
+
+// A single key-value pair from one of a PSBT's maps. The Key
+// includes the leading key type.
+type PsbtField struct {
+	Key   []byte
+	Value []byte
+}
+
+func (f *PsbtField) Type() byte {
+	return f.Key[0]
+}
+
+// Which side of a dual-funded open we are. The opener's inputs
+// and outputs get even serial_ids, the accepter's odd ones.
+type TxRole int
+
+const (
+	TxOpener TxRole = iota
+	TxAccepter
+)
+
+const (
+	psbtGlobalUnsignedTx  byte = 0x00
+	psbtGlobalInputCount  byte = 0x04
+	psbtGlobalOutputCount byte = 0x05
+	psbtGlobalVersion     byte = 0xfb
+	psbtInPreviousTxid    byte = 0x0e
+	psbtInOutputIndex     byte = 0x0f
+	psbtInSequence        byte = 0x10
+	psbtOutAmount         byte = 0x03
+	psbtOutScript         byte = 0x04
+	psbtProprietary       byte = 0xfc
+	psbtLightningSerialId byte = 0x01
+	psbtLightningPrefix        = "lightning"
+	psbtMagic                  = "psbt\xff"
+)
+
+// nSequence for new inputs; signals RBF
+const DefaultSequence uint32 = 0xfffffffd
+
+// An empty v0 PSBT, for a version 2 tx with {locktime}
+func NewPsbt(locktime uint32) *Psbt {
+	p := &Psbt{
+		Inputs:  make([][]*PsbtField, 0),
+		Outputs: make([][]*PsbtField, 0),
+		tx: &psbtTx{
+			version:  2,
+			locktime: locktime,
+		},
+	}
+	p.sync()
+	return p
+}
+
+// Parse a base64 encoded PSBT, as passed around by lightningd
+func DecodePsbt(b64 string) (*Psbt, error) {
+	raw, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePsbt(raw)
+}
+
+// Parse a binary PSBT
+func ParsePsbt(raw []byte) (*Psbt, error) {
+	if !bytes.HasPrefix(raw, []byte(psbtMagic)) {
+		return nil, errors.New("Not a PSBT: missing magic bytes")
+	}
+	r := bytes.NewReader(raw[len(psbtMagic):])
+
+	p := &Psbt{}
+	var err error
+	p.Global, err = readPsbtMap(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var inputs, outputs uint64
+	if p.Version() == 0 {
+		field := p.global(psbtGlobalUnsignedTx)
+		if field == nil {
+			return nil, errors.New("PSBT is missing its unsigned tx")
+		}
+		p.tx, err = parsePsbtTx(field.Value)
+		if err != nil {
+			return nil, err
+		}
+		inputs, outputs = uint64(len(p.tx.ins)), uint64(len(p.tx.outs))
+	} else {
+		if inputs, err = p.globalCount(psbtGlobalInputCount); err != nil {
+			return nil, err
+		}
+		if outputs, err = p.globalCount(psbtGlobalOutputCount); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := uint64(0); i < inputs; i++ {
+		m, err := readPsbtMap(r)
+		if err != nil {
+			return nil, err
+		}
+		p.Inputs = append(p.Inputs, m)
+	}
+	for i := uint64(0); i < outputs; i++ {
+		m, err := readPsbtMap(r)
+		if err != nil {
+			return nil, err
+		}
+		p.Outputs = append(p.Outputs, m)
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("%d trailing bytes after PSBT", r.Len())
+	}
+	return p, nil
+}
+
+// Base64 encoding of the PSBT, ready to hand back to lightningd
+func (p *Psbt) Encode() string {
+	return base64.StdEncoding.EncodeToString(p.Bytes())
+}
+
+func (p *Psbt) Bytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(psbtMagic)
+	writePsbtMap(&buf, p.Global)
+	for _, m := range p.Inputs {
+		writePsbtMap(&buf, m)
+	}
+	for _, m := range p.Outputs {
+		writePsbtMap(&buf, m)
+	}
+	return buf.Bytes()
+}
+
+// The PSBT version, 0 or 2
+func (p *Psbt) Version() uint32 {
+	field := p.global(psbtGlobalVersion)
+	if field == nil || len(field.Value) != 4 {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(field.Value)
+}
+
+func (p *Psbt) InputCount() int {
+	return len(p.Inputs)
+}
+
+func (p *Psbt) OutputCount() int {
+	return len(p.Outputs)
+}
+
+// Add an input spending {vout} of {txid}. The txid is hex, in
+// the usual (reversed) display order.
+func (p *Psbt) AddInput(txid string, vout uint32, sequence uint32) error {
+	prev, err := hex.DecodeString(txid)
+	if err != nil {
+		return err
+	}
+	if len(prev) != 32 {
+		return fmt.Errorf("Invalid txid %s", txid)
+	}
+	reverse(prev)
+
+	var m []*PsbtField
+	if p.Version() == 0 {
+		in := &psbtTxIn{vout: vout, sequence: sequence}
+		copy(in.prevTxid[:], prev)
+		p.tx.ins = append(p.tx.ins, in)
+	} else {
+		m = []*PsbtField{
+			{Key: []byte{psbtInPreviousTxid}, Value: prev},
+			{Key: []byte{psbtInOutputIndex}, Value: le32(vout)},
+			{Key: []byte{psbtInSequence}, Value: le32(sequence)},
+		}
+	}
+	p.Inputs = append(p.Inputs, m)
+	p.sync()
+	return nil
+}
+
+// Add an output paying {amount} to {script}
+func (p *Psbt) AddOutput(amount *Sat, script []byte) {
+	var m []*PsbtField
+	if p.Version() == 0 {
+		p.tx.outs = append(p.tx.outs, &psbtTxOut{
+			value:  amount.Value,
+			script: script,
+		})
+	} else {
+		value := make([]byte, 8)
+		binary.LittleEndian.PutUint64(value, amount.Value)
+		m = []*PsbtField{
+			{Key: []byte{psbtOutAmount}, Value: value},
+			{Key: []byte{psbtOutScript}, Value: script},
+		}
+	}
+	p.Outputs = append(p.Outputs, m)
+	p.sync()
+}
+
+// Append {other}'s inputs and outputs to this PSBT, eg to add the
+// result of `fundpsbt` to a peer's funding PSBT. Both need to be
+// the same version.
+func (p *Psbt) Merge(other *Psbt) error {
+	if p.Version() != other.Version() {
+		return fmt.Errorf("Can't merge a v%d PSBT into a v%d one", other.Version(), p.Version())
+	}
+	if p.Version() == 0 {
+		p.tx.ins = append(p.tx.ins, other.tx.ins...)
+		p.tx.outs = append(p.tx.outs, other.tx.outs...)
+	}
+	p.Inputs = append(p.Inputs, other.Inputs...)
+	p.Outputs = append(p.Outputs, other.Outputs...)
+	p.sync()
+	return nil
+}
+
+// Give every input and output that doesn't have a serial_id yet
+// a fresh one, with the right parity for {role}. lightningd
+// uses these to order the funding tx, and to tell whose
+// inputs are whose.
+func (p *Psbt) AddSerialIds(role TxRole) {
+	used := make(map[uint64]bool)
+	for _, maps := range [][][]*PsbtField{p.Inputs, p.Outputs} {
+		for _, m := range maps {
+			if id, ok := serialId(m); ok {
+				used[id] = true
+			}
+		}
+	}
+
+	next := uint64(role)
+	assign := func(maps [][]*PsbtField) {
+		for i, m := range maps {
+			if _, ok := serialId(m); ok {
+				continue
+			}
+			for used[next] {
+				next += 2
+			}
+			used[next] = true
+			value := make([]byte, 8)
+			binary.BigEndian.PutUint64(value, next)
+			maps[i] = append(m, &PsbtField{
+				Key:   serialIdKey(),
+				Value: value,
+			})
+		}
+	}
+	assign(p.Inputs)
+	assign(p.Outputs)
+}
+
+// The serial_id of input {i}, if it has one
+func (p *Psbt) InputSerialId(i int) (uint64, bool) {
+	return serialId(p.Inputs[i])
+}
+
+// The serial_id of output {i}, if it has one
+func (p *Psbt) OutputSerialId(i int) (uint64, bool) {
+	return serialId(p.Outputs[i])
+}
+
+// Indexes of the inputs {role} added, going by their serial_ids.
+// In the openchannel2_sign hook, these are the ones to pass to
+// `signpsbt`.
+func (p *Psbt) InputsFor(role TxRole) []uint {
+	indexes := make([]uint, 0)
+	for i, m := range p.Inputs {
+		if id, ok := serialId(m); ok && id%2 == uint64(role) {
+			indexes = append(indexes, uint(i))
+		}
+	}
+	return indexes
+}
+
+func (p *Psbt) global(keyType byte) *PsbtField {
+	for _, f := range p.Global {
+		if len(f.Key) == 1 && f.Type() == keyType {
+			return f
+		}
+	}
+	return nil
+}
+
+func (p *Psbt) globalCount(keyType byte) (uint64, error) {
+	field := p.global(keyType)
+	if field == nil {
+		return 0, fmt.Errorf("v2 PSBT is missing global field %#x", keyType)
+	}
+	return readCompactSize(bytes.NewReader(field.Value))
+}
+
+// Bring the global fields back in line with the input
+// and output maps
+func (p *Psbt) sync() {
+	if p.Version() == 0 {
+		p.setGlobal(psbtGlobalUnsignedTx, p.tx.serialize())
+		return
+	}
+	var buf bytes.Buffer
+	writeCompactSize(&buf, uint64(len(p.Inputs)))
+	p.setGlobal(psbtGlobalInputCount, buf.Bytes())
+	buf = bytes.Buffer{}
+	writeCompactSize(&buf, uint64(len(p.Outputs)))
+	p.setGlobal(psbtGlobalOutputCount, buf.Bytes())
+}
+
+func (p *Psbt) setGlobal(keyType byte, value []byte) {
+	if field := p.global(keyType); field != nil {
+		field.Value = value
+		return
+	}
+	p.Global = append(p.Global, &PsbtField{
+		Key:   []byte{keyType},
+		Value: value,
+	})
+}
+
+func serialIdKey() []byte {
+	key := []byte{psbtProprietary, byte(len(psbtLightningPrefix))}
+	key = append(key, psbtLightningPrefix...)
+	return append(key, psbtLightningSerialId)
+}
+
+func serialId(m []*PsbtField) (uint64, bool) {
+	key := serialIdKey()
+	for _, f := range m {
+		if bytes.Equal(f.Key, key) && len(f.Value) == 8 {
+			return binary.BigEndian.Uint64(f.Value), true
+		}
+	}
+	return 0, false
+}
+
+func readPsbtMap(r *bytes.Reader) ([]*PsbtField, error) {
+	m := make([]*PsbtField, 0)
+	for {
+		key, err := readVarBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		// a zero-length key ends the map
+		if len(key) == 0 {
+			return m, nil
+		}
+		value, err := readVarBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		m = append(m, &PsbtField{key, value})
+	}
+}
+
+func writePsbtMap(buf *bytes.Buffer, m []*PsbtField) {
+	for _, f := range m {
+		writeVarBytes(buf, f.Key)
+		writeVarBytes(buf, f.Value)
+	}
+	buf.WriteByte(0x00)
+}
+
+// A PSBT's unsigned tx, which never has scriptSigs or witnesses
+type psbtTx struct {
+	version  uint32
+	ins      []*psbtTxIn
+	outs     []*psbtTxOut
+	locktime uint32
+}
+
+type psbtTxIn struct {
+	prevTxid [32]byte
+	vout     uint32
+	script   []byte
+	sequence uint32
+}
+
+type psbtTxOut struct {
+	value  uint64
+	script []byte
+}
+
+func parsePsbtTx(raw []byte) (*psbtTx, error) {
+	r := bytes.NewReader(raw)
+	tx := &psbtTx{}
+	if err := binary.Read(r, binary.LittleEndian, &tx.version); err != nil {
+		return nil, err
+	}
+	count, err := readCompactSize(r)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < count; i++ {
+		in := &psbtTxIn{}
+		if _, err := io.ReadFull(r, in.prevTxid[:]); err != nil {
+			return nil, err
+		}
+		if err := binary.Read(r, binary.LittleEndian, &in.vout); err != nil {
+			return nil, err
+		}
+		if in.script, err = readVarBytes(r); err != nil {
+			return nil, err
+		}
+		if err := binary.Read(r, binary.LittleEndian, &in.sequence); err != nil {
+			return nil, err
+		}
+		tx.ins = append(tx.ins, in)
+	}
+	count, err = readCompactSize(r)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < count; i++ {
+		out := &psbtTxOut{}
+		if err := binary.Read(r, binary.LittleEndian, &out.value); err != nil {
+			return nil, err
+		}
+		if out.script, err = readVarBytes(r); err != nil {
+			return nil, err
+		}
+		tx.outs = append(tx.outs, out)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &tx.locktime); err != nil {
+		return nil, err
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("Trailing bytes after the PSBT's unsigned tx")
+	}
+	return tx, nil
+}
+
+func (tx *psbtTx) serialize() []byte {
+	var buf bytes.Buffer
+	buf.Write(le32(tx.version))
+	writeCompactSize(&buf, uint64(len(tx.ins)))
+	for _, in := range tx.ins {
+		buf.Write(in.prevTxid[:])
+		buf.Write(le32(in.vout))
+		writeVarBytes(&buf, in.script)
+		buf.Write(le32(in.sequence))
+	}
+	writeCompactSize(&buf, uint64(len(tx.outs)))
+	for _, out := range tx.outs {
+		value := make([]byte, 8)
+		binary.LittleEndian.PutUint64(value, out.value)
+		buf.Write(value)
+		writeVarBytes(&buf, out.script)
+	}
+	buf.Write(le32(tx.locktime))
+	return buf.Bytes()
+}
+
+func readCompactSize(r *bytes.Reader) (uint64, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	var size int
+	switch b {
+	case 0xfd:
+		size = 2
+	case 0xfe:
+		size = 4
+	case 0xff:
+		size = 8
+	default:
+		return uint64(b), nil
+	}
+	raw := make([]byte, 8)
+	if _, err := io.ReadFull(r, raw[:size]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(raw), nil
+}
+
+func writeCompactSize(buf *bytes.Buffer, n uint64) {
+	raw := make([]byte, 8)
+	binary.LittleEndian.PutUint64(raw, n)
+	switch {
+	case n < 0xfd:
+		buf.WriteByte(byte(n))
+	case n <= 0xffff:
+		buf.WriteByte(0xfd)
+		buf.Write(raw[:2])
+	case n <= 0xffffffff:
+		buf.WriteByte(0xfe)
+		buf.Write(raw[:4])
+	default:
+		buf.WriteByte(0xff)
+		buf.Write(raw)
+	}
+}
+
+func readVarBytes(r *bytes.Reader) ([]byte, error) {
+	size, err := readCompactSize(r)
+	if err != nil {
+		return nil, err
+	}
+	if size > uint64(r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	data := make([]byte, size)
+	_, err = io.ReadFull(r, data)
+	return data, err
+}
+
+func writeVarBytes(buf *bytes.Buffer, data []byte) {
+	writeCompactSize(buf, uint64(len(data)))
+	buf.Write(data)
+}
+
+func le32(n uint32) []byte {
+	raw := make([]byte, 4)
+	binary.LittleEndian.PutUint32(raw, n)
+	return raw
+}
+
+func reverse(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
@@ -0,0 +1,92 @@
+package glightning_test
+
+import (
+	"encoding/hex"
+	"github.com/niftynei/glightning/glightning"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const fundingTxid = "5c0b7f05822b0f6581cd3c588ffacfe5c5f835e1244934ea575065dd4480157c"
+
+func p2wpkh(t *testing.T) []byte {
+	script, err := hex.DecodeString("0014d952a5ff3c78ca2c48fd8e2b4ae0699887dd166e")
+	assert.Nil(t, err)
+	return script
+}
+
+func TestPsbtRoundTrip(t *testing.T) {
+	psbt := glightning.NewPsbt(101)
+	assert.Nil(t, psbt.AddInput(fundingTxid, 1, glightning.DefaultSequence))
+	psbt.AddOutput(glightning.NewSat(90000), p2wpkh(t))
+
+	// 1 input spending txid:1, 1 output of 90000 sats, locktime 101
+	expected := "70736274ff01005202000000" +
+		"017c158044dd655057ea344924e135f8c5e5cffa8f583ccd81650f2b82057f0b5c0100000000fdffffff" +
+		"01905f010000000000160014d952a5ff3c78ca2c48fd8e2b4ae0699887dd166e65000000" +
+		"000000"
+	assert.Equal(t, expected, hex.EncodeToString(psbt.Bytes()))
+
+	decoded, err := glightning.DecodePsbt(psbt.Encode())
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(0), decoded.Version())
+	assert.Equal(t, 1, decoded.InputCount())
+	assert.Equal(t, 1, decoded.OutputCount())
+	assert.Equal(t, psbt.Encode(), decoded.Encode())
+
+	_, err = glightning.DecodePsbt("cHNidP8=")
+	assert.NotNil(t, err)
+}
+
+func TestPsbtMergeAndSerialIds(t *testing.T) {
+	theirs := glightning.NewPsbt(0)
+	assert.Nil(t, theirs.AddInput(fundingTxid, 0, glightning.DefaultSequence))
+	theirs.AddSerialIds(glightning.TxOpener)
+
+	ours := glightning.NewPsbt(0)
+	assert.Nil(t, ours.AddInput(fundingTxid, 2, glightning.DefaultSequence))
+	assert.Nil(t, ours.AddInput(fundingTxid, 3, glightning.DefaultSequence))
+	ours.AddOutput(glightning.NewSat(1000), p2wpkh(t))
+
+	assert.Nil(t, theirs.Merge(ours))
+	theirs.AddSerialIds(glightning.TxAccepter)
+
+	// survives a round trip
+	combined, err := glightning.DecodePsbt(theirs.Encode())
+	assert.Nil(t, err)
+	assert.Equal(t, 3, combined.InputCount())
+	assert.Equal(t, 1, combined.OutputCount())
+
+	id, ok := combined.InputSerialId(0)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(0), id)
+	id, _ = combined.InputSerialId(1)
+	assert.Equal(t, uint64(1), id)
+	id, _ = combined.InputSerialId(2)
+	assert.Equal(t, uint64(3), id)
+	id, _ = combined.OutputSerialId(0)
+	assert.Equal(t, uint64(5), id)
+
+	assert.Equal(t, []uint{1, 2}, combined.InputsFor(glightning.TxAccepter))
+	assert.Equal(t, []uint{0}, combined.InputsFor(glightning.TxOpener))
+}
+
+func TestPsbtV2(t *testing.T) {
+	// an empty v2 psbt: tx version 2, 0 inputs, 0 outputs, psbt version 2
+	raw, _ := hex.DecodeString("70736274ff" +
+		"01020402000000" + "010401" + "00" + "010501" + "00" + "01fb0402000000" + "00")
+	psbt, err := glightning.ParsePsbt(raw)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(2), psbt.Version())
+	assert.Equal(t, 0, psbt.InputCount())
+
+	assert.Nil(t, psbt.AddInput(fundingTxid, 1, glightning.DefaultSequence))
+	psbt.AddOutput(glightning.NewSat(1000), p2wpkh(t))
+
+	decoded, err := glightning.DecodePsbt(psbt.Encode())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, decoded.InputCount())
+	assert.Equal(t, 1, decoded.OutputCount())
+
+	assert.NotNil(t, decoded.Merge(glightning.NewPsbt(0)))
+}
@@ -0,0 +1,249 @@
+package glightning
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The conditions a rune restriction can put on a field
+type RuneCondition string
+
+const (
+	RuneMissing        RuneCondition = "!"
+	RuneEqual          RuneCondition = "="
+	RuneNotEqual       RuneCondition = "/"
+	RuneBeginsWith     RuneCondition = "^"
+	RuneEndsWith       RuneCondition = "$"
+	RuneContains       RuneCondition = "~"
+	RuneIntLessThan    RuneCondition = "<"
+	RuneIntGreaterThan RuneCondition = ">"
+	RuneLexBefore      RuneCondition = "{"
+	RuneLexAfter       RuneCondition = "}"
+	RuneComment        RuneCondition = "#"
+)
+
+const runeConditions = "!=/^$~<>{}#"
+
+// The length of a rune's authcode, a sha256 midstate
+const runeAuthCodeLen = 32
+
+// A Rune is a bearer token, created by lightningd, that lets whoever
+// holds it run the commands its restrictions allow. Every restriction
+// must be met, and a restriction is met if any of its alternatives is.
+//
+// Restrictions can be added to a rune, but never taken away. Adding
+// them means hashing them into the authcode, which isn't done here:
+// pass the rune to AddRuneRestrictions to have lightningd do it.
+type Rune struct {
+	AuthCode     []byte
+	Restrictions []*RuneRestriction
+}
+
+type RuneRestriction struct {
+	Alternatives []*RuneAlternative
+}
+
+type RuneAlternative struct {
+	Field     string
+	Condition RuneCondition
+	Value     string
+}
+
+// Decode a rune, as returned by createrune, without checking it
+func DecodeRune(encoded string) (*Rune, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		return nil, fmt.Errorf("Rune isn't base64: %s", err)
+	}
+	if len(raw) < runeAuthCodeLen {
+		return nil, fmt.Errorf("Rune is too short")
+	}
+	restrictions, err := ParseRuneRestrictions(string(raw[runeAuthCodeLen:]))
+	if err != nil {
+		return nil, err
+	}
+	return &Rune{
+		AuthCode:     raw[:runeAuthCodeLen],
+		Restrictions: restrictions,
+	}, nil
+}
+
+// Parse the restrictions part of a rune, eg
+// "method=listpeers|method=getinfo&time<1656920538"
+func ParseRuneRestrictions(s string) ([]*RuneRestriction, error) {
+	var restrictions []*RuneRestriction
+	rest := s
+	for rest != "" {
+		var restriction RuneRestriction
+		for {
+			alt, next, end, err := parseRuneAlternative(rest)
+			if err != nil {
+				return nil, err
+			}
+			restriction.Alternatives = append(restriction.Alternatives, alt)
+			rest = next
+			if end != '|' {
+				break
+			}
+		}
+		restrictions = append(restrictions, &restriction)
+	}
+	return restrictions, nil
+}
+
+// Parse one alternative off the front of {s}. Returns what's left
+// after it, and the separator that ended it, if any
+func parseRuneAlternative(s string) (*RuneAlternative, string, byte, error) {
+	split := strings.IndexAny(s, runeConditions)
+	if split < 0 {
+		return nil, "", 0, fmt.Errorf("Rune restriction %q has no condition", s)
+	}
+	alt := &RuneAlternative{
+		Field:     s[:split],
+		Condition: RuneCondition(s[split : split+1]),
+	}
+	for _, c := range alt.Field {
+		if !isRuneFieldChar(c) {
+			return nil, "", 0, fmt.Errorf("Bad rune field name %q", alt.Field)
+		}
+	}
+
+	var value bytes.Buffer
+	for i := split + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+			if i == len(s) {
+				return nil, "", 0, fmt.Errorf("Rune ends with an escape")
+			}
+			value.WriteByte(s[i])
+		case '|', '&':
+			alt.Value = value.String()
+			return alt, s[i+1:], s[i], nil
+		default:
+			value.WriteByte(s[i])
+		}
+	}
+	alt.Value = value.String()
+	return alt, "", 0, nil
+}
+
+func isRuneFieldChar(c rune) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (r *Rune) String() string {
+	var buf bytes.Buffer
+	buf.Write(r.AuthCode)
+	buf.WriteString(RuneRestrictionsString(r.Restrictions))
+	return base64.URLEncoding.EncodeToString(buf.Bytes())
+}
+
+// The rune's unique id and version. Every rune lightningd makes
+// starts with a restriction of the form "=id" or "=id-version"
+func (r *Rune) UniqueId() (id string, version string) {
+	if len(r.Restrictions) == 0 || len(r.Restrictions[0].Alternatives) != 1 {
+		return "", ""
+	}
+	alt := r.Restrictions[0].Alternatives[0]
+	if alt.Field != "" || alt.Condition != RuneEqual {
+		return "", ""
+	}
+	parts := strings.SplitN(alt.Value, "-", 2)
+	if len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return parts[0], ""
+}
+
+func RuneRestrictionsString(restrictions []*RuneRestriction) string {
+	strs := make([]string, len(restrictions))
+	for i, restriction := range restrictions {
+		strs[i] = restriction.String()
+	}
+	return strings.Join(strs, "&")
+}
+
+func (r *RuneRestriction) String() string {
+	return strings.Join(r.Strings(), "|")
+}
+
+// The alternatives, as the createrune command takes them
+func (r *RuneRestriction) Strings() []string {
+	strs := make([]string, len(r.Alternatives))
+	for i, alt := range r.Alternatives {
+		strs[i] = alt.String()
+	}
+	return strs
+}
+
+func (a *RuneAlternative) String() string {
+	var buf bytes.Buffer
+	buf.WriteString(a.Field)
+	buf.WriteString(string(a.Condition))
+	for i := 0; i < len(a.Value); i++ {
+		switch a.Value[i] {
+		case '\\', '|', '&':
+			buf.WriteByte('\\')
+		}
+		buf.WriteByte(a.Value[i])
+	}
+	return buf.String()
+}
+
+// A restriction that's met if any of {alternatives} is, eg
+//
+//	glightning.RuneAnyOf(
+//		glightning.RuneMethodIs("listpeers"),
+//		glightning.RuneMethodIs("getinfo"))
+func RuneAnyOf(alternatives ...*RuneAlternative) *RuneRestriction {
+	return &RuneRestriction{alternatives}
+}
+
+func NewRuneAlternative(field string, condition RuneCondition, value string) *RuneAlternative {
+	return &RuneAlternative{
+		Field:     field,
+		Condition: condition,
+		Value:     value,
+	}
+}
+
+// Only allow {method} to be run
+func RuneMethodIs(method string) *RuneAlternative {
+	return NewRuneAlternative("method", RuneEqual, method)
+}
+
+// Only allow methods that start with {prefix}, eg "list"
+func RuneMethodStartsWith(prefix string) *RuneAlternative {
+	return NewRuneAlternative("method", RuneBeginsWith, prefix)
+}
+
+// Only allow the peer {nodeId} to use the rune
+func RunePeerIs(nodeId string) *RuneAlternative {
+	return NewRuneAlternative("id", RuneEqual, nodeId)
+}
+
+// Only allow the rune to be used before the unix time {seconds}
+func RuneExpiresAt(seconds int64) *RuneAlternative {
+	return NewRuneAlternative("time", RuneIntLessThan, strconv.FormatInt(seconds, 10))
+}
+
+// Only allow {rate} uses of the rune a minute
+func RuneRateLimit(rate uint) *RuneAlternative {
+	return NewRuneAlternative("rate", RuneEqual, strconv.FormatUint(uint64(rate), 10))
+}
+
+// Compare the named parameter {param}, eg
+// RuneParam("amount_msat", RuneIntLessThan, "100000"). Runes
+// leave the underscores out of parameter names.
+func RuneParam(param string, condition RuneCondition, value string) *RuneAlternative {
+	return NewRuneAlternative("pname"+strings.Replace(param, "_", "", -1), condition, value)
+}
+
+// Compare the {n}th positional parameter
+func RunePositionalParam(n int, condition RuneCondition, value string) *RuneAlternative {
+	return NewRuneAlternative("parr"+strconv.Itoa(n), condition, value)
+}
@@ -0,0 +1,73 @@
+package glightning_test
+
+import (
+	"github.com/niftynei/glightning/glightning"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const masterRune = "zFMd1fjhrAYxUeFA54TjloZqOt8JrA_i_nYwIgXkag49MA=="
+
+// masterRune's authcode, with "=1&method=listpeers|method=getinfo&pnameamountmsat<10000&id^02"
+const restrictedRune = "zFMd1fjhrAYxUeFA54TjloZqOt8JrA_i_nYwIgXkag49MSZtZXRob2Q9bGlzdHBlZXJzfG1ldGhvZD1nZXRpbmZvJnBuYW1lYW1vdW50bXNhdDwxMDAwMCZpZF4wMg=="
+
+func TestDecodeRune(t *testing.T) {
+	r, err := glightning.DecodeRune(masterRune)
+	assert.Nil(t, err)
+	assert.Equal(t, 32, len(r.AuthCode))
+	id, version := r.UniqueId()
+	assert.Equal(t, "0", id)
+	assert.Equal(t, "", version)
+	assert.Equal(t, masterRune, r.String())
+
+	r, err = glightning.DecodeRune(restrictedRune)
+	assert.Nil(t, err)
+	assert.Equal(t, []*glightning.RuneRestriction{
+		glightning.RuneAnyOf(glightning.NewRuneAlternative("", glightning.RuneEqual, "1")),
+		glightning.RuneAnyOf(
+			glightning.RuneMethodIs("listpeers"),
+			glightning.RuneMethodIs("getinfo")),
+		glightning.RuneAnyOf(glightning.RuneParam("amount_msat", glightning.RuneIntLessThan, "10000")),
+		glightning.RuneAnyOf(glightning.NewRuneAlternative("id", glightning.RuneBeginsWith, "02")),
+	}, r.Restrictions)
+	id, _ = r.UniqueId()
+	assert.Equal(t, "1", id)
+	assert.Equal(t, restrictedRune, r.String())
+
+	// the padding is optional
+	_, err = glightning.DecodeRune("zFMd1fjhrAYxUeFA54TjloZqOt8JrA_i_nYwIgXkag49MA")
+	assert.Nil(t, err)
+
+	_, err = glightning.DecodeRune("not a rune")
+	assert.NotNil(t, err)
+	_, err = glightning.DecodeRune("c2hvcnQ=")
+	assert.NotNil(t, err)
+}
+
+func TestRuneRestrictions(t *testing.T) {
+	restrictions, err := glightning.ParseRuneRestrictions(`=3-2&method^list|method=getinfo&pnamedescription=a\|b\&c\\&time<1656920538`)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(restrictions))
+	assert.Equal(t, 2, len(restrictions[1].Alternatives))
+	assert.Equal(t, glightning.RuneParam("description", glightning.RuneEqual, `a|b&c\`), restrictions[2].Alternatives[0])
+	assert.Equal(t, glightning.RuneExpiresAt(1656920538), restrictions[3].Alternatives[0])
+
+	r := &glightning.Rune{Restrictions: restrictions}
+	id, version := r.UniqueId()
+	assert.Equal(t, "3", id)
+	assert.Equal(t, "2", version)
+
+	assert.Equal(t, `=3-2&method^list|method=getinfo&pnamedescription=a\|b\&c\\&time<1656920538`,
+		glightning.RuneRestrictionsString(restrictions))
+	assert.Equal(t, []string{"method^list", "method=getinfo"}, restrictions[1].Strings())
+
+	for _, bad := range []string{
+		"method",
+		"method=listpeers|",
+		"meth-od=listpeers",
+		`method=listpeers\`,
+	} {
+		_, err := glightning.ParseRuneRestrictions(bad)
+		assert.NotNil(t, err, bad)
+	}
+}
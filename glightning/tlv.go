@@ -0,0 +1,194 @@
+package glightning
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Onion payload TLV types (BOLT #4) and the keysend record
+const (
+	TlvAmountToForward    uint64 = 2
+	TlvOutgoingCltvValue  uint64 = 4
+	TlvShortChannelId     uint64 = 6
+	TlvPaymentData        uint64 = 8
+	TlvPaymentMetadata    uint64 = 16
+	TlvTotalAmountMsat    uint64 = 18
+	KeysendPreimageType   uint64 = 5482373484
+	FirstCustomRecordType uint64 = 1 << 16
+)
+
+type TlvRecord struct {
+	Type  uint64
+	Value []byte
+}
+
+// A TLV stream, in ascending type order
+type TlvStream []*TlvRecord
+
+// Parse a TLV stream. Types must be strictly increasing, and all
+// numbers minimally encoded, else it's an error.
+func ParseTlvStream(raw []byte) (TlvStream, error) {
+	r := bytes.NewReader(raw)
+	var stream TlvStream
+	for r.Len() > 0 {
+		typ, err := readBigSize(r)
+		if err != nil {
+			return nil, fmt.Errorf("Bad tlv type: %s", err)
+		}
+		if len(stream) > 0 && typ <= stream[len(stream)-1].Type {
+			return nil, fmt.Errorf("Tlv type %d out of order", typ)
+		}
+		length, err := readBigSize(r)
+		if err != nil {
+			return nil, fmt.Errorf("Bad length for tlv type %d: %s", typ, err)
+		}
+		if length > uint64(r.Len()) {
+			return nil, fmt.Errorf("Tlv type %d has length %d, only %d bytes left", typ, length, r.Len())
+		}
+		value := make([]byte, length)
+		if _, err := io.ReadFull(r, value); err != nil {
+			return nil, err
+		}
+		stream = append(stream, &TlvRecord{typ, value})
+	}
+	return stream, nil
+}
+
+func (s TlvStream) Get(typ uint64) ([]byte, bool) {
+	for _, record := range s {
+		if record.Type == typ {
+			return record.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Add (or replace) the record of type {typ}, keeping the stream in order
+func (s *TlvStream) Set(typ uint64, value []byte) {
+	for _, record := range *s {
+		if record.Type == typ {
+			record.Value = value
+			return
+		}
+	}
+	*s = append(*s, &TlvRecord{typ, value})
+	sort.Slice(*s, func(i, j int) bool {
+		return (*s)[i].Type < (*s)[j].Type
+	})
+}
+
+// The records with types of 2^16 and over, which are free for
+// applications to use
+func (s TlvStream) CustomRecords() TlvStream {
+	var custom TlvStream
+	for _, record := range s {
+		if record.Type >= FirstCustomRecordType {
+			custom = append(custom, record)
+		}
+	}
+	return custom
+}
+
+func (s TlvStream) Bytes() []byte {
+	var buf bytes.Buffer
+	for _, record := range s {
+		writeBigSize(&buf, record.Type)
+		writeBigSize(&buf, uint64(len(record.Value)))
+		buf.Write(record.Value)
+	}
+	return buf.Bytes()
+}
+
+// The stream as an onion payload: prefixed with its length, and hex
+// encoded. Suitable for HtlcAcceptedEvent.ContinueWithPayload
+func (s TlvStream) Payload() string {
+	var buf bytes.Buffer
+	raw := s.Bytes()
+	writeBigSize(&buf, uint64(len(raw)))
+	buf.Write(raw)
+	return hex.EncodeToString(buf.Bytes())
+}
+
+// Parse the onion's TLV payload. lightningd passes it on with its
+// length prefix, which is stripped here.
+func (o *Onion) ParsePayload() (TlvStream, error) {
+	if o.Type == "legacy" {
+		return nil, fmt.Errorf("Onion has a legacy payload, not tlv")
+	}
+	raw, err := hex.DecodeString(o.Payload)
+	if err != nil {
+		return nil, err
+	}
+	r := bytes.NewReader(raw)
+	length, err := readBigSize(r)
+	if err == nil && length == uint64(r.Len()) {
+		raw = raw[len(raw)-r.Len():]
+	}
+	return ParseTlvStream(raw)
+}
+
+// The payment preimage sent along with a keysend payment, as hex.
+// False if the payload doesn't have one.
+func (o *Onion) KeysendPreimage() (string, bool) {
+	payload, err := o.ParsePayload()
+	if err != nil {
+		return "", false
+	}
+	preimage, ok := payload.Get(KeysendPreimageType)
+	if !ok || len(preimage) != 32 {
+		return "", false
+	}
+	return hex.EncodeToString(preimage), true
+}
+
+// BigSize is the lightning varint: like bitcoin's CompactSize,
+// but big-endian, and it must be minimally encoded
+func readBigSize(r *bytes.Reader) (uint64, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	var size int
+	var min uint64
+	switch b {
+	case 0xfd:
+		size, min = 2, 0xfd
+	case 0xfe:
+		size, min = 4, 0x10000
+	case 0xff:
+		size, min = 8, 0x100000000
+	default:
+		return uint64(b), nil
+	}
+	raw := make([]byte, 8)
+	if _, err := io.ReadFull(r, raw[8-size:]); err != nil {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := binary.BigEndian.Uint64(raw)
+	if n < min {
+		return 0, fmt.Errorf("bigsize %d not minimally encoded", n)
+	}
+	return n, nil
+}
+
+func writeBigSize(buf *bytes.Buffer, n uint64) {
+	raw := make([]byte, 8)
+	binary.BigEndian.PutUint64(raw, n)
+	switch {
+	case n < 0xfd:
+		buf.WriteByte(byte(n))
+	case n <= 0xffff:
+		buf.WriteByte(0xfd)
+		buf.Write(raw[6:])
+	case n <= 0xffffffff:
+		buf.WriteByte(0xfe)
+		buf.Write(raw[4:])
+	default:
+		buf.WriteByte(0xff)
+		buf.Write(raw)
+	}
+}
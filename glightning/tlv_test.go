@@ -0,0 +1,93 @@
+package glightning_test
+
+import (
+	"encoding/hex"
+	"github.com/niftynei/glightning/glightning"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const preimage = "c907587348984baf0ae031b286bf1c9427abfa492b254aca67b6809fd9b58d7c"
+
+func TestTlvStreamRoundTrip(t *testing.T) {
+	var stream glightning.TlvStream
+	pre, _ := hex.DecodeString(preimage)
+	stream.Set(glightning.KeysendPreimageType, pre)
+	stream.Set(glightning.TlvAmountToForward, []byte{0x27, 0x10})
+	stream.Set(65537, []byte("hi"))
+	stream.Set(glightning.TlvOutgoingCltvValue, []byte{0x6e})
+
+	// amt_to_forward 10000, outgoing_cltv 110, then the big types
+	expected := "02022710" + "04016e" +
+		"fe00010001" + "02" + "6869" +
+		"ff0000000146c6616c" + "20" + preimage
+	assert.Equal(t, expected, hex.EncodeToString(stream.Bytes()))
+
+	parsed, err := glightning.ParseTlvStream(stream.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, stream, parsed)
+
+	custom := parsed.CustomRecords()
+	assert.Equal(t, 2, len(custom))
+	assert.Equal(t, uint64(65537), custom[0].Type)
+	assert.Equal(t, glightning.KeysendPreimageType, custom[1].Type)
+
+	value, ok := parsed.Get(glightning.TlvOutgoingCltvValue)
+	assert.True(t, ok)
+	assert.Equal(t, []byte{0x6e}, value)
+	_, ok = parsed.Get(glightning.TlvPaymentData)
+	assert.False(t, ok)
+}
+
+func TestTlvStreamInvalid(t *testing.T) {
+	for _, raw := range []string{
+		// out of order
+		"04016e" + "02022710",
+		// duplicate type
+		"02022710" + "02022710",
+		// length runs past the end
+		"020527",
+		// type not minimally encoded
+		"fd0002" + "0100",
+		// truncated bigsize
+		"fe0001",
+	} {
+		b, _ := hex.DecodeString(raw)
+		_, err := glightning.ParseTlvStream(b)
+		assert.NotNil(t, err, raw)
+	}
+}
+
+func TestOnionKeysendPreimage(t *testing.T) {
+	var stream glightning.TlvStream
+	pre, _ := hex.DecodeString(preimage)
+	stream.Set(glightning.TlvAmountToForward, []byte{0x27, 0x10})
+	stream.Set(glightning.TlvOutgoingCltvValue, []byte{0x6e})
+	stream.Set(glightning.KeysendPreimageType, pre)
+	stream.Set(34349334, []byte("hello"))
+
+	onion := &glightning.Onion{
+		Type:    "tlv",
+		Payload: stream.Payload(),
+	}
+	payload, err := onion.ParsePayload()
+	assert.Nil(t, err)
+	assert.Equal(t, stream, payload)
+
+	found, ok := onion.KeysendPreimage()
+	assert.True(t, ok)
+	assert.Equal(t, preimage, found)
+
+	note, ok := payload.CustomRecords().Get(34349334)
+	assert.True(t, ok)
+	assert.Equal(t, "hello", string(note))
+
+	// a regular payment has no preimage
+	onion.Payload = glightning.TlvStream(payload[:2]).Payload()
+	_, ok = onion.KeysendPreimage()
+	assert.False(t, ok)
+
+	onion.Type = "legacy"
+	_, err = onion.ParsePayload()
+	assert.NotNil(t, err)
+}
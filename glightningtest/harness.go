@@ -0,0 +1,470 @@
+// Package glightningtest lets you test a glightning.Plugin without
+// running lightningd. A Harness plays the part of lightningd: it
+// starts the plugin over a pair of pipes, walks it through
+// getmanifest and init, fires hooks and notifications at it, and
+// answers the plugin's own RPC calls with canned responses.
+package glightningtest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/niftynei/glightning/glightning"
+	"github.com/niftynei/glightning/jrpc2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const RpcFile = "lightning-rpc"
+
+type Harness struct {
+	Plugin *glightning.Plugin
+	// Serves the plugin's calls to plugin.Lightning()
+	Rpc *RpcServer
+	// How long to wait for the plugin to answer a request
+	Timeout time.Duration
+
+	dir       string
+	toPlugin  *os.File
+	pluginIn  *os.File
+	pluginOut *os.File
+	writeMu   sync.Mutex
+	requestId int64
+	pending   sync.Map // map[string]chan *message
+	closed    chan bool
+
+	mu            sync.Mutex
+	notifications []*Notification
+	unclaimed     []*Notification
+	notified      chan bool
+}
+
+// A notification the plugin sent to lightningd, such as a log line
+type Notification struct {
+	Method string
+	Params json.RawMessage
+}
+
+// Unmarshal the notification's parameters into {into}
+func (n *Notification) ParseParams(into interface{}) error {
+	return json.Unmarshal(n.Params, into)
+}
+
+// Anything we might read off the plugin's stdout
+type message struct {
+	Id     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *jrpc2.RpcError `json:"error,omitempty"`
+}
+
+type request struct {
+	Version string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+	Id      *int64      `json:"id,omitempty"`
+}
+
+// Start {plugin} up, with a fake lightningd on the other end.
+// Call Close when you're done with it.
+func New(plugin *glightning.Plugin) (*Harness, error) {
+	dir, err := ioutil.TempDir("", "glightningtest")
+	if err != nil {
+		return nil, err
+	}
+	rpc, err := NewRpcServer(filepath.Join(dir, RpcFile))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	h := &Harness{
+		Plugin:   plugin,
+		Rpc:      rpc,
+		Timeout:  5 * time.Second,
+		dir:      dir,
+		closed:   make(chan bool),
+		notified: make(chan bool),
+	}
+
+	var fromPlugin *os.File
+	h.pluginIn, h.toPlugin, err = os.Pipe()
+	if err != nil {
+		h.cleanup()
+		return nil, err
+	}
+	fromPlugin, h.pluginOut, err = os.Pipe()
+	if err != nil {
+		h.cleanup()
+		return nil, err
+	}
+
+	go func() {
+		plugin.Start(h.pluginIn, h.pluginOut)
+		// the plugin's done reading, safe to close up
+		h.pluginIn.Close()
+		h.pluginOut.Close()
+	}()
+	go h.read(fromPlugin)
+	return h, nil
+}
+
+// The directory the fake lightningd lives in. Passed to the
+// plugin as the lightning-dir at init.
+func (h *Harness) Dir() string {
+	return h.dir
+}
+
+// Ask the plugin for its manifest
+func (h *Harness) GetManifest() (*Manifest, error) {
+	var manifest Manifest
+	err := h.Call("getmanifest", map[string]interface{}{}, &manifest)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.Disable != "" {
+		return &manifest, &DisabledError{manifest.Disable}
+	}
+	return &manifest, nil
+}
+
+// Initialize the plugin with the given option values. If {config}
+// is nil, a regtest config is used. If it doesn't name an rpc file,
+// it's pointed at the harness's Rpc server. {config} itself is
+// left as it is.
+func (h *Harness) Init(options map[string]interface{}, config *glightning.Config) error {
+	if options == nil {
+		options = make(map[string]interface{})
+	}
+	if config == nil {
+		config = &glightning.Config{
+			Startup: true,
+			Network: "regtest",
+		}
+	} else {
+		// don't fill the defaults into the caller's config
+		copied := *config
+		config = &copied
+	}
+	if config.RpcFile == "" {
+		config.LightningDir = h.dir
+		config.RpcFile = RpcFile
+	}
+
+	var result json.RawMessage
+	err := h.Call("init", map[string]interface{}{
+		"options":       options,
+		"configuration": config,
+	}, &result)
+	if err != nil {
+		return err
+	}
+	var disabled glightning.InitResponse
+	if json.Unmarshal(result, &disabled) == nil && disabled.Disable != "" {
+		return &DisabledError{disabled.Disable}
+	}
+	return nil
+}
+
+// Returned by GetManifest or Init when the plugin disables itself
+type DisabledError struct {
+	Reason string
+}
+
+func (e *DisabledError) Error() string {
+	return fmt.Sprintf("plugin disabled: %s", e.Reason)
+}
+
+// GetManifest followed by Init, as lightningd does it. Like
+// lightningd, any options that aren't in {options} are
+// passed to init with their default value.
+func (h *Harness) Startup(options map[string]interface{}, config *glightning.Config) (*Manifest, error) {
+	manifest, err := h.GetManifest()
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]interface{})
+	for _, opt := range manifest.Options {
+		if opt.Default != nil {
+			values[opt.Name] = opt.Default
+		}
+	}
+	for name, value := range options {
+		values[name] = value
+	}
+	return manifest, h.Init(values, config)
+}
+
+// Call one of the plugin's methods. The result is unmarshalled
+// into {result}, if not nil. Errors sent back by the plugin
+// are returned as a *jrpc2.RpcError
+func (h *Harness) Call(method string, params interface{}, result interface{}) error {
+	id := h.nextId()
+	reply := make(chan *message, 1)
+	h.pending.Store(strconv.FormatInt(id, 10), reply)
+	defer h.pending.Delete(strconv.FormatInt(id, 10))
+
+	err := h.send(&request{
+		Version: "2.0",
+		Method:  method,
+		Params:  params,
+		Id:      &id,
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case msg := <-reply:
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(msg.Result, result)
+	case <-h.closed:
+		return errors.New("Plugin closed its output")
+	case <-time.After(h.Timeout):
+		return fmt.Errorf("Timed out waiting for a response to %s", method)
+	}
+}
+
+// Change one of the plugin's dynamic options, as lightningd does
+// when `setconfig` is called on it
+func (h *Harness) SetConfig(name string, val interface{}) error {
+	return h.Call("setconfig", map[string]interface{}{
+		"config": name,
+		"val":    val,
+	}, nil)
+}
+
+// Fire a hook at the plugin, eg a *glightning.HtlcAcceptedEvent,
+// and unmarshal its response into {result}
+func (h *Harness) Hook(event jrpc2.Method, result interface{}) error {
+	return h.Call(event.Name(), event, result)
+}
+
+// Send the plugin a notification. These are processed in the
+// background; there's no way to tell when the plugin is done with it.
+func (h *Harness) Notify(method string, params interface{}) error {
+	return h.send(&request{
+		Version: "2.0",
+		Method:  method,
+		Params:  params,
+	})
+}
+
+// Send the plugin a notification event, eg a *glightning.ConnectEvent
+func (h *Harness) NotifyEvent(event jrpc2.Method) error {
+	return h.Notify(event.Name(), event)
+}
+
+func (h *Harness) PeerConnected(event *glightning.PeerConnectedEvent) (*glightning.PeerConnectedResponse, error) {
+	var resp glightning.PeerConnectedResponse
+	err := h.Hook(event, &resp)
+	return &resp, err
+}
+
+func (h *Harness) DbWrite(event *glightning.DbWriteEvent) (*glightning.DbWriteResponse, error) {
+	var resp glightning.DbWriteResponse
+	err := h.Hook(event, &resp)
+	return &resp, err
+}
+
+func (h *Harness) InvoicePayment(event *glightning.InvoicePaymentEvent) (*glightning.InvoicePaymentResponse, error) {
+	var resp glightning.InvoicePaymentResponse
+	err := h.Hook(event, &resp)
+	return &resp, err
+}
+
+func (h *Harness) OpenChannel(event *glightning.OpenChannelEvent) (*glightning.OpenChannelResponse, error) {
+	var resp glightning.OpenChannelResponse
+	err := h.Hook(event, &resp)
+	return &resp, err
+}
+
+func (h *Harness) HtlcAccepted(event *glightning.HtlcAcceptedEvent) (*glightning.HtlcAcceptedResponse, error) {
+	var resp glightning.HtlcAcceptedResponse
+	err := h.Hook(event, &resp)
+	return &resp, err
+}
+
+func (h *Harness) CustomMsg(event *glightning.CustomMsgEvent) (*glightning.CustomMsgResponse, error) {
+	var resp glightning.CustomMsgResponse
+	err := h.Hook(event, &resp)
+	return &resp, err
+}
+
+func (h *Harness) OnionMessageRecv(event *glightning.OnionMessageRecvEvent) (*glightning.OnionMessageResponse, error) {
+	var resp glightning.OnionMessageResponse
+	err := h.Hook(event, &resp)
+	return &resp, err
+}
+
+func (h *Harness) OnionMessageRecvSecret(event *glightning.OnionMessageRecvSecretEvent) (*glightning.OnionMessageResponse, error) {
+	var resp glightning.OnionMessageResponse
+	err := h.Hook(event, &resp)
+	return &resp, err
+}
+
+func (h *Harness) CommitmentRevocation(event *glightning.CommitmentRevocationEvent) (*glightning.CommitmentRevocationResponse, error) {
+	var resp glightning.CommitmentRevocationResponse
+	err := h.Hook(event, &resp)
+	return &resp, err
+}
+
+func (h *Harness) OpenChannel2(event *glightning.OpenChannel2Event) (*glightning.OpenChannel2Response, error) {
+	var resp glightning.OpenChannel2Response
+	err := h.Hook(event, &resp)
+	return &resp, err
+}
+
+func (h *Harness) OpenChannel2Changed(event *glightning.OpenChannel2ChangedEvent) (*glightning.OpenChannel2ChangedResponse, error) {
+	var resp glightning.OpenChannel2ChangedResponse
+	err := h.Hook(event, &resp)
+	return &resp, err
+}
+
+func (h *Harness) OpenChannel2Sign(event *glightning.OpenChannel2SignEvent) (*glightning.OpenChannel2SignResponse, error) {
+	var resp glightning.OpenChannel2SignResponse
+	err := h.Hook(event, &resp)
+	return &resp, err
+}
+
+func (h *Harness) RbfChannel(event *glightning.RbfChannelEvent) (*glightning.OpenChannel2Response, error) {
+	var resp glightning.OpenChannel2Response
+	err := h.Hook(event, &resp)
+	return &resp, err
+}
+
+// Every notification the plugin has sent so far, oldest first
+func (h *Harness) Notifications() []*Notification {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	notes := make([]*Notification, len(h.notifications))
+	copy(notes, h.notifications)
+	return notes
+}
+
+// Wait for the plugin to send a notification for {method}. Each
+// notification is only handed back once, so calling this again
+// waits for the next one.
+func (h *Harness) WaitForNotification(method string, timeout time.Duration) (*Notification, error) {
+	deadline := time.After(timeout)
+	for {
+		h.mu.Lock()
+		for i, n := range h.unclaimed {
+			if n.Method == method {
+				h.unclaimed = append(h.unclaimed[:i], h.unclaimed[i+1:]...)
+				h.mu.Unlock()
+				return n, nil
+			}
+		}
+		notified := h.notified
+		h.mu.Unlock()
+
+		select {
+		case <-notified:
+		case <-deadline:
+			return nil, fmt.Errorf("Timed out waiting for a %s notification", method)
+		}
+	}
+}
+
+// Send the plugin lightningd's `shutdown` notification, and wait
+// up to {timeout} for it to exit
+func (h *Harness) Shutdown(timeout time.Duration) error {
+	if err := h.Notify("shutdown", map[string]interface{}{}); err != nil {
+		return err
+	}
+	select {
+	case <-h.closed:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("Plugin didn't exit within %s", timeout)
+	}
+}
+
+// Stop the plugin and clean up after it
+func (h *Harness) Close() error {
+	h.Plugin.Stop()
+	// hang up on the plugin, it'll exit once it sees
+	// the end of its input
+	err := h.toPlugin.Close()
+	h.Rpc.Close()
+	os.RemoveAll(h.dir)
+	return err
+}
+
+func (h *Harness) cleanup() {
+	h.Rpc.Close()
+	for _, f := range []*os.File{h.pluginIn, h.toPlugin} {
+		if f != nil {
+			f.Close()
+		}
+	}
+	os.RemoveAll(h.dir)
+}
+
+func (h *Harness) nextId() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.requestId++
+	return h.requestId
+}
+
+func (h *Harness) send(req *request) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+	_, err = h.toPlugin.Write(append(data, []byte("\n\n")...))
+	return err
+}
+
+func (h *Harness) read(in *os.File) {
+	defer close(h.closed)
+	defer in.Close()
+	decoder := json.NewDecoder(in)
+	for {
+		var msg message
+		if err := decoder.Decode(&msg); err != nil {
+			return
+		}
+
+		if msg.Method != "" {
+			h.notify(&Notification{
+				Method: msg.Method,
+				Params: msg.Params,
+			})
+			continue
+		}
+
+		// it's a response; find out who's waiting on it
+		id := string(msg.Id)
+		if unquoted, err := strconv.Unquote(id); err == nil {
+			id = unquoted
+		}
+		if reply, ok := h.pending.Load(id); ok {
+			reply.(chan *message) <- &msg
+		}
+	}
+}
+
+func (h *Harness) notify(n *Notification) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.notifications = append(h.notifications, n)
+	h.unclaimed = append(h.unclaimed, n)
+	// wake up anyone waiting
+	close(h.notified)
+	h.notified = make(chan bool)
+}
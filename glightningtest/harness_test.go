@@ -0,0 +1,561 @@
+package glightningtest_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/niftynei/glightning/glightning"
+	"github.com/niftynei/glightning/glightningtest"
+	"github.com/niftynei/glightning/jrpc2"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+type AliasMethod struct {
+	plugin *glightning.Plugin
+}
+
+func (a *AliasMethod) Name() string {
+	return "alias"
+}
+
+func (a *AliasMethod) New() interface{} {
+	return &AliasMethod{a.plugin}
+}
+
+func (a *AliasMethod) Call() (jrpc2.Result, error) {
+	greeting, err := a.plugin.GetOption("greeting")
+	if err != nil {
+		return nil, err
+	}
+	alias, err := a.plugin.Lightning().GetConfig("alias")
+	if err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("%s, %s", greeting, alias), nil
+}
+
+func newTestPlugin(t *testing.T, initialized chan *glightning.Config) *glightning.Plugin {
+	plugin := glightning.NewPlugin(func(p *glightning.Plugin, o map[string]glightning.Option, c *glightning.Config) {
+		initialized <- c
+	})
+	plugin.RegisterNewOption("greeting", "How to say hello", "Hello")
+	plugin.RegisterMethod(glightning.NewRpcMethod(&AliasMethod{plugin}, "Greet our node"))
+	plugin.RegisterHooks(&glightning.Hooks{
+		HtlcAccepted: func(event *glightning.HtlcAcceptedEvent) (*glightning.HtlcAcceptedResponse, error) {
+			if event.Htlc.PaymentHash == "aa" {
+				return event.Resolve("bb"), nil
+			}
+			return event.Continue(), nil
+		},
+	})
+	plugin.SetHookOptions("htlc_accepted", &glightning.HookOptions{
+		Before: []string{"funder"},
+	})
+	return plugin
+}
+
+func TestHarnessStartup(t *testing.T) {
+	initialized := make(chan *glightning.Config, 1)
+	h, err := glightningtest.New(newTestPlugin(t, initialized))
+	assert.Nil(t, err)
+	defer h.Close()
+
+	manifest, err := h.Startup(map[string]interface{}{"greeting": "Howdy"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "Hello", manifest.Option("greeting").Default)
+	assert.NotNil(t, manifest.Method("alias"))
+	assert.True(t, manifest.HasHook("htlc_accepted"))
+	assert.Equal(t, []string{"funder"}, manifest.Hook("htlc_accepted").Before)
+
+	config := <-initialized
+	assert.Equal(t, "regtest", config.Network)
+	assert.Equal(t, h.Dir(), config.LightningDir)
+}
+
+func TestHarnessInitLeavesConfig(t *testing.T) {
+	initialized := make(chan *glightning.Config, 1)
+	h, err := glightningtest.New(newTestPlugin(t, initialized))
+	assert.Nil(t, err)
+	defer h.Close()
+
+	_, err = h.GetManifest()
+	assert.Nil(t, err)
+	config := &glightning.Config{Network: "testnet"}
+	assert.Nil(t, h.Init(nil, config))
+	assert.Equal(t, &glightning.Config{Network: "testnet"}, config)
+
+	initConfig := <-initialized
+	assert.Equal(t, "testnet", initConfig.Network)
+	assert.Equal(t, h.Dir(), initConfig.LightningDir)
+}
+
+func TestHarnessSetConfig(t *testing.T) {
+	plugin := newTestPlugin(t, make(chan *glightning.Config, 1))
+	changed := make(chan string, 1)
+	style := glightning.NewOption("style", "How to greet", "formal")
+	style.Dynamic = true
+	style.OnChange = func(o glightning.Option) {
+		changed <- o.GetValue().(string)
+	}
+	plugin.RegisterOption(style)
+	old := glightning.NewOption("salutation", "Use greeting instead", "")
+	old.Deprecated = true
+	plugin.RegisterOption(old)
+	plugin.RegisterOption(glightning.NewStringListOption("friend", "Who to greet"))
+
+	h, err := glightningtest.New(plugin)
+	assert.Nil(t, err)
+	defer h.Close()
+
+	manifest, err := h.Startup(map[string]interface{}{"friend": []string{"alice", "bob"}}, nil)
+	assert.Nil(t, err)
+	assert.True(t, manifest.Option("style").Dynamic)
+	assert.False(t, manifest.Option("greeting").Dynamic)
+	assert.True(t, manifest.Option("salutation").Deprecated)
+	assert.True(t, manifest.Option("friend").Multi)
+	assert.Nil(t, manifest.Option("friend").Default)
+
+	friends, err := plugin.GetStringListOption("friend")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"alice", "bob"}, friends)
+
+	assert.Nil(t, h.SetConfig("style", "casual"))
+	assert.Equal(t, "casual", <-changed)
+	assert.NotNil(t, h.SetConfig("greeting", "Yo"))
+}
+
+type greetOptions struct {
+	Style  string `option:"style" description:"How to greet" default:"formal" dynamic:"true"`
+	Repeat int    `option:"repeat" description:"How many times to greet"`
+}
+
+func (o *greetOptions) Validate() error {
+	if o.Repeat > 3 {
+		return fmt.Errorf("repeat is at most 3")
+	}
+	return nil
+}
+
+func TestHarnessBoundOptions(t *testing.T) {
+	opts := &greetOptions{Repeat: 1}
+	plugin := newTestPlugin(t, make(chan *glightning.Config, 1))
+	assert.Nil(t, plugin.RegisterOptions(opts))
+
+	h, err := glightningtest.New(plugin)
+	assert.Nil(t, err)
+	defer h.Close()
+
+	manifest, err := h.Startup(nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "formal", manifest.Option("style").Default)
+	assert.True(t, manifest.Option("style").Dynamic)
+	assert.Equal(t, float64(1), manifest.Option("repeat").Default)
+	assert.Equal(t, 1, opts.Repeat)
+
+	assert.Nil(t, h.SetConfig("style", "casual"))
+	assert.Equal(t, "casual", opts.Style)
+}
+
+func TestHarnessOptionsReadWhileSet(t *testing.T) {
+	opts := &greetOptions{Repeat: 1}
+	plugin := newTestPlugin(t, make(chan *glightning.Config, 1))
+	assert.Nil(t, plugin.RegisterOptions(opts))
+
+	h, err := glightningtest.New(plugin)
+	assert.Nil(t, err)
+	defer h.Close()
+	_, err = h.Startup(nil, nil)
+	assert.Nil(t, err)
+
+	// run with -race to check these are safe
+	stop := make(chan bool)
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			var style string
+			plugin.ReadOptions(func() {
+				style = opts.Style
+			})
+			assert.True(t, style != "")
+		}
+	}()
+	for _, style := range []string{"casual", "formal", "pirate"} {
+		assert.Nil(t, h.SetConfig("style", style))
+	}
+	close(stop)
+	<-done
+
+	plugin.ReadOptions(func() {
+		assert.Equal(t, "pirate", opts.Style)
+	})
+}
+
+type feeOptions struct {
+	Min int `option:"min-fee" description:"Lowest fee to charge" default:"1" dynamic:"true"`
+	Max int `option:"max-fee" description:"Highest fee to charge" default:"10" dynamic:"true"`
+}
+
+func (o *feeOptions) Validate() error {
+	if o.Min > o.Max {
+		return fmt.Errorf("min-fee is more than max-fee")
+	}
+	return nil
+}
+
+func TestHarnessBoundOptionsSetInvalid(t *testing.T) {
+	opts := &feeOptions{}
+	plugin := newTestPlugin(t, make(chan *glightning.Config, 1))
+	assert.Nil(t, plugin.RegisterOptions(opts))
+
+	h, err := glightningtest.New(plugin)
+	assert.Nil(t, err)
+	defer h.Close()
+	_, err = h.Startup(nil, nil)
+	assert.Nil(t, err)
+
+	// refused, and left as it was
+	assert.NotNil(t, h.SetConfig("min-fee", 20))
+	min, err := plugin.GetIntOption("min-fee")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, min)
+	plugin.ReadOptions(func() {
+		assert.Equal(t, 1, opts.Min)
+	})
+
+	assert.Nil(t, h.SetConfig("max-fee", 30))
+	assert.Nil(t, h.SetConfig("min-fee", 20))
+	plugin.ReadOptions(func() {
+		assert.Equal(t, feeOptions{Min: 20, Max: 30}, *opts)
+	})
+}
+
+func TestHarnessBoundOptionsDisabled(t *testing.T) {
+	plugin := newTestPlugin(t, make(chan *glightning.Config, 1))
+	assert.Nil(t, plugin.RegisterOptions(&greetOptions{}))
+
+	h, err := glightningtest.New(plugin)
+	assert.Nil(t, err)
+	defer h.Close()
+
+	_, err = h.Startup(map[string]interface{}{"repeat": 10}, nil)
+	disabled, ok := err.(*glightningtest.DisabledError)
+	assert.True(t, ok)
+	assert.Equal(t, "repeat is at most 3", disabled.Reason)
+}
+
+type sizedOptions struct {
+	Hops int8 `option:"hops" description:"Most hops to route over" default:"20" dynamic:"true"`
+}
+
+func TestHarnessBoundOptionsOverflow(t *testing.T) {
+	opts := &sizedOptions{}
+	plugin := newTestPlugin(t, make(chan *glightning.Config, 1))
+	assert.Nil(t, plugin.RegisterOptions(opts))
+
+	h, err := glightningtest.New(plugin)
+	assert.Nil(t, err)
+	defer h.Close()
+
+	_, err = h.Startup(map[string]interface{}{"hops": 300}, nil)
+	disabled, ok := err.(*glightningtest.DisabledError)
+	assert.True(t, ok)
+	assert.Equal(t, "Option `hops` can't be 300, it doesn't fit in a int8", disabled.Reason)
+	assert.Equal(t, int8(20), opts.Hops)
+}
+
+func TestHarnessBoundOptionsSetOverflow(t *testing.T) {
+	opts := &sizedOptions{}
+	plugin := newTestPlugin(t, make(chan *glightning.Config, 1))
+	assert.Nil(t, plugin.RegisterOptions(opts))
+
+	h, err := glightningtest.New(plugin)
+	assert.Nil(t, err)
+	defer h.Close()
+
+	_, err = h.Startup(nil, nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, h.SetConfig("hops", -200))
+	// not truncated to 1
+	assert.NotNil(t, h.SetConfig("hops", 1.5))
+	assert.Nil(t, h.SetConfig("hops", 100))
+	hops, err := plugin.GetIntOption("hops")
+	assert.Nil(t, err)
+	assert.Equal(t, 100, hops)
+	plugin.ReadOptions(func() {
+		assert.Equal(t, int8(100), opts.Hops)
+	})
+}
+
+func TestHarnessInitDisabled(t *testing.T) {
+	plugin := newTestPlugin(t, make(chan *glightning.Config, 1))
+	plugin.SetInitHandler(func(p *glightning.Plugin, o map[string]glightning.Option, c *glightning.Config) error {
+		return fmt.Errorf("no thanks")
+	})
+
+	h, err := glightningtest.New(plugin)
+	assert.Nil(t, err)
+	defer h.Close()
+
+	_, err = h.Startup(nil, nil)
+	disabled, ok := err.(*glightningtest.DisabledError)
+	assert.True(t, ok)
+	assert.Equal(t, "no thanks", disabled.Reason)
+}
+
+type CountMethod struct {
+	glightning.CallContext
+	To int `json:"to"`
+}
+
+func (c *CountMethod) Name() string {
+	return "count"
+}
+
+func (c *CountMethod) New() interface{} {
+	return &CountMethod{}
+}
+
+func (c *CountMethod) Call() (jrpc2.Result, error) {
+	for i := 1; i <= c.To; i++ {
+		if err := c.Progress(i, c.To); err != nil {
+			return nil, err
+		}
+	}
+	c.Message(glightning.Info, "counted")
+	return c.To, nil
+}
+
+func TestHarnessCallContext(t *testing.T) {
+	plugin := newTestPlugin(t, make(chan *glightning.Config, 1))
+	rpc := glightning.NewRpcMethod(&CountMethod{}, "Count up")
+	plugin.RegisterMethod(rpc)
+
+	h, err := glightningtest.New(plugin)
+	assert.Nil(t, err)
+	defer h.Close()
+
+	manifest, err := h.Startup(nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "to", manifest.Method("count").Usage)
+
+	var result int
+	assert.Nil(t, h.Call("count", []interface{}{3}, &result))
+	assert.Equal(t, 3, result)
+
+	msg, err := h.WaitForNotification("message", time.Second)
+	assert.Nil(t, err)
+	var message struct {
+		Id      *jrpc2.Id `json:"id"`
+		Level   string    `json:"level"`
+		Message string    `json:"message"`
+	}
+	assert.Nil(t, msg.ParseParams(&message))
+	assert.Equal(t, "info", message.Level)
+	assert.Equal(t, "counted", message.Message)
+
+	var progress []glightning.ProgressNotification
+	for _, n := range h.Notifications() {
+		if n.Method != "progress" {
+			continue
+		}
+		var p glightning.ProgressNotification
+		assert.Nil(t, n.ParseParams(&p))
+		assert.Equal(t, message.Id.String(), p.Id.String())
+		progress = append(progress, p)
+	}
+	assert.Equal(t, 3, len(progress))
+	assert.Equal(t, 3, progress[2].Num)
+	assert.Equal(t, 3, progress[2].Total)
+	assert.Nil(t, progress[2].Stage)
+}
+
+func TestHarnessShutdown(t *testing.T) {
+	plugin := glightning.NewPlugin(nil)
+	held := make(chan *glightning.HtlcAcceptedEvent, 1)
+	plugin.RegisterHooks(&glightning.Hooks{
+		HtlcAccepted: func(event *glightning.HtlcAcceptedEvent) (*glightning.HtlcAcceptedResponse, error) {
+			event.Defer("hold", 0, nil)
+			held <- event
+			return nil, nil
+		},
+	})
+	var mu sync.Mutex
+	var order []string
+	plugin.OnShutdown(func(ctx context.Context) {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, "shutdown")
+	})
+
+	h, err := glightningtest.New(plugin)
+	assert.Nil(t, err)
+	defer h.Close()
+	manifest, err := h.Startup(nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"shutdown"}, manifest.Subscriptions)
+
+	answered := make(chan error, 1)
+	go func() {
+		_, err := h.HtlcAccepted(&glightning.HtlcAcceptedEvent{})
+		answered <- err
+	}()
+	event := <-held
+
+	// the held htlc is answered before we shut down
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		mu.Lock()
+		order = append(order, "resolved")
+		mu.Unlock()
+		plugin.ResolveDeferred("hold", event.Continue())
+	}()
+	assert.Nil(t, h.Shutdown(time.Second))
+	assert.Nil(t, <-answered)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"resolved", "shutdown"}, order)
+}
+
+func TestHarnessShutdownWithoutCallbacks(t *testing.T) {
+	plugin := glightning.NewPlugin(nil)
+	held := make(chan *glightning.HtlcAcceptedEvent, 1)
+	plugin.RegisterHooks(&glightning.Hooks{
+		HtlcAccepted: func(event *glightning.HtlcAcceptedEvent) (*glightning.HtlcAcceptedResponse, error) {
+			event.Defer("hold", 0, nil)
+			held <- event
+			return nil, nil
+		},
+	})
+
+	h, err := glightningtest.New(plugin)
+	assert.Nil(t, err)
+	defer h.Close()
+	manifest, err := h.Startup(nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"shutdown"}, manifest.Subscriptions)
+
+	answered := make(chan error, 1)
+	go func() {
+		_, err := h.HtlcAccepted(&glightning.HtlcAcceptedEvent{})
+		answered <- err
+	}()
+	event := <-held
+
+	// still drains the held htlc, then exits
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		plugin.ResolveDeferred("hold", event.Continue())
+	}()
+	assert.Nil(t, h.Shutdown(time.Second))
+	assert.Nil(t, <-answered)
+}
+
+func TestHarnessMethodUsesRpc(t *testing.T) {
+	h, err := glightningtest.New(newTestPlugin(t, make(chan *glightning.Config, 1)))
+	assert.Nil(t, err)
+	defer h.Close()
+
+	_, err = h.Startup(nil, nil)
+	assert.Nil(t, err)
+
+	h.Rpc.Respond("listconfigs", map[string]string{"alias": "SLEEPYCAT"})
+	var greeting string
+	err = h.Call("alias", map[string]interface{}{}, &greeting)
+	assert.Nil(t, err)
+	assert.Equal(t, "Hello, SLEEPYCAT", greeting)
+
+	calls := h.Rpc.Calls("listconfigs")
+	assert.Equal(t, 1, len(calls))
+	var params map[string]string
+	assert.Nil(t, calls[0].ParseParams(&params))
+	assert.Equal(t, "alias", params["config"])
+
+	h.Rpc.RespondError("listconfigs", -32602, "Unknown config option")
+	err = h.Call("alias", map[string]interface{}{}, &greeting)
+	assert.NotNil(t, err)
+	_, ok := err.(*jrpc2.RpcError)
+	assert.True(t, ok)
+	assert.Equal(t, 2, len(h.Rpc.Calls("")))
+}
+
+func TestHarnessNodeInfo(t *testing.T) {
+	plugin := newTestPlugin(t, make(chan *glightning.Config, 1))
+	_, err := plugin.NodeId()
+	assert.NotNil(t, err)
+
+	h, err := glightningtest.New(plugin)
+	assert.Nil(t, err)
+	defer h.Close()
+	_, err = h.Startup(nil, nil)
+	assert.Nil(t, err)
+
+	h.Rpc.Respond("getinfo", map[string]string{"id": "02aa", "alias": "SLEEPYCAT"})
+	id, err := plugin.NodeId()
+	assert.Nil(t, err)
+	assert.Equal(t, "02aa", id)
+	alias, err := plugin.Alias()
+	assert.Nil(t, err)
+	assert.Equal(t, "SLEEPYCAT", alias)
+	assert.Equal(t, 1, len(h.Rpc.Calls("getinfo")))
+}
+
+func TestHarnessHook(t *testing.T) {
+	h, err := glightningtest.New(newTestPlugin(t, make(chan *glightning.Config, 1)))
+	assert.Nil(t, err)
+	defer h.Close()
+
+	_, err = h.Startup(nil, nil)
+	assert.Nil(t, err)
+
+	resp, err := h.HtlcAccepted(&glightning.HtlcAcceptedEvent{
+		Htlc: glightning.HtlcOffer{
+			AmountMilliSatoshi: "1000msat",
+			PaymentHash:        "aa",
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, glightning.HtlcAcceptedResult("resolve"), resp.Result)
+	assert.Equal(t, "bb", resp.PaymentKey)
+
+	resp, err = h.HtlcAccepted(&glightning.HtlcAcceptedEvent{})
+	assert.Nil(t, err)
+	assert.Equal(t, glightning.HtlcAcceptedResult("continue"), resp.Result)
+}
+
+func TestHarnessNotifications(t *testing.T) {
+	plugin := newTestPlugin(t, make(chan *glightning.Config, 1))
+	var wg sync.WaitGroup
+	wg.Add(1)
+	plugin.SubscribeConnect(func(c *glightning.ConnectEvent) {
+		defer wg.Done()
+		assert.Equal(t, "02aa", c.PeerId)
+		plugin.Log("connected to "+c.PeerId, glightning.Info)
+	})
+
+	h, err := glightningtest.New(plugin)
+	assert.Nil(t, err)
+	defer h.Close()
+
+	manifest, err := h.Startup(nil, nil)
+	assert.Nil(t, err)
+	assert.True(t, manifest.HasSubscription("connect"))
+
+	err = h.NotifyEvent(&glightning.ConnectEvent{PeerId: "02aa"})
+	assert.Nil(t, err)
+	wg.Wait()
+
+	note, err := h.WaitForNotification("log", time.Second)
+	assert.Nil(t, err)
+	var log glightning.LogNotification
+	assert.Nil(t, note.ParseParams(&log))
+	assert.Equal(t, "info", log.Level)
+	assert.Equal(t, "connected to 02aa", log.Message)
+}
@@ -0,0 +1,106 @@
+package glightningtest
+
+import (
+	"encoding/json"
+	"github.com/niftynei/glightning/glightning"
+)
+
+// A plugin's getmanifest response, as lightningd sees it
+type Manifest struct {
+	Options       []*ManifestOption       `json:"options"`
+	RpcMethods    []*ManifestMethod       `json:"rpcmethods"`
+	Dynamic       bool                    `json:"dynamic"`
+	Subscriptions []string                `json:"subscriptions,omitempty"`
+	Hooks         []*ManifestHook         `json:"hooks,omitempty"`
+	FeatureBits   *glightning.FeatureBits `json:"featurebits,omitempty"`
+	Notifications []*ManifestTopic        `json:"notifications,omitempty"`
+	Disable       string                  `json:"disable,omitempty"`
+}
+
+type ManifestOption struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`
+	Default     interface{} `json:"default"`
+	Description string      `json:"description"`
+	Dynamic     bool        `json:"dynamic"`
+	Multi       bool        `json:"multi"`
+	Deprecated  bool        `json:"deprecated"`
+}
+
+type ManifestMethod struct {
+	Name     string `json:"name"`
+	Desc     string `json:"description"`
+	Usage    string `json:"usage"`
+	LongDesc string `json:"long_description,omitempty"`
+	Category string `json:"category,omitempty"`
+}
+
+// A custom notification topic the plugin emits
+type ManifestTopic struct {
+	Method string `json:"method"`
+}
+
+type ManifestHook struct {
+	Name    string        `json:"name"`
+	Before  []string      `json:"before"`
+	After   []string      `json:"after"`
+	Filters []interface{} `json:"filters"`
+}
+
+// Hooks are listed either by name, or as an object
+func (h *ManifestHook) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &h.Name)
+	}
+	type alias ManifestHook
+	return json.Unmarshal(data, (*alias)(h))
+}
+
+func (m *Manifest) Option(name string) *ManifestOption {
+	for _, opt := range m.Options {
+		if opt.Name == name {
+			return opt
+		}
+	}
+	return nil
+}
+
+func (m *Manifest) Method(name string) *ManifestMethod {
+	for _, method := range m.RpcMethods {
+		if method.Name == name {
+			return method
+		}
+	}
+	return nil
+}
+
+func (m *Manifest) HasHook(name string) bool {
+	return m.Hook(name) != nil
+}
+
+func (m *Manifest) Hook(name string) *ManifestHook {
+	for _, hook := range m.Hooks {
+		if hook.Name == name {
+			return hook
+		}
+	}
+	return nil
+}
+
+func (m *Manifest) HasNotificationTopic(topic string) bool {
+	for _, t := range m.Notifications {
+		if t.Method == topic {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Manifest) HasSubscription(topic string) bool {
+	for _, sub := range m.Subscriptions {
+		if sub == topic {
+			return true
+		}
+	}
+	return false
+}
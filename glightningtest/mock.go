@@ -0,0 +1,1058 @@
+package glightningtest
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/niftynei/glightning/glightning"
+	"github.com/niftynei/glightning/jrpc2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Error codes the mock sends back, matching lightningd's
+const (
+	ErrInvoiceLabelExists  = 900
+	ErrInvoiceExpiredWait  = 903
+	ErrInvoiceWaitTimedOut = 904
+	ErrInvoiceNotFound     = 905
+	ErrInvoiceBadStatus    = 906
+	ErrPayRouteNotFound    = 205
+	ErrInvalidParams       = -32602
+)
+
+// The RPCs answered by a MockLightningd
+var MockMethods = []string{
+	"getinfo",
+	"invoice",
+	"listinvoices",
+	"delinvoice",
+	"waitinvoice",
+	"waitanyinvoice",
+	"pay",
+	"listpays",
+	"listsendpays",
+	"connect",
+	"listpeers",
+	"disconnect",
+	"fundchannel",
+	"close",
+	"datastore",
+	"deldatastore",
+	"listdatastore",
+	"commando",
+	"listpeerchannels",
+	"listclosedchannels",
+}
+
+// A MockLightningd answers a useful subset of lightningd's RPCs,
+// keeping track of invoices, peers, channels, payments and the
+// datastore in memory,
+// so code that uses a glightning.Lightning can be tested without
+// any binaries.
+//
+// Some things only happen when the test says so: use PayInvoice to
+// have an invoice paid, AddPayable to make a bolt11 payable, and
+// LockIn to move a newly funded channel to CHANNELD_NORMAL.
+//
+// commando runs commands on the mock itself, as if the peer were
+// another node that shares all its state. The peer must be connected,
+// and any rune that decodes will do.
+type MockLightningd struct {
+	*RpcServer
+	Info glightning.NodeInfo
+
+	dir      string
+	mu       sync.Mutex
+	invoices []*glightning.Invoice
+	payIndex uint64
+	// created_index, updated_index and deleted_index of invoices
+	created  uint64
+	updated  uint64
+	deleted  uint64
+	peers    []*glightning.Peer
+	payables map[string]*payable
+	sendpays []*glightning.SendPayFields
+	store    []*glightning.DatastoreEntry
+	changed  chan bool
+	closed   chan bool
+
+	// channels that have closed, for listclosedchannels
+	closedChannels []*glightning.ClosedChannel
+}
+
+type payable struct {
+	msat        uint64
+	destination string
+	preimage    string
+	paymentHash string
+}
+
+// Start up a MockLightningd on a socket in a new temporary
+// directory. If {methods} are given, only those RPCs are answered.
+func NewMockLightningd(methods ...string) (*MockLightningd, error) {
+	dir, err := ioutil.TempDir("", "glightningtest")
+	if err != nil {
+		return nil, err
+	}
+	rpc, err := NewRpcServer(filepath.Join(dir, RpcFile))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	m := MockOn(rpc, methods...)
+	m.dir = dir
+	m.Info.LightningDir = dir
+	return m, nil
+}
+
+// Install the mock's RPCs on an existing server, such as a
+// Harness's Rpc. If {methods} are given, only those are installed.
+func MockOn(rpc *RpcServer, methods ...string) *MockLightningd {
+	m := &MockLightningd{
+		RpcServer: rpc,
+		Info: glightning.NodeInfo{
+			Id:          "02eec7245d6b7d2ccb30380bfbe2a3648cd7a942653f5aa340edcea1f283686619",
+			Alias:       "MOCKLIGHTNINGD",
+			Color:       "02eec7",
+			Version:     "mock",
+			Blockheight: 101,
+			Network:     "regtest",
+		},
+		payables: make(map[string]*payable),
+		changed:  make(chan bool),
+		closed:   make(chan bool),
+	}
+
+	handlers := map[string]RpcHandler{
+		"getinfo":        m.getInfo,
+		"invoice":        m.invoice,
+		"listinvoices":   m.listInvoices,
+		"delinvoice":     m.delInvoice,
+		"waitinvoice":    m.waitInvoice,
+		"waitanyinvoice": m.waitAnyInvoice,
+		"pay":            m.pay,
+		"listpays":       m.listPays,
+		"listsendpays":   m.listSendPays,
+		"connect":        m.connect,
+		"listpeers":      m.listPeers,
+		"disconnect":     m.disconnect,
+		"fundchannel":    m.fundChannel,
+		"close":          m.close,
+		"datastore":      m.datastore,
+		"deldatastore":   m.delDatastore,
+		"listdatastore":  m.listDatastore,
+		"commando":       m.commando,
+
+		"listpeerchannels":   m.listPeerChannels,
+		"listclosedchannels": m.listClosedChannels,
+	}
+	if len(methods) == 0 {
+		methods = MockMethods
+	}
+	for _, method := range methods {
+		if handler, ok := handlers[method]; ok {
+			rpc.Handle(method, handler)
+		}
+	}
+	return m
+}
+
+// A Lightning client that's connected to this mock
+func (m *MockLightningd) Client() *glightning.Lightning {
+	dir, file := filepath.Split(m.Socket())
+	ln := glightning.NewLightning()
+	ln.StartUp(file, dir)
+	return ln
+}
+
+func (m *MockLightningd) Close() error {
+	m.mu.Lock()
+	select {
+	case <-m.closed:
+	default:
+		close(m.closed)
+	}
+	m.mu.Unlock()
+	err := m.RpcServer.Close()
+	if m.dir != "" {
+		os.RemoveAll(m.dir)
+	}
+	return err
+}
+
+// Pay the unpaid invoice {label}, as if a payment for
+// its full amount had just come in
+func (m *MockLightningd) PayInvoice(label string) (*glightning.Invoice, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	inv := m.findInvoice(label)
+	if inv == nil {
+		return nil, fmt.Errorf("Unknown invoice %s", label)
+	}
+	if m.status(inv) != glightning.InvoiceUnpaid {
+		return nil, fmt.Errorf("Invoice %s is %s", label, m.status(inv))
+	}
+	m.payIndex++
+	m.updated++
+	inv.Status = glightning.InvoicePaid
+	inv.PayIndex = m.payIndex
+	inv.UpdatedIndex = m.updated
+	inv.PaidAt = uint64(time.Now().Unix())
+	inv.MilliSatoshiReceivedRaw = inv.AmountMilliSatoshiRaw
+	inv.MilliSatoshiReceived = inv.AmountMilliSatoshi
+	m.notifyChanged()
+	copied := *inv
+	return &copied, nil
+}
+
+// Let the mock's pay command pay {bolt11}, sending {msat}
+// to {destination}. Returns the payment hash.
+func (m *MockLightningd) AddPayable(bolt11 string, msat uint64, destination string) string {
+	preimage, hash := newPreimage()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.payables[bolt11] = &payable{
+		msat:        msat,
+		destination: destination,
+		preimage:    preimage,
+		paymentHash: hash,
+	}
+	return hash
+}
+
+// Add a peer, as if it had connected to us
+func (m *MockLightningd) AddPeer(peerId string, connected bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	peer := m.findPeer(peerId)
+	if peer == nil {
+		peer = m.newPeer(peerId)
+	}
+	peer.Connected = connected
+}
+
+// Move the channel we're funding with {peerId} to CHANNELD_NORMAL
+func (m *MockLightningd) LockIn(peerId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	peer := m.findPeer(peerId)
+	if peer == nil {
+		return fmt.Errorf("Unknown peer %s", peerId)
+	}
+	for _, ch := range peer.Channels {
+		if ch.State == "CHANNELD_AWAITING_LOCKIN" {
+			m.Info.Blockheight += 6
+			ch.State = "CHANNELD_NORMAL"
+			ch.ShortChannelId = fmt.Sprintf("%dx1x0", m.Info.Blockheight)
+			return nil
+		}
+	}
+	return fmt.Errorf("No channel awaiting lockin with %s", peerId)
+}
+
+func (m *MockLightningd) getInfo(params json.RawMessage) (interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	info := m.Info
+	info.PeerCount = 0
+	for _, peer := range m.peers {
+		if peer.Connected {
+			info.PeerCount++
+		}
+		for _, ch := range peer.Channels {
+			switch ch.State {
+			case "CHANNELD_AWAITING_LOCKIN":
+				info.PendingChannelCount++
+			case "CHANNELD_NORMAL":
+				info.ActiveChannelCount++
+			default:
+				info.InactiveChannelCount++
+			}
+		}
+	}
+	return &info, nil
+}
+
+func (m *MockLightningd) invoice(params json.RawMessage) (interface{}, error) {
+	var req glightning.InvoiceRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, invalidParams(err)
+	}
+
+	inv := &glightning.Invoice{
+		Label:       req.Label,
+		Description: req.Description,
+		Status:      glightning.InvoiceUnpaid,
+	}
+	if req.MilliSatoshis != "any" {
+		msat, err := strconv.ParseUint(req.MilliSatoshis, 10, 64)
+		if err != nil {
+			return nil, invalidParams(err)
+		}
+		inv.AmountMilliSatoshiRaw = msat
+		inv.AmountMilliSatoshi = glightning.NewMsat(msat).String()
+	}
+	expiry := req.ExpirySeconds
+	if expiry == 0 {
+		expiry = 3600
+	}
+	inv.ExpiresAt = uint64(time.Now().Unix()) + uint64(expiry)
+
+	if req.PreImage != "" {
+		preimage, err := hex.DecodeString(req.PreImage)
+		if err != nil || len(preimage) != 32 {
+			return nil, invalidParams(fmt.Errorf("preimage must be 64 hex digits"))
+		}
+		inv.PaymentPreImage = req.PreImage
+		hash := sha256.Sum256(preimage)
+		inv.PaymentHash = hex.EncodeToString(hash[:])
+	} else {
+		inv.PaymentPreImage, inv.PaymentHash = newPreimage()
+	}
+	inv.Bolt11 = fmt.Sprintf("lnbcrt%s1mock%s", req.MilliSatoshis, inv.PaymentHash)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.findInvoice(req.Label) != nil {
+		return nil, rpcError(ErrInvoiceLabelExists, "Duplicate label '%s'", req.Label)
+	}
+	m.created++
+	inv.CreatedIndex = m.created
+	m.invoices = append(m.invoices, inv)
+	m.notifyChanged()
+
+	return &glightning.Invoice{
+		PaymentHash:  inv.PaymentHash,
+		ExpiresAt:    inv.ExpiresAt,
+		Bolt11:       inv.Bolt11,
+		CreatedIndex: inv.CreatedIndex,
+	}, nil
+}
+
+func (m *MockLightningd) listInvoices(params json.RawMessage) (interface{}, error) {
+	var req glightning.ListInvoiceRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, invalidParams(err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var sorted []*glightning.Invoice
+	switch req.Index {
+	case "", glightning.IndexCreated:
+		sorted = m.invoices
+	case glightning.IndexUpdated:
+		for _, inv := range m.invoices {
+			if inv.UpdatedIndex != 0 {
+				sorted = append(sorted, inv)
+			}
+		}
+		sort.Slice(sorted, func(i, j int) bool {
+			return sorted[i].UpdatedIndex < sorted[j].UpdatedIndex
+		})
+	default:
+		return nil, invalidParams(fmt.Errorf("index must be created or updated"))
+	}
+
+	list := make([]*glightning.Invoice, 0)
+	for _, inv := range sorted {
+		if req.Label != "" && req.Label != inv.Label {
+			continue
+		}
+		if req.InvString != "" && req.InvString != inv.Bolt11 {
+			continue
+		}
+		if req.PaymentHash != "" && req.PaymentHash != inv.PaymentHash {
+			continue
+		}
+		index := inv.CreatedIndex
+		if req.Index == glightning.IndexUpdated {
+			index = inv.UpdatedIndex
+		}
+		if index < req.Start {
+			continue
+		}
+		if req.Limit != 0 && len(list) == int(req.Limit) {
+			break
+		}
+		list = append(list, m.snapshot(inv))
+	}
+	return map[string]interface{}{"invoices": list}, nil
+}
+
+func (m *MockLightningd) delInvoice(params json.RawMessage) (interface{}, error) {
+	var req glightning.DeleteInvoiceRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, invalidParams(err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, inv := range m.invoices {
+		if inv.Label != req.Label {
+			continue
+		}
+		if status := m.status(inv); string(status) != req.Status {
+			return nil, rpcError(ErrInvoiceBadStatus, "Invoice status is %s not %s", status, req.Status)
+		}
+		m.invoices = append(m.invoices[:i], m.invoices[i+1:]...)
+		m.deleted++
+		m.notifyChanged()
+		return m.snapshot(inv), nil
+	}
+	return nil, rpcError(ErrInvoiceNotFound, "Unknown invoice")
+}
+
+func (m *MockLightningd) waitInvoice(params json.RawMessage) (interface{}, error) {
+	var req glightning.WaitInvoiceRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, invalidParams(err)
+	}
+	return m.wait(nil, func() (interface{}, error) {
+		inv := m.findInvoice(req.Label)
+		if inv == nil {
+			return nil, rpcError(ErrInvoiceNotFound, "Unknown invoice")
+		}
+		switch m.status(inv) {
+		case glightning.InvoicePaid:
+			return m.snapshot(inv), nil
+		case glightning.InvoiceExpired:
+			return nil, rpcError(ErrInvoiceExpiredWait, "Invoice expired during wait")
+		}
+		return nil, nil
+	})
+}
+
+func (m *MockLightningd) waitAnyInvoice(params json.RawMessage) (interface{}, error) {
+	var req glightning.WaitAnyInvoiceRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, invalidParams(err)
+	}
+	var timeout <-chan time.Time
+	if req.Timeout != nil {
+		timeout = time.After(time.Duration(*req.Timeout) * time.Second)
+	}
+	return m.wait(timeout, func() (interface{}, error) {
+		var next *glightning.Invoice
+		for _, inv := range m.invoices {
+			if inv.PayIndex > uint64(req.LastPayIndex) && (next == nil || inv.PayIndex < next.PayIndex) {
+				next = inv
+			}
+		}
+		if next == nil {
+			return nil, nil
+		}
+		return m.snapshot(next), nil
+	})
+}
+
+// Blocks until {check} returns a result or an error. It's run
+// again whenever something changes, or an invoice expires
+func (m *MockLightningd) wait(timeout <-chan time.Time, check func() (interface{}, error)) (interface{}, error) {
+	for {
+		m.mu.Lock()
+		result, err := check()
+		changed := m.changed
+		expiry := m.nextExpiry()
+		m.mu.Unlock()
+		if result != nil || err != nil {
+			return result, err
+		}
+		if err := m.awaitChange(changed, expiry, timeout); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (m *MockLightningd) awaitChange(changed chan bool, expiry time.Time, timeout <-chan time.Time) error {
+	var expired <-chan time.Time
+	if !expiry.IsZero() {
+		timer := time.NewTimer(time.Until(expiry))
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case <-changed:
+	case <-expired:
+	case <-timeout:
+		return rpcError(ErrInvoiceWaitTimedOut, "Timed out")
+	case <-m.closed:
+		return fmt.Errorf("lightningd is shutting down")
+	}
+	return nil
+}
+
+// When the next unpaid invoice expires, or zero if none are left
+func (m *MockLightningd) nextExpiry() time.Time {
+	var next uint64
+	for _, inv := range m.invoices {
+		if m.status(inv) == glightning.InvoiceUnpaid && (next == 0 || inv.ExpiresAt < next) {
+			next = inv.ExpiresAt
+		}
+	}
+	if next == 0 {
+		return time.Time{}
+	}
+	// status has it expired once that second's over
+	return time.Unix(int64(next)+1, 0)
+}
+
+func (m *MockLightningd) pay(params json.RawMessage) (interface{}, error) {
+	var req glightning.PayRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, invalidParams(err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.payables[req.Bolt11]
+	if !ok {
+		return nil, rpcError(ErrPayRouteNotFound, "Could not find a route to pay %s", req.Bolt11)
+	}
+	for _, sp := range m.sendpays {
+		if sp.PaymentHash == p.paymentHash && sp.Status == glightning.PaymentComplete {
+			return nil, rpcError(ErrInvalidParams, "This payment was already completed")
+		}
+	}
+	msat := p.msat
+	if msat == 0 {
+		msat = req.MilliSatoshi
+	}
+	sp := &glightning.SendPayFields{
+		Id:                    uint64(len(m.sendpays) + 1),
+		PaymentHash:           p.paymentHash,
+		Destination:           p.destination,
+		AmountMilliSatoshiRaw: msat,
+		AmountMilliSatoshi:    glightning.NewMsat(msat).String(),
+		MilliSatoshiSentRaw:   msat,
+		MilliSatoshiSent:      glightning.NewMsat(msat).String(),
+		CreatedAt:             uint64(time.Now().Unix()),
+		Status:                glightning.PaymentComplete,
+		PaymentPreimage:       p.preimage,
+		Bolt11:                req.Bolt11,
+	}
+	m.sendpays = append(m.sendpays, sp)
+	return &glightning.PaymentSuccess{
+		SendPayFields: *sp,
+		GetRouteTries: 1,
+		SendPayTries:  1,
+	}, nil
+}
+
+func (m *MockLightningd) listPays(params json.RawMessage) (interface{}, error) {
+	var req glightning.ListPaysRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, invalidParams(err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pays := make([]glightning.PaymentFields, 0)
+	for _, sp := range m.sendpays {
+		if req.Bolt11 != "" && req.Bolt11 != sp.Bolt11 {
+			continue
+		}
+		if req.PaymentHash != "" && req.PaymentHash != sp.PaymentHash {
+			continue
+		}
+		if req.Status != "" && req.Status != sp.Status {
+			continue
+		}
+		pays = append(pays, glightning.PaymentFields{
+			Bolt11:                 sp.Bolt11,
+			PaymentHash:            sp.PaymentHash,
+			Status:                 sp.Status,
+			PaymentPreImage:        sp.PaymentPreimage,
+			AmountSentMilliSatoshi: sp.MilliSatoshiSent,
+			Label:                  sp.Label,
+		})
+	}
+	return map[string]interface{}{"pays": pays}, nil
+}
+
+func (m *MockLightningd) listSendPays(params json.RawMessage) (interface{}, error) {
+	var req glightning.ListSendPaysRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, invalidParams(err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// copies, they're marshalled after we let go of the lock
+	payments := make([]glightning.SendPayFields, 0)
+	for _, sp := range m.sendpays {
+		if req.Bolt11 != "" && req.Bolt11 != sp.Bolt11 {
+			continue
+		}
+		if req.PaymentHash != "" && req.PaymentHash != sp.PaymentHash {
+			continue
+		}
+		if req.Status != "" && req.Status != sp.Status {
+			continue
+		}
+		payments = append(payments, *sp)
+	}
+	return map[string]interface{}{"payments": payments}, nil
+}
+
+func (m *MockLightningd) connect(params json.RawMessage) (interface{}, error) {
+	var req glightning.ConnectRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, invalidParams(err)
+	}
+	if _, err := hex.DecodeString(req.PeerId); err != nil || len(req.PeerId) != 66 {
+		return nil, invalidParams(fmt.Errorf("id: should be a node id"))
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	peer := m.findPeer(req.PeerId)
+	if peer == nil {
+		peer = m.newPeer(req.PeerId)
+	}
+	peer.Connected = true
+	if req.Host != "" {
+		peer.NetAddresses = []string{fmt.Sprintf("%s:%d", req.Host, req.Port)}
+	}
+	return &glightning.ConnectResult{
+		Id:       peer.Id,
+		Features: peer.Features,
+	}, nil
+}
+
+func (m *MockLightningd) listPeers(params json.RawMessage) (interface{}, error) {
+	var req glightning.ListPeersRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, invalidParams(err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	peers := make([]*glightning.Peer, 0)
+	for _, peer := range m.peers {
+		if req.PeerId == "" || req.PeerId == peer.Id {
+			peers = append(peers, peer)
+		}
+	}
+	// marshal while we hold the lock
+	data, err := json.Marshal(map[string]interface{}{"peers": peers})
+	return json.RawMessage(data), err
+}
+
+func (m *MockLightningd) listPeerChannels(params json.RawMessage) (interface{}, error) {
+	var req glightning.ListPeerChannelsRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, invalidParams(err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	channels := make([]*glightning.PeerChannelInfo, 0)
+	for _, peer := range m.peers {
+		if req.PeerId != "" && req.PeerId != peer.Id {
+			continue
+		}
+		for _, ch := range peer.Channels {
+			if req.ShortChannelId != "" && req.ShortChannelId != ch.ShortChannelId {
+				continue
+			}
+			channels = append(channels, peerChannelInfo(peer, ch))
+		}
+	}
+	return map[string]interface{}{"channels": channels}, nil
+}
+
+func peerChannelInfo(peer *glightning.Peer, ch *glightning.PeerChannel) *glightning.PeerChannelInfo {
+	spendable := ch.MilliSatoshiToUs
+	if ch.State != "CHANNELD_NORMAL" {
+		spendable = 0
+	}
+	return &glightning.PeerChannelInfo{
+		PeerId:         peer.Id,
+		PeerConnected:  peer.Connected,
+		State:          ch.State,
+		ShortChannelId: ch.ShortChannelId,
+		ChannelId:      ch.ChannelId,
+		FundingTxId:    ch.FundingTxId,
+		Private:        ch.Private,
+		Opener:         glightning.ChannelSideLocal,
+		Features:       []string{},
+		Funding: &glightning.ChannelFunding{
+			LocalFundsMsat: ch.MilliSatoshiTotal,
+		},
+		ToUsMsat:       ch.MilliSatoshiToUs,
+		MinToUsMsat:    ch.MilliSatoshiToUs,
+		MaxToUsMsat:    ch.MilliSatoshiToUs,
+		TotalMsat:      ch.MilliSatoshiTotal,
+		SpendableMsat:  spendable,
+		ReceivableMsat: ch.MilliSatoshiTotal - ch.MilliSatoshiToUs,
+		Htlcs:          []*glightning.PeerChannelHtlc{},
+	}
+}
+
+func (m *MockLightningd) listClosedChannels(params json.RawMessage) (interface{}, error) {
+	var req glightning.ListClosedChannelsRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, invalidParams(err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	closed := make([]*glightning.ClosedChannel, 0)
+	for _, ch := range m.closedChannels {
+		if req.PeerId == "" || req.PeerId == ch.PeerId {
+			copied := *ch
+			closed = append(closed, &copied)
+		}
+	}
+	return map[string]interface{}{"closedchannels": closed}, nil
+}
+
+func (m *MockLightningd) disconnect(params json.RawMessage) (interface{}, error) {
+	var req glightning.DisconnectRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, invalidParams(err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	peer := m.findPeer(req.PeerId)
+	if peer == nil || !peer.Connected {
+		return nil, fmt.Errorf("Peer not connected")
+	}
+	if ch := activeChannel(peer); ch != nil && !req.Force {
+		return nil, fmt.Errorf("Peer is in state %s", ch.State)
+	}
+	peer.Connected = false
+	return nil, nil
+}
+
+func (m *MockLightningd) fundChannel(params json.RawMessage) (interface{}, error) {
+	var req glightning.FundChannelRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, invalidParams(err)
+	}
+	sats, err := strconv.ParseUint(req.Amount, 10, 64)
+	if err != nil {
+		return nil, invalidParams(fmt.Errorf("amount: should be a satoshi amount"))
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	peer := m.findPeer(req.Id)
+	if peer == nil || !peer.Connected {
+		return nil, fmt.Errorf("Unknown peer")
+	}
+	if activeChannel(peer) != nil {
+		return nil, fmt.Errorf("Peer already has a channel")
+	}
+
+	total := glightning.NewSat64(sats).ConvertMsat()
+	txid := randomHex(32)
+	ch := &glightning.PeerChannel{
+		State:             "CHANNELD_AWAITING_LOCKIN",
+		ChannelId:         randomHex(32),
+		FundingTxId:       txid,
+		Private:           !req.Announce,
+		MilliSatoshiToUs:  total.Value,
+		ToUsMsat:          total.String(),
+		MilliSatoshiTotal: total.Value,
+		TotalMsat:         total.String(),
+		SpendableMsat:     total.String(),
+		ReceivableMsat:    glightning.NewMsat(0).String(),
+	}
+	peer.Channels = append(peer.Channels, ch)
+	return &glightning.FundChannelResult{
+		FundingTx:   randomHex(100),
+		FundingTxId: txid,
+		ChannelId:   ch.ChannelId,
+	}, nil
+}
+
+func (m *MockLightningd) close(params json.RawMessage) (interface{}, error) {
+	var req glightning.CloseRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, invalidParams(err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, peer := range m.peers {
+		ch := activeChannel(peer)
+		if ch == nil {
+			continue
+		}
+		if req.PeerId == peer.Id || req.PeerId == ch.ChannelId || req.PeerId == ch.ShortChannelId {
+			ch.State = "CLOSINGD_COMPLETE"
+			// lightningd waits until the close is buried, we don't
+			m.closedChannels = append(m.closedChannels, &glightning.ClosedChannel{
+				PeerId:         peer.Id,
+				ChannelId:      ch.ChannelId,
+				ShortChannelId: ch.ShortChannelId,
+				Opener:         glightning.ChannelSideLocal,
+				Closer:         glightning.ChannelSideLocal,
+				Private:        ch.Private,
+				FundingTxId:    ch.FundingTxId,
+				TotalMsat:      ch.MilliSatoshiTotal,
+				FinalToUsMsat:  ch.MilliSatoshiToUs,
+				MinToUsMsat:    ch.MilliSatoshiToUs,
+				MaxToUsMsat:    ch.MilliSatoshiToUs,
+				CloseCause:     glightning.CauseUser,
+			})
+			return &glightning.CloseResult{
+				Tx:   randomHex(100),
+				TxId: randomHex(32),
+				Type: "mutual",
+			}, nil
+		}
+	}
+	return nil, invalidParams(fmt.Errorf("Short channel ID not found: '%s'", req.PeerId))
+}
+
+func (m *MockLightningd) datastore(params json.RawMessage) (interface{}, error) {
+	var req glightning.DatastoreRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, invalidParams(err)
+	}
+	if len(req.Key) == 0 {
+		return nil, invalidParams(fmt.Errorf("key must not be empty"))
+	}
+	value := []byte(req.String)
+	if req.Hex != "" {
+		var err error
+		if value, err = hex.DecodeString(req.Hex); err != nil {
+			return nil, invalidParams(err)
+		}
+	}
+	mode := req.Mode
+	if mode == "" {
+		mode = glightning.DatastoreMustCreate
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, entry := range m.store {
+		if isKeyPrefix(entry.Key, req.Key) && len(entry.Key) < len(req.Key) {
+			return nil, rpcError(glightning.ErrDatastoreUpdateNoChildren, "Parent key %v exists", entry.Key)
+		}
+		if isKeyPrefix(req.Key, entry.Key) && len(entry.Key) > len(req.Key) {
+			return nil, rpcError(glightning.ErrDatastoreUpdateHasChildren, "Key has children")
+		}
+	}
+	entry := m.findEntry(req.Key)
+	if entry == nil {
+		if mode == glightning.DatastoreMustReplace || mode == glightning.DatastoreMustAppend || req.Generation != nil {
+			return nil, rpcError(glightning.ErrDatastoreUpdateDoesNotExist, "Key does not exist")
+		}
+		entry = &glightning.DatastoreEntry{Key: req.Key}
+		m.store = append(m.store, entry)
+	} else {
+		if mode == glightning.DatastoreMustCreate {
+			return nil, rpcError(glightning.ErrDatastoreUpdateAlreadyExists, "Key already exists")
+		}
+		if req.Generation != nil && *req.Generation != entry.Generation {
+			return nil, rpcError(glightning.ErrDatastoreUpdateWrongGeneration, "generation is different")
+		}
+		if mode == glightning.DatastoreMustAppend || mode == glightning.DatastoreCreateOrAppend {
+			old, _ := hex.DecodeString(entry.Hex)
+			value = append(old, value...)
+		}
+		entry.Generation++
+	}
+	entry.Hex = hex.EncodeToString(value)
+	return datastoreSnapshot(entry), nil
+}
+
+func (m *MockLightningd) delDatastore(params json.RawMessage) (interface{}, error) {
+	var req glightning.DelDatastoreRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, invalidParams(err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, entry := range m.store {
+		if len(entry.Key) != len(req.Key) || !isKeyPrefix(req.Key, entry.Key) {
+			continue
+		}
+		if req.Generation != nil && *req.Generation != entry.Generation {
+			return nil, rpcError(glightning.ErrDatastoreDelWrongGeneration, "generation is different")
+		}
+		m.store = append(m.store[:i], m.store[i+1:]...)
+		return datastoreSnapshot(entry), nil
+	}
+	return nil, rpcError(glightning.ErrDatastoreDelDoesNotExist, "does not exist")
+}
+
+// The entry at the key, or the level below it, with entries
+// that only have children standing in for those children
+func (m *MockLightningd) listDatastore(params json.RawMessage) (interface{}, error) {
+	var req glightning.ListDatastoreRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, invalidParams(err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]*glightning.DatastoreEntry, 0)
+	if entry := m.findEntry(req.Key); entry != nil && len(req.Key) > 0 {
+		return map[string]interface{}{"datastore": append(list, datastoreSnapshot(entry))}, nil
+	}
+	seen := make(map[string]bool)
+	for _, entry := range m.store {
+		if len(entry.Key) <= len(req.Key) || !isKeyPrefix(req.Key, entry.Key) {
+			continue
+		}
+		key := entry.Key[:len(req.Key)+1]
+		if seen[fmt.Sprint(key)] {
+			continue
+		}
+		seen[fmt.Sprint(key)] = true
+		if len(key) == len(entry.Key) {
+			list = append(list, datastoreSnapshot(entry))
+		} else {
+			list = append(list, &glightning.DatastoreEntry{Key: key})
+		}
+	}
+	return map[string]interface{}{"datastore": list}, nil
+}
+
+func (m *MockLightningd) commando(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		PeerId string          `json:"peer_id"`
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+		Rune   string          `json:"rune"`
+	}
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, invalidParams(err)
+	}
+	m.mu.Lock()
+	peer := m.findPeer(req.PeerId)
+	connected := peer != nil && peer.Connected
+	m.mu.Unlock()
+	if !connected {
+		return nil, rpcError(ErrGeneric, "Peer %s is not connected", req.PeerId)
+	}
+	if _, err := glightning.DecodeRune(req.Rune); err != nil {
+		return nil, rpcError(glightning.ErrCommandoRemoteAuth, "Not authorized: %s", err)
+	}
+
+	resp := m.RpcServer.call(&rpcRequest{
+		Method: req.Method,
+		Params: req.Params,
+	})
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	return resp.Result, nil
+}
+
+func (m *MockLightningd) findEntry(key []string) *glightning.DatastoreEntry {
+	for _, entry := range m.store {
+		if len(entry.Key) == len(key) && isKeyPrefix(key, entry.Key) {
+			return entry
+		}
+	}
+	return nil
+}
+
+// is {prefix} the start of {key}
+func isKeyPrefix(prefix, key []string) bool {
+	if len(prefix) > len(key) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != key[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// a copy of the entry, with its value as a string if it is one
+func datastoreSnapshot(entry *glightning.DatastoreEntry) *glightning.DatastoreEntry {
+	copied := *entry
+	copied.Key = append([]string{}, entry.Key...)
+	if value, err := hex.DecodeString(entry.Hex); err == nil && utf8.Valid(value) {
+		copied.String = string(value)
+	}
+	return &copied
+}
+
+func (m *MockLightningd) findInvoice(label string) *glightning.Invoice {
+	for _, inv := range m.invoices {
+		if inv.Label == label {
+			return inv
+		}
+	}
+	return nil
+}
+
+func (m *MockLightningd) status(inv *glightning.Invoice) glightning.InvoiceStatus {
+	if inv.Status == glightning.InvoiceUnpaid && uint64(time.Now().Unix()) > inv.ExpiresAt {
+		return glightning.InvoiceExpired
+	}
+	return inv.Status
+}
+
+// a copy of the invoice, with its status brought up to date
+func (m *MockLightningd) snapshot(inv *glightning.Invoice) *glightning.Invoice {
+	copied := *inv
+	copied.Status = m.status(inv)
+	return &copied
+}
+
+func (m *MockLightningd) findPeer(peerId string) *glightning.Peer {
+	for _, peer := range m.peers {
+		if peer.Id == peerId {
+			return peer
+		}
+	}
+	return nil
+}
+
+func (m *MockLightningd) newPeer(peerId string) *glightning.Peer {
+	peer := &glightning.Peer{
+		Id:           peerId,
+		NetAddresses: []string{},
+		Features:     glightning.NewHexx([]byte{}),
+		Channels:     []*glightning.PeerChannel{},
+	}
+	m.peers = append(m.peers, peer)
+	return peer
+}
+
+// wake up anyone waiting on an invoice. must hold the lock
+func (m *MockLightningd) notifyChanged() {
+	close(m.changed)
+	m.changed = make(chan bool)
+}
+
+func activeChannel(peer *glightning.Peer) *glightning.PeerChannel {
+	for _, ch := range peer.Channels {
+		if ch.State == "CHANNELD_AWAITING_LOCKIN" || ch.State == "CHANNELD_NORMAL" {
+			return ch
+		}
+	}
+	return nil
+}
+
+func rpcError(code int, format string, args ...interface{}) *jrpc2.RpcError {
+	return &jrpc2.RpcError{
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+func invalidParams(err error) *jrpc2.RpcError {
+	return rpcError(ErrInvalidParams, "%s", err)
+}
+
+func newPreimage() (preimage, paymentHash string) {
+	b := make([]byte, 32)
+	rand.Read(b)
+	hash := sha256.Sum256(b)
+	return hex.EncodeToString(b), hex.EncodeToString(hash[:])
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
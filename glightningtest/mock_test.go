@@ -0,0 +1,483 @@
+package glightningtest_test
+
+import (
+	"github.com/niftynei/glightning/glightning"
+	"github.com/niftynei/glightning/glightningtest"
+	"github.com/niftynei/glightning/jrpc2"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const peerId = "03a3ef6dd4d8bd2e4c6ff4cbd6ad7d36e3dc7a35a6b3bd7e25d8f1cd0d38c8d7f5"
+
+func startMock(t *testing.T) (*glightningtest.MockLightningd, *glightning.Lightning) {
+	mock, err := glightningtest.NewMockLightningd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mock, mock.Client()
+}
+
+func TestMockInvoices(t *testing.T) {
+	mock, ln := startMock(t)
+	defer mock.Close()
+	defer ln.Shutdown()
+
+	inv, err := ln.Invoice(10000, "coffee", "a cup of coffee")
+	assert.Nil(t, err)
+	assert.Equal(t, 64, len(inv.PaymentHash))
+
+	_, err = ln.Invoice(10000, "coffee", "another cup")
+	assert.NotNil(t, err)
+	assert.Equal(t, glightningtest.ErrInvoiceLabelExists, err.(*jrpc2.RpcError).Code)
+
+	paid := make(chan *glightning.Invoice, 1)
+	go func() {
+		inv, err := ln.WaitInvoice("coffee")
+		assert.Nil(t, err)
+		paid <- inv
+	}()
+
+	listed, err := ln.GetInvoice("coffee")
+	assert.Nil(t, err)
+	assert.Equal(t, glightning.InvoiceUnpaid, listed.Status)
+	assert.Equal(t, "10000msat", listed.AmountMilliSatoshi)
+	byHash, err := ln.GetInvoiceByHash(inv.PaymentHash)
+	assert.Nil(t, err)
+	assert.Equal(t, "coffee", byHash.Label)
+	byString, err := ln.ListInvoicesWithRequest(&glightning.ListInvoiceRequest{InvString: inv.Bolt11})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(byString))
+
+	_, err = mock.PayInvoice("coffee")
+	assert.Nil(t, err)
+	select {
+	case inv := <-paid:
+		assert.Equal(t, glightning.InvoicePaid, inv.Status)
+		assert.Equal(t, uint64(1), inv.PayIndex)
+	case <-time.After(time.Second):
+		t.Fatal("waitinvoice never returned")
+	}
+
+	next, err := ln.WaitAnyInvoice(0)
+	assert.Nil(t, err)
+	assert.Equal(t, "coffee", next.Label)
+
+	_, err = ln.DeleteInvoice("coffee", "unpaid")
+	assert.Equal(t, glightningtest.ErrInvoiceBadStatus, err.(*jrpc2.RpcError).Code)
+	_, err = ln.DeleteInvoice("coffee", "paid")
+	assert.Nil(t, err)
+	invoices, err := ln.ListInvoices()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(invoices))
+}
+
+func TestMockWaitInvoiceEnds(t *testing.T) {
+	mock, ln := startMock(t)
+	defer mock.Close()
+	defer ln.Shutdown()
+
+	_, err := ln.CreateInvoice(10000, "tea", "a cup of tea", 1, nil, "", false)
+	assert.Nil(t, err)
+	_, err = ln.Invoice(10000, "cake", "a slice of cake")
+	assert.Nil(t, err)
+
+	expired := make(chan error, 1)
+	go func() {
+		_, err := ln.WaitInvoice("tea")
+		expired <- err
+	}()
+	deleted := make(chan error, 1)
+	go func() {
+		_, err := ln.WaitInvoice("cake")
+		deleted <- err
+	}()
+
+	select {
+	case err := <-expired:
+		assert.Equal(t, glightningtest.ErrInvoiceExpiredWait, err.(*jrpc2.RpcError).Code)
+	case <-time.After(5 * time.Second):
+		t.Fatal("waitinvoice didn't return once the invoice expired")
+	}
+
+	_, err = ln.DeleteInvoice("cake", "unpaid")
+	assert.Nil(t, err)
+	select {
+	case err := <-deleted:
+		assert.Equal(t, glightningtest.ErrInvoiceNotFound, err.(*jrpc2.RpcError).Code)
+	case <-time.After(time.Second):
+		t.Fatal("waitinvoice didn't return once the invoice was deleted")
+	}
+}
+
+func TestMockPeersAndChannels(t *testing.T) {
+	mock, ln := startMock(t)
+	defer mock.Close()
+	defer ln.Shutdown()
+
+	_, err := ln.FundChannel(peerId, glightning.NewSat(100000))
+	assert.NotNil(t, err)
+
+	id, err := ln.Connect(peerId, "127.0.0.1", 9735)
+	assert.Nil(t, err)
+	assert.Equal(t, peerId, id)
+
+	result, err := ln.FundChannel(peerId, glightning.NewSat(100000))
+	assert.Nil(t, err)
+	assert.Equal(t, 64, len(result.FundingTxId))
+
+	peer, err := ln.GetPeer(peerId)
+	assert.Nil(t, err)
+	assert.True(t, peer.Connected)
+	assert.Equal(t, 1, len(peer.Channels))
+	assert.Equal(t, "CHANNELD_AWAITING_LOCKIN", peer.Channels[0].State)
+	assert.Equal(t, "100000000msat", peer.Channels[0].TotalMsat)
+
+	assert.Nil(t, mock.LockIn(peerId))
+	channels, err := ln.GetPeerChannels(peerId)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(channels))
+	assert.Equal(t, "CHANNELD_NORMAL", channels[0].State)
+	assert.Equal(t, uint64(100000000), channels[0].SpendableMsat)
+	assert.Equal(t, peer.Channels[0].ChannelId, channels[0].ChannelId)
+	closedChannels, err := ln.ListClosedChannels("")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(closedChannels))
+
+	info, err := ln.GetInfo()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, info.PeerCount)
+	assert.Equal(t, 1, info.ActiveChannelCount)
+
+	// can't disconnect with an active channel
+	assert.NotNil(t, ln.Disconnect(peerId, false))
+
+	closed, err := ln.CloseNormal(peerId)
+	assert.Nil(t, err)
+	assert.Equal(t, "mutual", closed.Type)
+	assert.Nil(t, ln.Disconnect(peerId, false))
+
+	peer, err = ln.GetPeer(peerId)
+	assert.Nil(t, err)
+	assert.False(t, peer.Connected)
+	assert.Equal(t, "CLOSINGD_COMPLETE", peer.Channels[0].State)
+
+	closedChannels, err = ln.ListClosedChannels(peerId)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(closedChannels))
+	assert.Equal(t, glightning.CauseUser, closedChannels[0].CloseCause)
+	assert.Equal(t, uint64(100000000), closedChannels[0].FinalToUsMsat)
+	assert.Equal(t, channels[0].ShortChannelId, closedChannels[0].ShortChannelId)
+}
+
+func TestMockPayments(t *testing.T) {
+	mock, ln := startMock(t)
+	defer mock.Close()
+	defer ln.Shutdown()
+
+	_, err := ln.PayBolt("lnbcrt1unknown")
+	assert.Equal(t, glightningtest.ErrPayRouteNotFound, err.(*jrpc2.RpcError).Code)
+
+	hash := mock.AddPayable("lnbcrt1payme", 5000, peerId)
+	paid, err := ln.PayBolt("lnbcrt1payme")
+	assert.Nil(t, err)
+	assert.Equal(t, hash, paid.PaymentHash)
+	assert.Equal(t, glightning.PaymentComplete, paid.Status)
+	assert.Equal(t, "5000msat", paid.MilliSatoshiSent)
+
+	// can't pay it twice
+	_, err = ln.PayBolt("lnbcrt1payme")
+	assert.NotNil(t, err)
+
+	pays, err := ln.ListPays()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pays))
+	assert.Equal(t, paid.PaymentPreimage, pays[0].PaymentPreImage)
+
+	sendpays, err := ln.ListSendPaysByHash(hash)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(sendpays))
+	assert.Equal(t, peerId, sendpays[0].Destination)
+
+	pays, err = ln.ListPaysByHash(hash)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pays))
+	assert.Equal(t, "lnbcrt1payme", pays[0].Bolt11)
+	pays, err = ln.ListPaysByStatus(glightning.PaymentFailed)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(pays))
+	sendpays, err = ln.ListSendPaysByStatus(glightning.PaymentComplete)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(sendpays))
+}
+
+func TestRemoteLightning(t *testing.T) {
+	mock, ln := startMock(t)
+	defer mock.Close()
+	defer ln.Shutdown()
+
+	const testRune = "zFMd1fjhrAYxUeFA54TjloZqOt8JrA_i_nYwIgXkag49MA=="
+	remote := glightning.NewRemoteLightning(ln, peerId, testRune)
+	_, err := remote.GetInfo()
+	assert.NotNil(t, err, "peer isn't connected yet")
+
+	mock.AddPeer(peerId, true)
+	info, err := remote.GetInfo()
+	assert.Nil(t, err)
+	assert.Equal(t, mock.Info.Id, info.Id)
+
+	inv, err := remote.Invoice(10000, "remote", "made over commando")
+	assert.Nil(t, err)
+	local, err := ln.GetInvoiceByHash(inv.PaymentHash)
+	assert.Nil(t, err)
+	assert.Equal(t, "remote", local.Label)
+
+	calls := mock.Calls("commando")
+	assert.Equal(t, 3, len(calls))
+	var req glightning.CommandoRequest
+	assert.Nil(t, calls[2].ParseParams(&req))
+	assert.Equal(t, "invoice", req.Method)
+	assert.Equal(t, peerId, req.PeerId)
+	assert.Equal(t, testRune, req.Rune)
+
+	// errors from the command come back as they are
+	_, err = remote.Invoice(10000, "remote", "again")
+	assert.Equal(t, glightningtest.ErrInvoiceLabelExists, err.(*jrpc2.RpcError).Code)
+
+	_, err = glightning.NewRemoteLightning(ln, peerId, "not a rune").GetInfo()
+	assert.Equal(t, glightning.ErrCommandoRemoteAuth, err.(*jrpc2.RpcError).Code)
+
+	// starting it up does nothing, but is harmless
+	remote.StartUp("", "")
+	assert.True(t, remote.IsUp())
+
+	stopped := make(chan bool, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			remote.Shutdown()
+			stopped <- true
+		}()
+	}
+	<-stopped
+	<-stopped
+	assert.False(t, remote.IsUp())
+	assert.True(t, ln.IsUp())
+	_, err = remote.GetInfo()
+	assert.NotNil(t, err)
+}
+
+func TestMockMethodSubset(t *testing.T) {
+	mock, err := glightningtest.NewMockLightningd("getinfo")
+	assert.Nil(t, err)
+	defer mock.Close()
+	ln := mock.Client()
+	defer ln.Shutdown()
+
+	info, err := ln.GetInfo()
+	assert.Nil(t, err)
+	assert.Equal(t, "regtest", info.Network)
+
+	_, err = ln.ListPeers()
+	assert.Equal(t, jrpc2.MethodNotFound, err.(*jrpc2.RpcError).Code)
+}
+
+func TestMockDatastore(t *testing.T) {
+	mock, ln := startMock(t)
+	defer mock.Close()
+	defer ln.Shutdown()
+
+	key := []string{"myplugin", "config"}
+	entry, err := ln.Datastore(glightning.NewDatastoreStringRequest(key, "v1", glightning.DatastoreMustCreate))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), entry.Generation)
+	assert.Equal(t, "v1", entry.String)
+
+	_, err = ln.Datastore(glightning.NewDatastoreStringRequest(key, "v2", glightning.DatastoreMustCreate))
+	assert.Equal(t, glightning.ErrDatastoreUpdateAlreadyExists, err.(*jrpc2.RpcError).Code)
+
+	// compare-and-swap on the generation
+	entry, err = ln.Datastore(glightning.NewDatastoreStringRequest(key, "v2", glightning.DatastoreMustReplace).IfGeneration(0))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), entry.Generation)
+	_, err = ln.Datastore(glightning.NewDatastoreStringRequest(key, "v3", glightning.DatastoreMustReplace).IfGeneration(0))
+	assert.Equal(t, glightning.ErrDatastoreUpdateWrongGeneration, err.(*jrpc2.RpcError).Code)
+
+	entry, err = ln.Datastore(glightning.NewDatastoreHexRequest(key, []byte{0xff}, glightning.DatastoreCreateOrAppend))
+	assert.Nil(t, err)
+	value, err := entry.Bytes()
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{'v', '2', 0xff}, value)
+	assert.Equal(t, "", entry.String)
+
+	_, err = ln.Datastore(glightning.NewDatastoreStringRequest([]string{"myplugin"}, "x", glightning.DatastoreCreateOrReplace))
+	assert.Equal(t, glightning.ErrDatastoreUpdateHasChildren, err.(*jrpc2.RpcError).Code)
+
+	top, err := ln.ListDatastore(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []*glightning.DatastoreEntry{{Key: []string{"myplugin"}}}, top)
+
+	found, err := ln.GetDatastore(key)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), found.Generation)
+	missing, err := ln.GetDatastore([]string{"myplugin", "nope"})
+	assert.Nil(t, err)
+	assert.Nil(t, missing)
+
+	generation := uint64(1)
+	_, err = ln.DelDatastore(key, &generation)
+	assert.Equal(t, glightning.ErrDatastoreDelWrongGeneration, err.(*jrpc2.RpcError).Code)
+	_, err = ln.DelDatastore(key, nil)
+	assert.Nil(t, err)
+	_, err = ln.DelDatastore(key, nil)
+	assert.Equal(t, glightning.ErrDatastoreDelDoesNotExist, err.(*jrpc2.RpcError).Code)
+}
+
+type peerState struct {
+	Score int      `json:"score"`
+	Notes []string `json:"notes"`
+}
+
+func TestKVStore(t *testing.T) {
+	mock, ln := startMock(t)
+	defer mock.Close()
+	defer ln.Shutdown()
+
+	store := glightning.NewKVStore(ln, "myplugin", "peers")
+	var state peerState
+	found, err := store.Get(peerId, &state)
+	assert.Nil(t, err)
+	assert.False(t, found)
+
+	assert.Nil(t, store.Put(peerId, &peerState{Score: 10}))
+	found, err = store.Get(peerId, &state)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 10, state.Score)
+
+	// stored as json, readable with listdatastore
+	entry, err := ln.GetDatastore([]string{"myplugin", "peers", peerId})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"score":10,"notes":null}`, entry.String)
+
+	for i := 0; i < 3; i++ {
+		var update peerState
+		err = store.Update(peerId, &update, func() error {
+			update.Score++
+			return nil
+		})
+		assert.Nil(t, err)
+	}
+	var other peerState
+	err = store.Update("other", &other, func() error {
+		other.Notes = append(other.Notes, "new")
+		return nil
+	})
+	assert.Nil(t, err)
+
+	found, err = store.Get(peerId, &state)
+	assert.Nil(t, err)
+	assert.Equal(t, 13, state.Score)
+
+	names, err := store.Keys()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{peerId, "other"}, names)
+
+	assert.Nil(t, store.Delete(peerId))
+	assert.Nil(t, store.Delete(peerId))
+	names, err = store.Keys()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"other"}, names)
+}
+
+func TestKVStoreUpdateRetry(t *testing.T) {
+	mock, ln := startMock(t)
+	defer mock.Close()
+	defer ln.Shutdown()
+
+	store := glightning.NewKVStore(ln, "myplugin", "peers")
+	assert.Nil(t, store.Put(peerId, &peerState{Score: 10}))
+
+	// it's deleted under us the first time round, so the
+	// second attempt starts from scratch
+	calls := 0
+	update := peerState{Score: 1}
+	err := store.Update(peerId, &update, func() error {
+		calls++
+		if calls == 1 {
+			assert.Equal(t, 10, update.Score)
+			assert.Nil(t, store.Delete(peerId))
+		} else {
+			assert.Equal(t, 1, update.Score)
+		}
+		update.Score += 5
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, calls)
+
+	var state peerState
+	found, err := store.Get(peerId, &state)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 6, state.Score)
+
+	assert.NotNil(t, store.Update(peerId, update, func() error { return nil }))
+}
+
+func TestKVStoreParentKey(t *testing.T) {
+	mock, ln := startMock(t)
+	defer mock.Close()
+	defer ln.Shutdown()
+
+	assert.Nil(t, glightning.NewKVStore(ln, "myplugin", "peers").Put(peerId, &peerState{Score: 10}))
+
+	// "peers" only has children, there's no value there
+	store := glightning.NewKVStore(ln, "myplugin")
+	var state peerState
+	found, err := store.Get("peers", &state)
+	assert.Nil(t, err)
+	assert.False(t, found)
+	names, err := store.Keys()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(names))
+}
+
+func TestMockInvoicePaging(t *testing.T) {
+	mock, ln := startMock(t)
+	defer mock.Close()
+	defer ln.Shutdown()
+
+	for _, label := range []string{"a", "b", "c", "d", "e"} {
+		_, err := ln.Invoice(1000, label, "paging")
+		assert.Nil(t, err)
+	}
+	_, err := mock.PayInvoice("d")
+	assert.Nil(t, err)
+	_, err = mock.PayInvoice("b")
+	assert.Nil(t, err)
+
+	page, err := ln.ListInvoicesPaged(glightning.IndexCreated, 2, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(page))
+	assert.Equal(t, "b", page[0].Label)
+	assert.Equal(t, uint64(3), page[1].CreatedIndex)
+
+	var labels []string
+	it := ln.IterateInvoices(glightning.IndexCreated, 0, 2)
+	for it.Next() {
+		labels = append(labels, it.Invoice().Label)
+	}
+	assert.Nil(t, it.Err())
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, labels)
+	assert.Equal(t, uint64(6), it.NextStart())
+
+	// only the paid ones have been updated, in the order they were paid
+	labels = nil
+	it = ln.IterateInvoices(glightning.IndexUpdated, 0, 2)
+	for it.Next() {
+		labels = append(labels, it.Invoice().Label)
+	}
+	assert.Nil(t, it.Err())
+	assert.Equal(t, []string{"d", "b"}, labels)
+}
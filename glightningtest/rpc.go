@@ -0,0 +1,231 @@
+package glightningtest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/niftynei/glightning/jrpc2"
+	"log"
+	"net"
+	"sync"
+)
+
+// lightningd's catch-all error code
+const ErrGeneric = -1
+
+// Answers a single RPC call. Return a *jrpc2.RpcError to control
+// the error code that's sent back; any other error is sent
+// with code ErrGeneric.
+type RpcHandler func(params json.RawMessage) (interface{}, error)
+
+// A call the RpcServer received
+type RpcCall struct {
+	Method string
+	Params json.RawMessage
+}
+
+// Unmarshal the call's parameters into {into}
+func (c *RpcCall) ParseParams(into interface{}) error {
+	return json.Unmarshal(c.Params, into)
+}
+
+// An RpcServer stands in for lightningd's JSON-RPC unix socket.
+// It answers calls with whatever's been registered for the method,
+// and keeps a record of every call it receives.
+type RpcServer struct {
+	socket   string
+	listener net.Listener
+	mu       sync.Mutex
+	handlers map[string]RpcHandler
+	calls    []*RpcCall
+	conns    map[net.Conn]bool
+	closed   bool
+}
+
+// Start listening on the unix socket at {socket}
+func NewRpcServer(socket string) (*RpcServer, error) {
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	s := &RpcServer{
+		socket:   socket,
+		listener: ln,
+		handlers: make(map[string]RpcHandler),
+		conns:    make(map[net.Conn]bool),
+	}
+	go s.accept()
+	return s, nil
+}
+
+func (s *RpcServer) Socket() string {
+	return s.socket
+}
+
+// Answer calls to {method} with {fn}. Replaces any
+// existing handler for the method.
+func (s *RpcServer) Handle(method string, fn RpcHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[method] = fn
+}
+
+// Always answer {method} with {result}
+func (s *RpcServer) Respond(method string, result interface{}) {
+	s.Handle(method, func(params json.RawMessage) (interface{}, error) {
+		return result, nil
+	})
+}
+
+// Always answer {method} with an error
+func (s *RpcServer) RespondError(method string, code int, message string) {
+	s.Handle(method, func(params json.RawMessage) (interface{}, error) {
+		return nil, &jrpc2.RpcError{
+			Code:    code,
+			Message: message,
+		}
+	})
+}
+
+// The calls received for {method}, oldest first. Pass an
+// empty method name to get every call.
+func (s *RpcServer) Calls(method string) []*RpcCall {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	calls := make([]*RpcCall, 0)
+	for _, call := range s.calls {
+		if method == "" || call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Drop any open connections, as if lightningd had gone away.
+// The server keeps listening for new ones.
+func (s *RpcServer) Disconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+		delete(s.conns, conn)
+	}
+}
+
+func (s *RpcServer) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.Disconnect()
+	return s.listener.Close()
+}
+
+func (s *RpcServer) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if !closed {
+				log.Print(err.Error())
+			}
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+		go s.serve(conn)
+	}
+}
+
+type rpcRequest struct {
+	Id     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type rpcResponse struct {
+	Version string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *jrpc2.RpcError `json:"error,omitempty"`
+}
+
+func (s *RpcServer) serve(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	var writeMu sync.Mutex
+	out := bufio.NewWriter(conn)
+	decoder := json.NewDecoder(conn)
+	for {
+		var req rpcRequest
+		if err := decoder.Decode(&req); err != nil {
+			// hung up, or sent us junk
+			return
+		}
+		go func(req rpcRequest) {
+			resp := s.call(&req)
+			// notifications don't get an answer
+			if len(req.Id) == 0 {
+				return
+			}
+			data, err := json.Marshal(resp)
+			if err != nil {
+				log.Print(err.Error())
+				return
+			}
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			out.Write(data)
+			out.Write([]byte("\n\n"))
+			out.Flush()
+		}(req)
+	}
+}
+
+func (s *RpcServer) call(req *rpcRequest) *rpcResponse {
+	s.mu.Lock()
+	s.calls = append(s.calls, &RpcCall{
+		Method: req.Method,
+		Params: req.Params,
+	})
+	handler, ok := s.handlers[req.Method]
+	s.mu.Unlock()
+
+	resp := &rpcResponse{
+		Version: "2.0",
+		Id:      req.Id,
+	}
+	if !ok {
+		resp.Error = &jrpc2.RpcError{
+			Code:    jrpc2.MethodNotFound,
+			Message: fmt.Sprintf("Unknown command '%s'", req.Method),
+		}
+		return resp
+	}
+
+	result, err := handler(req.Params)
+	if err != nil {
+		if rpcErr, ok := err.(*jrpc2.RpcError); ok {
+			resp.Error = rpcErr
+		} else {
+			resp.Error = &jrpc2.RpcError{
+				Code:    ErrGeneric,
+				Message: err.Error(),
+			}
+		}
+		return resp
+	}
+	if result == nil {
+		// must send back one or the other
+		result = struct{}{}
+	}
+	resp.Result = result
+	return resp
+}
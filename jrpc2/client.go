@@ -24,24 +24,37 @@ type Client struct {
 	requestQueue   chan *Request
 	pending        sync.Map // map[string]chan *RawResponse
 	requestCounter int64
-	shutdown       bool
-	timeout        time.Duration
+	// seconds, accessed atomically
+	timeout int64
+
+	mu sync.Mutex
+	// closed when the current connection shuts down. Senders
+	// select on it, the request queue itself is never closed
+	done     chan struct{}
+	shutdown bool
+	// set by Close, the client can't be started again
+	closed bool
 }
 
 func NewClient() *Client {
 	client := &Client{}
 	client.requestQueue = make(chan *Request)
-	client.timeout = time.Duration(20)
+	client.done = make(chan struct{})
+	client.timeout = 20
 	return client
 }
 
 func (c *Client) SetTimeout(secs uint) {
-	c.timeout = time.Duration(secs)
+	atomic.StoreInt64(&c.timeout, int64(secs))
 }
 
 func (c *Client) StartUp(in, out *os.File) {
-	c.shutdown = false
-	go c.setupWriteQueue(out)
+	done, err := c.start()
+	if err != nil {
+		log.Print(err.Error())
+		return
+	}
+	go c.setupWriteQueue(out, done)
 	c.readQueue(in)
 }
 
@@ -49,46 +62,98 @@ func (c *Client) StartUp(in, out *os.File) {
 // This method blocks. The up channel is an optional
 // channel to receive  notification when the connection is set up
 func (c *Client) SocketStart(socket string, up chan bool) error {
-	c.shutdown = false
 	conn, err := net.Dial("unix", socket)
 	if err != nil {
+		// nothing's listening, don't queue up requests
+		c.Shutdown()
 		return fmt.Errorf("Unable to dial socket %s:%s", socket, err.Error())
 	}
-	defer conn.Close()
+	done, err := c.start()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	readDone := make(chan bool)
 	go func(conn net.Conn, up chan bool) {
 		if up != nil {
 			up <- true
 		}
 		c.readQueue(conn)
+		close(readDone)
 	}(conn, up)
-	c.setupWriteQueue(conn)
+	c.setupWriteQueue(conn, done)
+
+	// wait for the reader to finish up, so that
+	// it's safe to start the client again
+	conn.Close()
+	<-readDone
 	return nil
 }
 
+// Mark the client as up, returning the channel that's closed
+// when this connection shuts down
+func (c *Client) start() (chan struct{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, fmt.Errorf("Client is closed")
+	}
+	if c.shutdown {
+		c.done = make(chan struct{})
+		c.shutdown = false
+	}
+	return c.done, nil
+}
+
+// Shut down the current connection. Requests waiting on a response
+// fail, as do any made until the client is started again. It's safe
+// to call more than once, from any goroutine.
 func (c *Client) Shutdown() {
-	c.shutdown = true
-	close(c.requestQueue)
-	c.pending.Range(func(key, value interface{}) bool {
-		v_chan, ok := value.(chan *RawResponse)
-		if !ok {
-			panic("value not chan *RawResponse")
-		}
-		close(v_chan)
-		c.pending.Delete(key)
-		return true
-	})
-	c.requestQueue = make(chan *Request)
+	c.mu.Lock()
+	if !c.shutdown {
+		c.shutdown = true
+		close(c.done)
+	}
+	c.mu.Unlock()
+}
+
+// Shut the client down for good: unlike after Shutdown, it
+// can't be started again.
+func (c *Client) Close() {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	c.Shutdown()
 }
 
 func (c *Client) IsUp() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return !c.shutdown
 }
 
-func (c *Client) setupWriteQueue(outW io.Writer) {
+// The channel that's closed when the current connection shuts
+// down, or an error if it already has
+func (c *Client) current() (chan struct{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.shutdown {
+		return nil, fmt.Errorf("Client is shutdown")
+	}
+	return c.done, nil
+}
+
+func (c *Client) setupWriteQueue(outW io.Writer, done chan struct{}) {
 	out := bufio.NewWriter(outW)
 	defer out.Flush()
 	twoNewlines := []byte("\n\n")
-	for request := range c.requestQueue {
+	for {
+		var request *Request
+		select {
+		case request = <-c.requestQueue:
+		case <-done:
+			return
+		}
 		data, err := json.Marshal(request)
 		if err != nil {
 			// todo: send error back to waiting response
@@ -108,16 +173,17 @@ func (c *Client) setupWriteQueue(outW io.Writer) {
 
 func (c *Client) readQueue(in io.Reader) {
 	decoder := json.NewDecoder(in)
-	for !c.shutdown {
+	for c.IsUp() {
 		var rawResp RawResponse
 		if err := decoder.Decode(&rawResp); err == io.EOF {
-			c.Shutdown()
 			break
 		} else if err != nil {
-			log.Print(err.Error())
+			if c.IsUp() {
+				log.Print(err.Error())
+			}
 			break
 		}
-		go processResponse(c, &rawResp)
+		processResponse(c, &rawResp)
 	}
 
 	// there's a problem with the input, shutdown
@@ -142,62 +208,83 @@ func processResponse(c *Client, resp *RawResponse) {
 		log.Printf("No return channel found for response with id %s", id)
 		return
 	}
-	respChan.(chan *RawResponse) <- resp
 	c.pending.Delete(id)
+	// there's room for exactly one response, drop any repeats
+	select {
+	case respChan.(chan *RawResponse) <- resp:
+	default:
+	}
 }
 
 // Sends a notification to the server. No response is expected,
 // and no ID is assigned to the request.
 func (c *Client) Notify(m Method) error {
-	if c.shutdown {
+	done, err := c.current()
+	if err != nil {
+		return err
+	}
+	select {
+	case c.requestQueue <- &Request{nil, m}:
+		return nil
+	case <-done:
 		return fmt.Errorf("Client is shutdown")
 	}
-	req := &Request{nil, m}
-	c.requestQueue <- req
-	return nil
 }
 
 // Isses an RPC call. Is blocking. Times out after {timeout}
 // seconds (set on client).
 func (c *Client) Request(m Method, resp interface{}) error {
-	if c.shutdown {
-		return fmt.Errorf("Client is shutdown")
-	}
-	id := c.NextId()
-	// set up to get a response back
-	replyChan := make(chan *RawResponse, 1)
-	c.pending.Store(id.Val(), replyChan)
-
-	// send the request out
-	req := &Request{id, m}
-	c.requestQueue <- req
+	secs := atomic.LoadInt64(&c.timeout)
+	return c.request(m, resp, time.After(time.Duration(secs)*time.Second))
+}
 
-	select {
-	case rawResp := <-replyChan:
-		return handleReply(rawResp, resp)
-	case <-time.After(c.timeout * time.Second):
-		c.pending.Delete(id.Val())
-		return fmt.Errorf("Request timed out")
-	}
+// Like Request, but times out after {secs} seconds instead of
+// the client's timeout
+func (c *Client) RequestWithTimeout(m Method, resp interface{}, secs uint) error {
+	return c.request(m, resp, time.After(time.Duration(secs)*time.Second))
 }
 
 // Hangs until a response comes. Be aware that this may never
 // terminate.
 func (c *Client) RequestNoTimeout(m Method, resp interface{}) error {
-	if c.shutdown {
-		return fmt.Errorf("Client is shutdown")
+	return c.request(m, resp, nil)
+}
+
+// A nil {timeout} never fires
+func (c *Client) request(m Method, resp interface{}, timeout <-chan time.Time) error {
+	done, err := c.current()
+	if err != nil {
+		return err
 	}
 	id := c.NextId()
 	// set up to get a response back
 	replyChan := make(chan *RawResponse, 1)
 	c.pending.Store(id.Val(), replyChan)
+	defer c.pending.Delete(id.Val())
 
 	// send the request out
-	req := &Request{id, m}
-	c.requestQueue <- req
+	select {
+	case c.requestQueue <- &Request{id, m}:
+	case <-done:
+		return handleReply(nil, resp)
+	case <-timeout:
+		return fmt.Errorf("Request timed out")
+	}
 
-	rawResp := <-replyChan
-	return handleReply(rawResp, resp)
+	select {
+	case rawResp := <-replyChan:
+		return handleReply(rawResp, resp)
+	case <-done:
+		// a response may have beaten the shutdown
+		select {
+		case rawResp := <-replyChan:
+			return handleReply(rawResp, resp)
+		default:
+			return handleReply(nil, resp)
+		}
+	case <-timeout:
+		return fmt.Errorf("Request timed out")
+	}
 }
 
 func handleReply(rawResp *RawResponse, resp interface{}) error {
@@ -5,7 +5,9 @@ import (
 	"github.com/niftynei/glightning/jrpc2"
 	"github.com/stretchr/testify/assert"
 	"io"
+	"io/ioutil"
 	"log"
+	"net"
 	"os"
 	"sync"
 	"testing"
@@ -89,6 +91,10 @@ func TestClientIncomingInvalidJson(t *testing.T) {
 		n, _ := logs.Read(buf)
 		// check that we failed for a reason
 		assert.Equal(t, "Must send either a result or an error in a response\n", string(buf[20:n]))
+		// it shuts down once the log's been read
+		for i := 0; i < 100 && client.IsUp(); i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
 		assert.Equal(t, false, client.IsUp())
 	case <-time.After(4 * time.Second):
 		t.Logf("test timed out after %d", 4)
@@ -244,6 +250,137 @@ func TestClientShutdown(t *testing.T) {
 	}
 }
 
+func TestClientShutdownTwice(t *testing.T) {
+	in, out, _, _ := setupWritePipes(t)
+
+	client := jrpc2.NewClient()
+	client.SetTimeout(1)
+	go client.StartUp(in, out)
+
+	// the reader hitting EOF and an explicit shutdown can race
+	done := make(chan bool, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			client.Shutdown()
+			done <- true
+		}()
+	}
+	<-done
+	<-done
+	out.Close()
+	in.Close()
+	assert.False(t, client.IsUp())
+
+	_, err := subtract(client, 5, 1)
+	assert.Equal(t, "Client is shutdown", err.Error())
+	assert.Equal(t, "Client is shutdown", client.Notify(&HelloMethod{1, 2, 3}).Error())
+}
+
+func TestClientClose(t *testing.T) {
+	client := jrpc2.NewClient()
+	client.Close()
+	client.Close()
+	assert.False(t, client.IsUp())
+
+	// closed clients don't come back up, even if there's
+	// something to connect to
+	tmpfile, err := ioutil.TempFile("", "rpc.socket")
+	assert.Nil(t, err)
+	os.Remove(tmpfile.Name())
+	ln, err := net.Listen("unix", tmpfile.Name())
+	assert.Nil(t, err)
+	defer ln.Close()
+
+	err = client.SocketStart(tmpfile.Name(), nil)
+	assert.Equal(t, "Client is closed", err.Error())
+	assert.False(t, client.IsUp())
+	_, err = subtract(client, 5, 1)
+	assert.Equal(t, "Client is shutdown", err.Error())
+}
+
+type Blocker struct {
+	started chan bool
+	release chan bool
+}
+
+func (b *Blocker) Name() string {
+	return "block"
+}
+
+func (b *Blocker) New() interface{} {
+	return &Blocker{b.started, b.release}
+}
+
+func (b *Blocker) Call() (jrpc2.Result, error) {
+	b.started <- true
+	<-b.release
+	return "done", nil
+}
+
+type ClientBlock struct{}
+
+func (c *ClientBlock) Name() string {
+	return "block"
+}
+
+func TestServerDrain(t *testing.T) {
+	s, in, out := setupServer(t)
+	blocker := &Blocker{make(chan bool, 1), make(chan bool)}
+	s.Register(blocker)
+	s.Register(&Subtract{})
+	client := jrpc2.NewClient()
+	client.SetTimeout(5)
+	go client.StartUp(in, out)
+
+	blocked := make(chan error, 1)
+	go func() {
+		var result string
+		blocked <- client.Request(&ClientBlock{}, &result)
+	}()
+	<-blocker.started
+
+	assert.False(t, s.Drain(10*time.Millisecond))
+	// we're draining, new requests are turned away
+	_, err := subtract(client, 8, 2)
+	assert.Equal(t, "-32603:Server is shutting down", err.Error())
+
+	close(blocker.release)
+	assert.True(t, s.Drain(time.Second))
+	assert.Nil(t, <-blocked)
+	s.Shutdown()
+	s.Shutdown()
+}
+
+type Panicker struct{}
+
+func (p *Panicker) Name() string {
+	return "panic"
+}
+
+func (p *Panicker) New() interface{} {
+	return &Panicker{}
+}
+
+func (p *Panicker) Call() (jrpc2.Result, error) {
+	panic("oh no")
+}
+
+func TestServerMethodPanics(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer resetLogger()
+	s, in, out := setupServer(t)
+	s.Register(&Panicker{})
+	client := jrpc2.NewClient()
+	client.SetTimeout(5)
+	go client.StartUp(in, out)
+
+	var result string
+	err := client.Request(&Panicker{}, &result)
+	assert.Equal(t, "-1:panic panicked: oh no", err.Error())
+	// it's not left in flight
+	assert.True(t, s.Drain(time.Second))
+}
+
 // a notification should:
 //  - not have an id
 //  - return immediately
@@ -276,6 +413,20 @@ func TestClientNoResponse(t *testing.T) {
 	assert.Equal(t, "Request timed out", err.Error())
 }
 
+func TestClientRequestWithTimeout(t *testing.T) {
+	in, out, _, _ := setupWritePipes(t)
+
+	client := jrpc2.NewClient()
+	client.SetTimeout(60)
+	go client.StartUp(in, out)
+
+	start := time.Now()
+	var response int
+	err := client.RequestWithTimeout(&ClientSubtract{5, 1}, &response, 1)
+	assert.Equal(t, "Request timed out", err.Error())
+	assert.True(t, time.Since(start) < 10*time.Second)
+}
+
 func subtract(client *jrpc2.Client, minuend, subtrahend int) (int, error) {
 	var response int
 	err := client.Request(&ClientSubtract{minuend, subtrahend}, &response)
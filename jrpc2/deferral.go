@@ -0,0 +1,142 @@
+package jrpc2
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// A Deferral is returned from a ServerMethod's Call to signal
+// that the response to this request will be sent at a later time,
+// via Resolve or Fail.
+//
+// If a timeout is set and the deferral hasn't been resolved by the
+// time it elapses, the fallback result is sent instead. If there's
+// no fallback, an error is sent.
+type Deferral struct {
+	mu       sync.Mutex
+	server   *Server
+	id       *Id
+	timeout  time.Duration
+	timer    *time.Timer
+	fallback Result
+	// set if resolved before we knew where to send it
+	response *Response
+	done     bool
+	onDone   []func()
+}
+
+// anything that embeds a *Deferral can be returned
+// as a deferred result
+type deferred interface {
+	deferral() *Deferral
+}
+
+func NewDeferral(timeout time.Duration, fallback Result) *Deferral {
+	// a typed nil pointer is not a fallback
+	if fallback != nil {
+		v := reflect.ValueOf(fallback)
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			fallback = nil
+		}
+	}
+	return &Deferral{
+		timeout:  timeout,
+		fallback: fallback,
+	}
+}
+
+func (d *Deferral) deferral() *Deferral {
+	return d
+}
+
+// The id of the request this deferral will answer. Is nil
+// until the method call that created it has returned.
+func (d *Deferral) Id() *Id {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.id
+}
+
+func (d *Deferral) IsDone() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.done
+}
+
+// Register a callback for when this deferral is resolved, failed
+// or timed out
+func (d *Deferral) OnDone(fn func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.onDone = append(d.onDone, fn)
+}
+
+// Send the result back to the caller. Safe to call from any goroutine.
+// Returns an error if this deferral has already been completed.
+func (d *Deferral) Resolve(result Result) error {
+	return d.finish(&Response{Result: result})
+}
+
+// Send an error back to the caller. Safe to call from any goroutine.
+func (d *Deferral) Fail(err error) error {
+	return d.finish(&Response{Error: constructError(err)})
+}
+
+func (d *Deferral) finish(resp *Response) error {
+	d.mu.Lock()
+	if d.done {
+		d.mu.Unlock()
+		return errors.New("Deferred response already sent")
+	}
+	d.done = true
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	server := d.server
+	if server == nil {
+		// not bound yet, we send it when we are
+		d.response = resp
+	} else {
+		resp.Id = d.id
+	}
+	callbacks := d.onDone
+	d.mu.Unlock()
+
+	for _, cb := range callbacks {
+		cb()
+	}
+
+	if server == nil {
+		return nil
+	}
+	return server.respond(resp)
+}
+
+func (d *Deferral) expire() {
+	if d.fallback != nil {
+		d.Resolve(d.fallback)
+		return
+	}
+	d.Fail(errors.New("Deferred response timed out"))
+}
+
+// bind attaches the deferral to the request it's answering. Called by
+// the server once the method's Call has returned
+func (d *Deferral) bind(s *Server, id *Id) {
+	d.mu.Lock()
+	d.server = s
+	d.id = id
+	resp := d.response
+	d.response = nil
+	if resp == nil && !d.done && d.timeout > 0 {
+		d.timer = time.AfterFunc(d.timeout, d.expire)
+	}
+	d.mu.Unlock()
+
+	if resp != nil {
+		resp.Id = id
+		s.respond(resp)
+	}
+}
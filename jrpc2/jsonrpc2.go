@@ -100,6 +100,13 @@ type Method interface {
 	Name() string
 }
 
+// A Method that provides its own params, instead of having
+// them built from its fields
+type RawParamsMethod interface {
+	Method
+	RawParams() (json.RawMessage, error)
+}
+
 // Responses are sent by the Server
 type Response struct {
 	Result Result    `json:"result,omitempty"`
@@ -140,14 +147,24 @@ func (e *RpcError) Error() string {
 // called on the client side
 func (r *Request) MarshalJSON() ([]byte, error) {
 	type Alias Request
+	var params interface{}
+	if rm, ok := r.Method.(RawParamsMethod); ok {
+		raw, err := rm.RawParams()
+		if err != nil {
+			return nil, err
+		}
+		params = raw
+	} else {
+		params = GetNamedParams(r.Method)
+	}
 	return json.Marshal(&struct {
-		Version string                 `json:"jsonrpc"`
-		Name    string                 `json:"method"`
-		Params  map[string]interface{} `json:"params"`
+		Version string      `json:"jsonrpc"`
+		Name    string      `json:"method"`
+		Params  interface{} `json:"params"`
 		*Alias
 	}{
 		Alias:   (*Alias)(r),
-		Params:  GetNamedParams(r.Method),
+		Params:  params,
 		Version: specVersion,
 		Name:    r.Method.Name(),
 	})
@@ -318,9 +335,9 @@ func isZero(x interface{}) bool {
 // Map passed in params to the fields on the method, in listed order
 func ParseParamArray(target Method, params []interface{}) error {
 	targetValue := reflect.Indirect(reflect.ValueOf(target))
-	fieldCount := targetFieldCount(targetValue)
-	if fieldCount < len(params) {
-		return errors.New(fmt.Sprintf("Too many parameters. Expected %d, received %d. See `help %s` for expected usage", fieldCount, len(params), target.Name()))
+	fields := paramFields(targetValue)
+	if len(fields) < len(params) {
+		return errors.New(fmt.Sprintf("Too many parameters. Expected %d, received %d. See `help %s` for expected usage", len(fields), len(params), target.Name()))
 	}
 	for i := range params {
 		// it's possible that there's a mismatch between
@@ -328,7 +345,7 @@ func ParseParamArray(target Method, params []interface{}) error {
 		// that we've received. for simplicity's sake,
 		// if you don't put all of your param names at the top
 		// of your object, well that's your problem.
-		fVal := targetValue.Field(i)
+		fVal := targetValue.Field(fields[i])
 		value := params[i]
 		err := innerParse(targetValue, fVal, value)
 		if err != nil {
@@ -338,16 +355,42 @@ func ParseParamArray(target Method, params []interface{}) error {
 	return nil
 }
 
-// We assume that all interfaceable fields are in the right place.
-// This lets us ignore non-interfaceable fields though.
-func targetFieldCount(fieldVal reflect.Value) int {
-	count := 0
+// The indexes of the fields that params are parsed into. We assume
+// that all interfaceable fields are in the right place. This lets
+// us ignore non-interfaceable fields though.
+func paramFields(fieldVal reflect.Value) []int {
+	var fields []int
 	for i := 0; i < fieldVal.NumField(); i++ {
-		if fieldVal.Field(i).CanInterface() {
-			count++
+		if fieldVal.Field(i).CanInterface() && !IsIgnoredField(fieldVal.Type().Field(i)) {
+			fields = append(fields, i)
 		}
 	}
-	return count
+	return fields
+}
+
+// Fields tagged `json:"-"` aren't params, nor are embedded
+// structs with nothing exported, eg helpers like a call context
+func IsIgnoredField(field reflect.StructField) bool {
+	tag, ok := field.Tag.Lookup("json")
+	if tag == "-" {
+		return true
+	}
+	if ok || !field.Anonymous {
+		return false
+	}
+	t := field.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).PkgPath == "" {
+			return false
+		}
+	}
+	return true
 }
 
 func ParseNamedParams(target Method, params map[string]interface{}) error {
@@ -365,6 +408,9 @@ func innerParseNamed(targetValue reflect.Value, params map[string]interface{}) e
 				continue
 			}
 			fT := tType.Field(i)
+			if IsIgnoredField(fT) {
+				continue
+			}
 			// check for the json tag match, as well a simple
 			// lower case name match
 			tag, _ := fT.Tag.Lookup("json")
@@ -395,11 +441,17 @@ func innerParse(targetValue reflect.Value, fVal reflect.Value, value interface{}
 
 		return NewError(nil, InvalidParams, fmt.Sprintf("Field %s.%s isn't settable. Are you sure it's exported?", targetValue.Type().Name(), name))
 	}
+	// a json null leaves the field as it was, so
+	// defaults set before parsing survive
+	if value == nil {
+		return nil
+	}
 	v := reflect.ValueOf(value)
 	if fVal.Kind() == v.Kind() &&
 		fVal.Kind() != reflect.Map &&
 		fVal.Kind() != reflect.Slice {
-		fVal.Set(v)
+		// Convert, in case it's a named type (type Status string)
+		fVal.Set(v.Convert(fVal.Type()))
 		return nil
 	}
 
@@ -150,6 +150,61 @@ func TestSimpleNamedParamParsing(t *testing.T) {
 	assert.Equal(t, second, hm2.Second, "The named param Second should be three")
 }
 
+func TestNullNamedParamParsing(t *testing.T) {
+	params := map[string]interface{}{
+		"first":  nil,
+		"second": float64(3),
+	}
+	hm := &HelloMethod{First: 7}
+	err := jrpc2.ParseNamedParams(hm, params)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), hm.First, "A null param should be left alone")
+	assert.Equal(t, int64(3), hm.Second)
+}
+
+type Status string
+
+type StatusMethod struct {
+	Status Status `json:"status"`
+}
+
+func (s *StatusMethod) Name() string {
+	return "status"
+}
+
+func TestNamedTypeParamParsing(t *testing.T) {
+	sm := &StatusMethod{}
+	err := jrpc2.ParseNamedParams(sm, map[string]interface{}{"status": "paid"})
+	assert.Nil(t, err)
+	assert.Equal(t, Status("paid"), sm.Status)
+}
+
+type Helper struct {
+	calls int
+}
+
+type EmbeddingMethod struct {
+	Helper
+	Count  int64  `json:"count"`
+	Label  string `json:"label,omitempty"`
+	Ignore string `json:"-"`
+}
+
+func (e *EmbeddingMethod) Name() string {
+	return "embedding"
+}
+
+func TestEmbeddedStructsAreNotParams(t *testing.T) {
+	em := &EmbeddingMethod{}
+	err := jrpc2.ParseParamArray(em, []interface{}{float64(4), "four"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), em.Count)
+	assert.Equal(t, "four", em.Label)
+
+	err = jrpc2.ParseParamArray(em, []interface{}{float64(4), "four", "five"})
+	assert.NotNil(t, err)
+}
+
 type Outer struct {
 	Method HelloMethod `json:"method"`
 }
@@ -9,7 +9,9 @@ import (
 	"log"
 	"net"
 	"os"
+	"runtime/debug"
 	"sync"
+	"time"
 )
 
 const (
@@ -23,6 +25,26 @@ type ServerMethod interface {
 	Call() (Result, error)
 }
 
+// A ServerMethod that parses its own params, instead of having
+// them set on its fields. It's also passed the name of the
+// method that was called, for the Wildcard method's sake.
+type RawParamsHandler interface {
+	ServerMethod
+	SetRawParams(method string, params json.RawMessage) error
+}
+
+// A ServerMethod that's told which request it's answering, and
+// the server it came in on, before it's called. eg so it can send
+// notifications about its progress.
+type RequestContextHandler interface {
+	ServerMethod
+	SetRequestContext(s *Server, id *Id)
+}
+
+// Register a method with this name to be sent any notifications
+// that come in, including ones for methods with their own handler.
+const Wildcard = "*"
+
 // a server needs to be able to
 // - send back a response (with the right id)
 // bonus round:
@@ -30,13 +52,26 @@ type ServerMethod interface {
 type Server struct {
 	registry sync.Map // map[string]ServerMethod
 	outQueue chan interface{}
+
+	// guards everything below
+	mu       sync.Mutex
 	shutdown bool
+	// closed on shutdown. Senders select on it, the
+	// outQueue itself is never closed
+	stopped chan struct{}
+	// set by Drain, new requests are refused
+	draining bool
+	// requests we haven't responded to yet
+	inflight int
+	// closed once inflight gets to zero, while draining
+	idle chan struct{}
 }
 
 func NewServer() *Server {
 	server := &Server{}
 	server.outQueue = make(chan interface{})
 	server.shutdown = false
+	server.stopped = make(chan struct{})
 	return server
 }
 
@@ -48,7 +83,7 @@ func (s *Server) StartUpSingle(in string) {
 		return
 	}
 	defer ln.Close()
-	for !s.shutdown {
+	for !s.isShutdown() {
 		inConn, err := ln.Accept()
 		if err != nil {
 			log.Print(err.Error())
@@ -64,14 +99,102 @@ func (s *Server) StartUpSingle(in string) {
 	}
 }
 
+// Serve requests from {in}, writing responses to {out}. Returns
+// when {in} is closed, or once Shutdown is called and everything
+// queued has been written out.
 func (s *Server) StartUp(in, out *os.File) error {
-	go s.setupWriteQueue(out)
-	return s.listen(in)
+	written := make(chan struct{})
+	go func() {
+		s.setupWriteQueue(out)
+		close(written)
+	}()
+	read := make(chan error, 1)
+	go func() {
+		read <- s.listen(in)
+	}()
+
+	select {
+	case err := <-read:
+		return err
+	case <-s.stopped:
+		<-written
+		return nil
+	}
 }
 
 func (s *Server) Shutdown() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shutdown {
+		return
+	}
 	s.shutdown = true
-	close(s.outQueue)
+	close(s.stopped)
+}
+
+// Stop taking new requests, and wait for the ones that are being
+// handled, including deferred ones, to be responded to. Requests
+// that come in from now on are answered with an error. Returns
+// false if they weren't all done within {timeout}.
+func (s *Server) Drain(timeout time.Duration) bool {
+	s.mu.Lock()
+	s.draining = true
+	if s.inflight == 0 {
+		s.mu.Unlock()
+		return true
+	}
+	if s.idle == nil {
+		s.idle = make(chan struct{})
+	}
+	idle := s.idle
+	s.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-idle:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// Count a request as in flight, unless we're no longer taking them
+func (s *Server) begin() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.draining || s.shutdown {
+		return false
+	}
+	s.inflight++
+	return true
+}
+
+// A request's been responded to
+func (s *Server) end() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inflight--
+	if s.inflight == 0 && s.idle != nil {
+		close(s.idle)
+		s.idle = nil
+	}
+}
+
+// Queue a message to be written out
+func (s *Server) send(msg interface{}) error {
+	s.mu.Lock()
+	shutdown, stopped := s.shutdown, s.stopped
+	s.mu.Unlock()
+	if shutdown {
+		return fmt.Errorf("Server is shutdown")
+	}
+	select {
+	case s.outQueue <- msg:
+		return nil
+	case <-stopped:
+		return fmt.Errorf("Server is shutdown")
+	}
 }
 
 func scanDoubleNewline(data []byte, atEOF bool) (advance int, token []byte, err error) {
@@ -105,7 +228,7 @@ func (s *Server) listen(in io.Reader) error {
 	buf := make([]byte, 1024)
 	scanner.Buffer(buf, MaxIntakeBuffer)
 	scanner.Split(scanDoubleNewline)
-	for scanner.Scan() && !s.shutdown {
+	for scanner.Scan() && !s.isShutdown() {
 		msg := scanner.Bytes()
 		if debugIO(true) {
 			log.Println(string(msg))
@@ -120,16 +243,32 @@ func (s *Server) listen(in io.Reader) error {
 		go processMsg(s, msg_buf)
 	}
 	if err := scanner.Err(); err != nil {
+		// our input's been closed under us, as expected
+		if s.isShutdown() {
+			return nil
+		}
 		log.Fatal(err)
 		return err
 	}
 	return nil
 }
 
+func (s *Server) isShutdown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.shutdown
+}
+
 func (s *Server) setupWriteQueue(outWriter io.Writer) {
 	out := bufio.NewWriter(outWriter)
 	twoNewlines := []byte("\n\n")
-	for response := range s.outQueue {
+	for {
+		var response interface{}
+		select {
+		case response = <-s.outQueue:
+		case <-s.stopped:
+			return
+		}
 		data, err := json.Marshal(response)
 		if err != nil {
 			log.Println(err.Error())
@@ -148,7 +287,7 @@ func (s *Server) setupWriteQueue(outWriter io.Writer) {
 func processMsg(s *Server, data []byte) {
 	// read is done. time to figure out what we've gotten
 	if len(data) == 0 {
-		s.outQueue <- (&Response{
+		s.send(&Response{
 			Error: &RpcError{
 				Code:    InvalidRequest,
 				Message: "Invalid Request",
@@ -160,12 +299,12 @@ func processMsg(s *Server, data []byte) {
 	// right now we don't handle arrays of requests...
 	// todo: infra for batches (ie use wait group)
 	if data[0] == '[' {
-		s.outQueue <- &Response{
+		s.send(&Response{
 			Error: &RpcError{
 				Code:    InternalErr,
 				Message: "This server can't handle batch requests",
 			},
-		}
+		})
 		return
 	}
 
@@ -173,27 +312,97 @@ func processMsg(s *Server, data []byte) {
 	var request Request
 	err := s.Unmarshal(data, &request)
 	if err != nil {
-		s.outQueue <- &Response{
+		s.send(&Response{
 			Id: err.Id,
 			Error: &RpcError{
 				Code:    err.Code,
 				Message: err.Msg,
 			},
-		}
+		})
 		return
 	}
 
 	// this is a subscription. we won't call you back.
 	if request.Id == nil {
 		request.Method.(ServerMethod).Call()
+		s.notifyWildcard(request.Method.Name(), data)
 		return
 	}
 	// ok we've successfully gotten the method call out..
-	s.outQueue <- Execute(request.Id, request.Method.(ServerMethod))
+	if !s.begin() {
+		s.send(&Response{
+			Id: request.Id,
+			Error: &RpcError{
+				Code:    InternalErr,
+				Message: "Server is shutting down",
+			},
+		})
+		return
+	}
+	if handler, ok := request.Method.(RequestContextHandler); ok {
+		handler.SetRequestContext(s, request.Id)
+	}
+	result, callErr := call(request.Method.(ServerMethod))
+
+	// the method will send its response later
+	if d, ok := result.(deferred); ok {
+		if callErr != nil {
+			d.deferral().Fail(callErr)
+		}
+		// it's done once it's sent, by respond
+		d.deferral().bind(s, request.Id)
+		return
+	}
+	s.send(newResponse(request.Id, result, callErr))
+	s.end()
+}
+
+// Call {method}, turning a panic into an error, so that the
+// caller still gets a response
+func call(method ServerMethod) (result Result, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("%s panicked: %v\n%s", method.Name(), r, debug.Stack())
+			result = nil
+			err = fmt.Errorf("%s panicked: %v", method.Name(), r)
+		}
+	}()
+	return method.Call()
+}
+
+// Pass a notification on to the Wildcard method, if there is one
+// and it wasn't the one that already handled it
+func (s *Server) notifyWildcard(name string, data []byte) {
+	if name == Wildcard {
+		return
+	}
+	stashed, ok := s.registry.Load(Wildcard)
+	if !ok {
+		return
+	}
+	handler, ok := stashed.(ServerMethod).New().(RawParamsHandler)
+	if !ok {
+		return
+	}
+	var raw struct {
+		Params json.RawMessage `json:"params"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return
+	}
+	if err := handler.SetRawParams(name, raw.Params); err != nil {
+		log.Printf("Unable to parse %s notification for %s: %s", name, Wildcard, err)
+		return
+	}
+	handler.Call()
 }
 
 func Execute(id *Id, method ServerMethod) *Response {
 	result, err := method.Call()
+	return newResponse(id, result, err)
+}
+
+func newResponse(id *Id, result Result, err error) *Response {
 	resp := &Response{
 		Id: id,
 	}
@@ -207,16 +416,17 @@ func Execute(id *Id, method ServerMethod) *Response {
 	return resp
 }
 
+// Sends a response for a request that was deferred
+func (s *Server) respond(resp *Response) error {
+	defer s.end()
+	return s.send(resp)
+}
+
 // Technically, this is a client side method but we're monkey
 // patching it on here because c-lightning acts both as a server
 // and a client.
 func (s *Server) Notify(m Method) error {
-	if s.shutdown {
-		return fmt.Errorf("Server is shutdown")
-	}
-	req := &Request{nil, m}
-	s.outQueue <- req
-	return nil
+	return s.send(&Request{nil, m})
 }
 
 func (s *Server) Register(method ServerMethod) error {
@@ -278,6 +488,10 @@ func (s *Server) Unmarshal(data []byte, r *Request) *CodedError {
 	}
 
 	stashedMethod, ok := s.registry.Load(raw.Name)
+	if !ok && raw.Id == nil {
+		// notifications can go to the catch-all
+		stashedMethod, ok = s.registry.Load(Wildcard)
+	}
 	if !ok {
 		return NewError(raw.Id, MethodNotFound, fmt.Sprintf("Method not found"))
 	}
@@ -286,6 +500,14 @@ func (s *Server) Unmarshal(data []byte, r *Request) *CodedError {
 	method := stashedMethod.(ServerMethod).New()
 	r.Method = method.(Method)
 
+	if handler, ok := method.(RawParamsHandler); ok {
+		err = handler.SetRawParams(raw.Name, raw.Params)
+		if err != nil {
+			return NewError(raw.Id, InvalidParams, err.Error())
+		}
+		return nil
+	}
+
 	// figure out what kind of params we've got: named, an array, or empty
 	if len(raw.Params) == 0 {
 		return nil